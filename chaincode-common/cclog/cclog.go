@@ -0,0 +1,222 @@
+// Package cclog writes leveled, structured logs of a chaincode as one JSON object per line.
+//
+// ForStub returns a logger whose lines carry the txId, channel, function and MSP of the caller of a
+// transaction. Record contents are logged as Payload, which is redacted to its size unless payloads are
+// enabled, so ledger data does not end up in the pod logs.
+//
+//	CHAINCODE_LOG_LEVEL     debug, info (the default), warn or error
+//	CHAINCODE_LOG_PAYLOADS  true to log payloads in full, e.g. while debugging a test network
+package cclog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// Level is the severity of a line; lines below the configured level are dropped
+type Level int
+
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < DebugLevel || l > ErrorLevel {
+		return strconv.Itoa(int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel reads a level name such as "warn"
+func ParseLevel(name string) (Level, error) {
+	for i, levelName := range levelNames {
+		if strings.EqualFold(strings.TrimSpace(name), levelName) {
+			return Level(i), nil
+		}
+	}
+	return InfoLevel, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", name)
+}
+
+// Payload is ledger data, such as a record or a query result, logged only as its size unless payloads are enabled
+type Payload []byte
+
+var (
+	mu       sync.Mutex
+	out      io.Writer = os.Stdout
+	minLevel           = InfoLevel
+	payloads           = false
+	now                = time.Now
+)
+
+func init() {
+	if name, ok := os.LookupEnv("CHAINCODE_LOG_LEVEL"); ok {
+		level, err := ParseLevel(name)
+		minLevel = level
+		if err != nil {
+			Warn("CHAINCODE_LOG_LEVEL is invalid, logging at info", "error", err)
+		}
+	}
+	if value, ok := os.LookupEnv("CHAINCODE_LOG_PAYLOADS"); ok {
+		enabled, err := strconv.ParseBool(value)
+		payloads = enabled
+		if err != nil {
+			Warn("CHAINCODE_LOG_PAYLOADS must be true or false, redacting payloads", "value", value)
+		}
+	}
+}
+
+// SetOutput changes where lines are written, standard output by default
+func SetOutput(w io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+	out = w
+}
+
+// SetLevel changes the lowest level that is written
+func SetLevel(level Level) {
+	mu.Lock()
+	defer mu.Unlock()
+	minLevel = level
+}
+
+// SetPayloads enables or disables writing payloads in full
+func SetPayloads(enabled bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	payloads = enabled
+}
+
+// Logger writes lines with a fixed set of fields
+type Logger struct {
+	fields []interface{}
+}
+
+// New returns a logger whose lines carry the given key value pairs
+func New(keyValues ...interface{}) *Logger {
+	return &Logger{fields: keyValues}
+}
+
+// ForStub returns a logger whose lines carry the transaction id, channel, function and MSP of the caller
+func ForStub(stub shim.ChaincodeStubInterface) *Logger {
+	function, _ := stub.GetFunctionAndParameters()
+	fields := []interface{}{"txId", stub.GetTxID(), "channel", stub.GetChannelID(), "function", function}
+	if mspID, err := cid.GetMSPID(stub); err == nil {
+		fields = append(fields, "mspId", mspID)
+	}
+	return &Logger{fields: fields}
+}
+
+// With returns a logger with more key value pairs
+func (l *Logger) With(keyValues ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keyValues))
+	fields = append(fields, l.fields...)
+	return &Logger{fields: append(fields, keyValues...)}
+}
+
+// Debug writes a line at the debug level with the key value pairs
+func (l *Logger) Debug(msg string, keyValues ...interface{}) {
+	l.write(DebugLevel, msg, keyValues)
+}
+
+// Info writes a line at the info level with the key value pairs
+func (l *Logger) Info(msg string, keyValues ...interface{}) {
+	l.write(InfoLevel, msg, keyValues)
+}
+
+// Warn writes a line at the warn level with the key value pairs
+func (l *Logger) Warn(msg string, keyValues ...interface{}) {
+	l.write(WarnLevel, msg, keyValues)
+}
+
+// Error writes a line at the error level with the key value pairs
+func (l *Logger) Error(msg string, keyValues ...interface{}) {
+	l.write(ErrorLevel, msg, keyValues)
+}
+
+var root = &Logger{}
+
+// Debug writes a line without transaction fields at the debug level
+func Debug(msg string, keyValues ...interface{}) {
+	root.write(DebugLevel, msg, keyValues)
+}
+
+// Info writes a line without transaction fields at the info level
+func Info(msg string, keyValues ...interface{}) {
+	root.write(InfoLevel, msg, keyValues)
+}
+
+// Warn writes a line without transaction fields at the warn level
+func Warn(msg string, keyValues ...interface{}) {
+	root.write(WarnLevel, msg, keyValues)
+}
+
+// Error writes a line without transaction fields at the error level
+func Error(msg string, keyValues ...interface{}) {
+	root.write(ErrorLevel, msg, keyValues)
+}
+
+func (l *Logger) write(level Level, msg string, keyValues []interface{}) {
+	mu.Lock()
+	defer mu.Unlock()
+	if level < minLevel {
+		return
+	}
+
+	line := &bytes.Buffer{}
+	line.WriteString(`{"time":`)
+	writeValue(line, now().UTC().Format(time.RFC3339Nano))
+	line.WriteString(`,"level":`)
+	writeValue(line, level.String())
+	line.WriteString(`,"msg":`)
+	writeValue(line, msg)
+	for _, fields := range [][]interface{}{l.fields, keyValues} {
+		for i := 0; i < len(fields); i += 2 {
+			line.WriteByte(',')
+			writeValue(line, fmt.Sprint(fields[i]))
+			line.WriteByte(':')
+			if i+1 < len(fields) {
+				writeValue(line, fields[i+1])
+			} else {
+				writeValue(line, nil)
+			}
+		}
+	}
+	line.WriteString("}\n")
+	out.Write(line.Bytes())
+}
+
+/* writeValue writes a value as JSON: errors as their message and payloads as their size unless payloads are enabled */
+func writeValue(line *bytes.Buffer, value interface{}) {
+	switch v := value.(type) {
+	case Payload:
+		if !payloads {
+			fmt.Fprintf(line, `{"redacted":true,"bytes":%d}`, len(v))
+			return
+		}
+		value = string(v)
+	case error:
+		value = v.Error()
+	case fmt.Stringer:
+		value = v.String()
+	}
+	valueAsBytes, err := json.Marshal(value)
+	if err != nil {
+		valueAsBytes, _ = json.Marshal(fmt.Sprint(value))
+	}
+	line.Write(valueAsBytes)
+}
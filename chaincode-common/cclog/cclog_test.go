@@ -0,0 +1,122 @@
+package cclog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"chaincode-common/mockidentity"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// loggingChaincode logs a query result in every invocation
+type loggingChaincode struct{}
+
+func (loggingChaincode) Init(shim.ChaincodeStubInterface) pb.Response {
+	return shim.Success(nil)
+}
+
+func (loggingChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	ForStub(stub).Info("query", "result", Payload(`[{"Key":"Utility1"}]`))
+	return shim.Success(nil)
+}
+
+/* capture sets up the logger for a test and returns its output */
+func capture(t *testing.T, level Level, logPayloads bool) *bytes.Buffer {
+	buffer := &bytes.Buffer{}
+	SetOutput(buffer)
+	SetLevel(level)
+	SetPayloads(logPayloads)
+	now = func() time.Time { return time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC) }
+	return buffer
+}
+
+func lines(t *testing.T, buffer *bytes.Buffer) []map[string]interface{} {
+	decoded := []map[string]interface{}{}
+	for _, line := range strings.Split(strings.TrimSuffix(buffer.String(), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		fields := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(line), &fields); err != nil {
+			t.Fatalf("line is not JSON: %s", line)
+		}
+		decoded = append(decoded, fields)
+	}
+	return decoded
+}
+
+func TestForStub(t *testing.T) {
+	tests := []struct {
+		name        string
+		logPayloads bool
+		wantResult  interface{}
+	}{
+		{"payloads are redacted", false, map[string]interface{}{"redacted": true, "bytes": float64(20)}},
+		{"payloads are logged when enabled", true, `[{"Key":"Utility1"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buffer := capture(t, InfoLevel, tt.logPayloads)
+			stub, err := mockidentity.NewStub("emissions", loggingChaincode{}, "Org1MSP", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stub.ChannelID = "utilityemissionchannel"
+			stub.MockInvoke("tx1", [][]byte{[]byte("getAllUtilityIdentifiers")})
+
+			logged := lines(t, buffer)
+			if len(logged) != 1 {
+				t.Fatalf("got %d lines, want 1: %s", len(logged), buffer)
+			}
+			want := map[string]interface{}{
+				"time": "2021-01-02T03:04:05Z", "level": "info", "msg": "query", "txId": "tx1",
+				"channel": "utilityemissionchannel", "function": "getAllUtilityIdentifiers", "mspId": "Org1MSP",
+			}
+			for key, value := range want {
+				if logged[0][key] != value {
+					t.Errorf("%s = %v, want %v", key, logged[0][key], value)
+				}
+			}
+			resultAsBytes, _ := json.Marshal(logged[0]["result"])
+			wantAsBytes, _ := json.Marshal(tt.wantResult)
+			if !bytes.Equal(resultAsBytes, wantAsBytes) {
+				t.Errorf("result = %s, want %s", resultAsBytes, wantAsBytes)
+			}
+		})
+	}
+}
+
+func TestLevel(t *testing.T) {
+	buffer := capture(t, WarnLevel, false)
+	logger := New("component", "test").With("attempt", 2)
+	logger.Debug("dropped")
+	logger.Info("dropped")
+	logger.Warn("kept", "error", errors.New("failed"))
+	Error("kept without fields", "odd")
+
+	logged := lines(t, buffer)
+	if len(logged) != 2 {
+		t.Fatalf("got %d lines, want 2: %s", len(logged), buffer)
+	}
+	if logged[0]["level"] != "warn" || logged[0]["component"] != "test" || logged[0]["attempt"] != float64(2) || logged[0]["error"] != "failed" {
+		t.Errorf("unexpected line %v", logged[0])
+	}
+	if value, ok := logged[1]["odd"]; logged[1]["level"] != "error" || !ok || value != nil {
+		t.Errorf("unexpected line %v", logged[1])
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	if level, err := ParseLevel(" DEBUG"); err != nil || level != DebugLevel {
+		t.Errorf("ParseLevel(DEBUG) = %v, %v", level, err)
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Errorf("ParseLevel(verbose) did not fail")
+	}
+}
@@ -0,0 +1,251 @@
+// Package ccserver runs a chaincode as an external chaincode service, with mutual TLS between the peer and the chaincode.
+//
+// The server is configured from the environment, like the ChaincodeServer of the shim, which it wraps: the peer
+// connects to CHAINCODE_ADDRESS and the chaincode serves the package CHAINCODE_CCID. Unlike the shim, the key,
+// certificate and client CA roots are read again on every TLS handshake when they are files, so rotated
+// certificates are used without a restart.
+package ccserver
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"chaincode-common/cclog"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+)
+
+// maxMessageSize matches the message size limits of the peer and the shim
+const maxMessageSize = 100 * 1024 * 1024
+
+// PEM is PEM data given inline, or the path of a file holding it
+type PEM struct {
+	Data []byte
+	File string
+	// Env names the variable the PEM came from, for error messages
+	Env string
+}
+
+func (p PEM) read() ([]byte, error) {
+	if p.File == "" {
+		return p.Data, nil
+	}
+	data, err := ioutil.ReadFile(p.File)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", p.Env, err)
+	}
+	return data, nil
+}
+
+// Config is the configuration of the chaincode server
+type Config struct {
+	CCID    string
+	Address string
+	// TLSDisabled must be set explicitly to serve without TLS
+	TLSDisabled bool
+	Key         PEM
+	Cert        PEM
+	// ClientCACerts are the roots the certificate of the peer must chain to
+	ClientCACerts PEM
+}
+
+// ConfigFromEnv reads the configuration from the environment. Each PEM is set inline, e.g. CHAINCODE_TLS_KEY,
+// or as a file, e.g. CHAINCODE_TLS_KEY_FILE; only a file is reloaded when it changes.
+//
+//	CHAINCODE_CCID, CHAINCODE_ADDRESS     package identifier and listen address
+//	CHAINCODE_TLS_DISABLED                true to serve without TLS
+//	CHAINCODE_TLS_KEY[_FILE]              private key of the server
+//	CHAINCODE_TLS_CERT[_FILE]             certificate of the server
+//	CHAINCODE_TLS_CLIENT_CA_CERTS[_FILE]  roots of the peer client certificates
+func ConfigFromEnv() (*Config, error) {
+	config := &Config{CCID: os.Getenv("CHAINCODE_CCID"), Address: os.Getenv("CHAINCODE_ADDRESS")}
+	if disabled, ok := os.LookupEnv("CHAINCODE_TLS_DISABLED"); ok {
+		var err error
+		if config.TLSDisabled, err = strconv.ParseBool(disabled); err != nil {
+			return nil, fmt.Errorf("CHAINCODE_TLS_DISABLED must be true or false, got %q", disabled)
+		}
+	}
+	if config.TLSDisabled {
+		return config, nil
+	}
+
+	var err error
+	if config.Key, err = pemFromEnv("CHAINCODE_TLS_KEY"); err != nil {
+		return nil, err
+	}
+	if config.Cert, err = pemFromEnv("CHAINCODE_TLS_CERT"); err != nil {
+		return nil, err
+	}
+	if config.ClientCACerts, err = pemFromEnv("CHAINCODE_TLS_CLIENT_CA_CERTS"); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func pemFromEnv(name string) (PEM, error) {
+	data, inline := os.LookupEnv(name)
+	file, fromFile := os.LookupEnv(name + "_FILE")
+	switch {
+	case inline && fromFile:
+		return PEM{}, fmt.Errorf("set only one of %s and %s_FILE", name, name)
+	case fromFile:
+		return PEM{File: file, Env: name + "_FILE"}, nil
+	case inline:
+		return PEM{Data: []byte(data), Env: name}, nil
+	}
+	return PEM{}, fmt.Errorf("%s or %s_FILE must be set for mutual TLS with the peer, or CHAINCODE_TLS_DISABLED=true", name, name)
+}
+
+// Server is a chaincode server listening for the peer
+type Server struct {
+	listener     net.Listener
+	server       *grpc.Server
+	certificates *certificates
+}
+
+// New validates the configuration, loads the certificates and listens on the address, so a
+// misconfigured server fails before it is started.
+func New(cc shim.Chaincode, config *Config) (*Server, error) {
+	if config.CCID == "" {
+		return nil, errors.New("CHAINCODE_CCID must be set to the package identifier of the chaincode")
+	}
+	if config.Address == "" {
+		return nil, errors.New("CHAINCODE_ADDRESS must be set to the listen address of the chaincode")
+	}
+
+	serverOpts := []grpc.ServerOption{
+		grpc.KeepaliveParams(keepalive.ServerParameters{Time: time.Minute, Timeout: 20 * time.Second}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{MinTime: time.Minute, PermitWithoutStream: true}),
+		grpc.ConnectionTimeout(5 * time.Second),
+		grpc.MaxSendMsgSize(maxMessageSize),
+		grpc.MaxRecvMsgSize(maxMessageSize),
+	}
+	var certs *certificates
+	if !config.TLSDisabled {
+		certs = &certificates{key: config.Key, cert: config.Cert, clientCACerts: config.ClientCACerts}
+		if _, err := certs.load(); err != nil {
+			return nil, err
+		}
+		serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(&tls.Config{GetConfigForClient: certs.configForClient})))
+	}
+
+	listener, err := net.Listen("tcp", config.Address)
+	if err != nil {
+		return nil, fmt.Errorf("CHAINCODE_ADDRESS: %s", err)
+	}
+	server := grpc.NewServer(serverOpts...)
+	pb.RegisterChaincodeServer(server, &shim.ChaincodeServer{CCID: config.CCID, Address: config.Address, CC: cc})
+	return &Server{listener: listener, server: server, certificates: certs}, nil
+}
+
+// Addr is the address the server listens on
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Start serves the peer until the server is stopped
+func (s *Server) Start() error {
+	return s.server.Serve(s.listener)
+}
+
+// Stop closes the listener and the connections
+func (s *Server) Stop() {
+	s.server.Stop()
+	s.listener.Close()
+}
+
+/* certificates builds the TLS configuration of the server, rebuilding it when the PEM data changes */
+type certificates struct {
+	key, cert, clientCACerts PEM
+
+	mu     sync.Mutex
+	pems   [][]byte
+	config *tls.Config
+}
+
+/* load reads the PEM data and returns the configuration, rebuilt if the data changed since the last load */
+func (c *certificates) load() (*tls.Config, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pems := make([][]byte, 0, 3)
+	for _, p := range []PEM{c.key, c.cert, c.clientCACerts} {
+		data, err := p.read()
+		if err != nil {
+			return nil, err
+		}
+		pems = append(pems, data)
+	}
+	if c.config != nil && samePEMs(pems, c.pems) {
+		return c.config, nil
+	}
+
+	config, err := c.build(pems[0], pems[1], pems[2])
+	if err != nil {
+		return nil, err
+	}
+	c.pems, c.config = pems, config
+	return config, nil
+}
+
+func samePEMs(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *certificates) build(key, cert, clientCACerts []byte) (*tls.Config, error) {
+	keyPair, err := tls.X509KeyPair(cert, key)
+	if err != nil {
+		return nil, fmt.Errorf("%s and %s are not a valid key pair: %s", c.cert.Env, c.key.Env, err)
+	}
+	if keyPair.Leaf, err = x509.ParseCertificate(keyPair.Certificate[0]); err != nil {
+		return nil, fmt.Errorf("%s: %s", c.cert.Env, err)
+	}
+	if time.Now().After(keyPair.Leaf.NotAfter) {
+		return nil, fmt.Errorf("%s expired on %s", c.cert.Env, keyPair.Leaf.NotAfter.Format(time.RFC3339))
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(clientCACerts) {
+		return nil, fmt.Errorf("%s has no PEM certificates", c.clientCACerts.Env)
+	}
+	return &tls.Config{
+		MinVersion:             tls.VersionTLS12,
+		Certificates:           []tls.Certificate{keyPair},
+		ClientCAs:              clientCAs,
+		ClientAuth:             tls.RequireAndVerifyClientCert,
+		SessionTicketsDisabled: true,
+		NextProtos:             []string{"h2"},
+	}, nil
+}
+
+/* configForClient reloads the certificates for every handshake; while new files are invalid, e.g. half written, the previous ones are kept */
+func (c *certificates) configForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	config, err := c.load()
+	if err != nil {
+		cclog.Warn("reloading the chaincode TLS certificates failed, keeping the previous ones", "error", err)
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.config, nil
+	}
+	return config, nil
+}
@@ -0,0 +1,292 @@
+package ccserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+type noopChaincode struct{}
+
+func (noopChaincode) Init(shim.ChaincodeStubInterface) pb.Response   { return shim.Success(nil) }
+func (noopChaincode) Invoke(shim.ChaincodeStubInterface) pb.Response { return shim.Success(nil) }
+
+// testCA is a self-signed CA issuing the certificates of a test
+type testCA struct {
+	cert   *x509.Certificate
+	key    *ecdsa.PrivateKey
+	serial int64
+}
+
+func newTestCA(t *testing.T) *testCA {
+	ca := &testCA{}
+	ca.cert, ca.key = ca.issue(t, "test CA", nil, nil)
+	return ca
+}
+
+/* issue creates a certificate signed by the CA, or self-signed when parent is nil */
+func (ca *testCA) issue(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.serial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(ca.serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+		parent, parentKey = template, key
+	}
+	certAsBytes, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(certAsBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+/* keyPair issues a certificate and returns it and its key as PEM */
+func (ca *testCA) keyPair(t *testing.T, name string) (certPEM []byte, keyPEM []byte) {
+	cert, key := ca.issue(t, name, ca.cert, ca.key)
+	keyAsBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyAsBytes})
+}
+
+func (ca *testCA) certPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+}
+
+func (ca *testCA) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+/* startServer serves with the certificates of the CA written to files in dir */
+func startServer(t *testing.T, ca *testCA, dir string) *Server {
+	cert, key := ca.keyPair(t, "chaincode")
+	config := &Config{
+		CCID:          "emissions:1",
+		Address:       "127.0.0.1:0",
+		Key:           PEM{File: writeFile(t, dir, "key.pem", key), Env: "CHAINCODE_TLS_KEY_FILE"},
+		Cert:          PEM{File: writeFile(t, dir, "cert.pem", cert), Env: "CHAINCODE_TLS_CERT_FILE"},
+		ClientCACerts: PEM{File: writeFile(t, dir, "ca.pem", ca.certPEM()), Env: "CHAINCODE_TLS_CLIENT_CA_CERTS_FILE"},
+	}
+	server, err := New(noopChaincode{}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Start()
+	return server
+}
+
+/* handshake connects as a peer with the given client certificate and returns the certificate of the server */
+func handshake(server *Server, roots *x509.CertPool, clientCerts []tls.Certificate) (*x509.Certificate, error) {
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, "tcp", server.Addr().String(), &tls.Config{
+		RootCAs:      roots,
+		Certificates: clientCerts,
+		NextProtos:   []string{"h2"},
+		// the server rejects a client certificate during a TLS 1.2 handshake, not on the first read
+		MaxVersion: tls.VersionTLS12,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0], nil
+}
+
+func clientCertificate(t *testing.T, ca *testCA) []tls.Certificate {
+	certPEM, keyPEM := ca.keyPair(t, "peer")
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []tls.Certificate{cert}
+}
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "ccserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestMutualTLSHandshake(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	ca := newTestCA(t)
+	server := startServer(t, ca, dir)
+	defer server.Stop()
+
+	tests := []struct {
+		name        string
+		clientCerts []tls.Certificate
+		wantErr     bool
+	}{
+		{"peer with a certificate of the CA", clientCertificate(t, ca), false},
+		{"peer without a certificate", nil, true},
+		{"peer with a certificate of another CA", clientCertificate(t, newTestCA(t)), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverCert, err := handshake(server, ca.pool(), tt.clientCerts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("handshake error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && serverCert.Subject.CommonName != "chaincode" {
+				t.Errorf("server certificate is %s", serverCert.Subject.CommonName)
+			}
+		})
+	}
+}
+
+func TestReloadCertificates(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	ca := newTestCA(t)
+	server := startServer(t, ca, dir)
+	defer server.Stop()
+	clientCerts := clientCertificate(t, ca)
+
+	before, err := handshake(server, ca.pool(), clientCerts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, key := ca.keyPair(t, "chaincode")
+	writeFile(t, dir, "key.pem", key)
+	writeFile(t, dir, "cert.pem", cert)
+	rotated, err := handshake(server, ca.pool(), clientCerts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.SerialNumber.Cmp(before.SerialNumber) == 0 {
+		t.Fatalf("server still presents certificate %s after rotation", before.SerialNumber)
+	}
+
+	// a certificate that does not match the key is not loaded
+	otherCert, _ := ca.keyPair(t, "chaincode")
+	writeFile(t, dir, "cert.pem", otherCert)
+	kept, err := handshake(server, ca.pool(), clientCerts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kept.SerialNumber.Cmp(rotated.SerialNumber) != 0 {
+		t.Errorf("server presents certificate %s, want the previous %s", kept.SerialNumber, rotated.SerialNumber)
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	variables := []string{
+		"CHAINCODE_TLS_DISABLED",
+		"CHAINCODE_TLS_KEY", "CHAINCODE_TLS_KEY_FILE",
+		"CHAINCODE_TLS_CERT", "CHAINCODE_TLS_CERT_FILE",
+		"CHAINCODE_TLS_CLIENT_CA_CERTS", "CHAINCODE_TLS_CLIENT_CA_CERTS_FILE",
+	}
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{"TLS disabled", map[string]string{"CHAINCODE_TLS_DISABLED": "true"}, ""},
+		{"invalid TLS disabled", map[string]string{"CHAINCODE_TLS_DISABLED": "no"}, "CHAINCODE_TLS_DISABLED must be true or false"},
+		{"no certificates", map[string]string{}, "CHAINCODE_TLS_KEY or CHAINCODE_TLS_KEY_FILE must be set"},
+		{"inline and file", map[string]string{"CHAINCODE_TLS_KEY": "k", "CHAINCODE_TLS_KEY_FILE": "key.pem"}, "set only one of CHAINCODE_TLS_KEY and CHAINCODE_TLS_KEY_FILE"},
+		{"no client CA", map[string]string{"CHAINCODE_TLS_KEY": "k", "CHAINCODE_TLS_CERT_FILE": "cert.pem"}, "CHAINCODE_TLS_CLIENT_CA_CERTS or CHAINCODE_TLS_CLIENT_CA_CERTS_FILE must be set"},
+		{"mutual TLS", map[string]string{"CHAINCODE_TLS_KEY": "k", "CHAINCODE_TLS_CERT_FILE": "cert.pem", "CHAINCODE_TLS_CLIENT_CA_CERTS_FILE": "ca.pem"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range variables {
+				os.Unsetenv(name)
+			}
+			for name, value := range tt.env {
+				os.Setenv(name, value)
+				defer os.Unsetenv(name)
+			}
+			_, err := ConfigFromEnv()
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("ConfigFromEnv() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("ConfigFromEnv() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewFailsFast(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	ca := newTestCA(t)
+	cert, key := ca.keyPair(t, "chaincode")
+	otherCert, _ := ca.keyPair(t, "chaincode")
+	keyPEM := PEM{Data: key, Env: "CHAINCODE_TLS_KEY"}
+	clientCAs := PEM{Data: ca.certPEM(), Env: "CHAINCODE_TLS_CLIENT_CA_CERTS"}
+
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr string
+	}{
+		{"no CCID", Config{Address: "127.0.0.1:0", TLSDisabled: true}, "CHAINCODE_CCID must be set"},
+		{"no address", Config{CCID: "emissions:1", TLSDisabled: true}, "CHAINCODE_ADDRESS must be set"},
+		{"missing file", Config{CCID: "emissions:1", Address: "127.0.0.1:0", Key: keyPEM, ClientCACerts: clientCAs,
+			Cert: PEM{File: filepath.Join(dir, "missing.pem"), Env: "CHAINCODE_TLS_CERT_FILE"}}, "CHAINCODE_TLS_CERT_FILE: open"},
+		{"mismatched key pair", Config{CCID: "emissions:1", Address: "127.0.0.1:0", Key: keyPEM, ClientCACerts: clientCAs,
+			Cert: PEM{Data: otherCert, Env: "CHAINCODE_TLS_CERT"}}, "CHAINCODE_TLS_CERT and CHAINCODE_TLS_KEY are not a valid key pair"},
+		{"no client CA certificates", Config{CCID: "emissions:1", Address: "127.0.0.1:0", Key: keyPEM,
+			Cert:          PEM{Data: cert, Env: "CHAINCODE_TLS_CERT"},
+			ClientCACerts: PEM{Data: []byte("not a certificate"), Env: "CHAINCODE_TLS_CLIENT_CA_CERTS"}}, "CHAINCODE_TLS_CLIENT_CA_CERTS has no PEM certificates"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := New(noopChaincode{}, &tt.config)
+			if err == nil {
+				server.Stop()
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("New() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
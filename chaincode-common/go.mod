@@ -0,0 +1,10 @@
+module chaincode-common
+
+go 1.12
+
+require (
+	github.com/golang/protobuf v1.3.3
+	github.com/hyperledger/fabric-chaincode-go v0.0.0-20200128192331-2d899240a7ed
+	github.com/hyperledger/fabric-protos-go v0.0.0-20200124220212-e9cfc186ba7b
+	google.golang.org/grpc v1.31.0
+)
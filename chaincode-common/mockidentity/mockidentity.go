@@ -0,0 +1,93 @@
+// Package mockidentity runs a chaincode on a shimtest.MockStub as a given client identity.
+//
+// Chaincode that reads the client identity with the cid library needs the creator of the transaction
+// to be a serialized identity. Stub sets it to a self-signed certificate carrying the MSP id and the
+// X.509 attributes of the identity.
+package mockidentity
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/attrmgr"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-protos-go/msp"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// Stub is a MockStub whose transactions are submitted by a client identity
+type Stub struct {
+	*shimtest.MockStub
+	// Event is the chaincode event of the last transaction, nil if it set none
+	Event *pb.ChaincodeEvent
+}
+
+// NewStub creates a MockStub for the chaincode, invoked as the given identity
+func NewStub(name string, cc shim.Chaincode, mspID string, attrs map[string]string) (*Stub, error) {
+	stub := &Stub{MockStub: shimtest.NewMockStub(name, cc)}
+	if err := stub.SetIdentity(mspID, attrs); err != nil {
+		return nil, err
+	}
+	return stub, nil
+}
+
+// SetIdentity changes the identity that submits the next transactions
+func (s *Stub) SetIdentity(mspID string, attrs map[string]string) error {
+	creator, err := serializedIdentity(mspID, attrs)
+	if err != nil {
+		return err
+	}
+	s.Creator = creator
+	return nil
+}
+
+// MockInvoke invokes the chaincode and keeps the event it set, like a peer keeps the last event of a transaction.
+// The events are drained, as the MockStub would block once its event channel is full.
+func (s *Stub) MockInvoke(uuid string, args [][]byte) pb.Response {
+	response := s.MockStub.MockInvoke(uuid, args)
+	s.Event = nil
+	for {
+		select {
+		case event := <-s.ChaincodeEventsChannel:
+			s.Event = event
+		default:
+			return response
+		}
+	}
+}
+
+/* serializedIdentity builds the creator of a transaction: the MSP id and a PEM certificate with the attributes in the fabric CA extension */
+func serializedIdentity(mspID string, attrs map[string]string) ([]byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	attrsAsBytes, err := json.Marshal(&attrmgr.Attributes{Attrs: attrs})
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:    big.NewInt(1),
+		Subject:         pkix.Name{CommonName: "mockidentity", Organization: []string{mspID}},
+		NotBefore:       time.Now().Add(-time.Hour),
+		NotAfter:        time.Now().Add(24 * time.Hour),
+		ExtraExtensions: []pkix.Extension{{Id: attrmgr.AttrOID, Value: attrsAsBytes}},
+	}
+	certAsBytes, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(&msp.SerializedIdentity{
+		Mspid:   mspID,
+		IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certAsBytes}),
+	})
+}
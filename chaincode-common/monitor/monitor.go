@@ -0,0 +1,365 @@
+// Package monitor serves the health, readiness and Prometheus metrics of a chaincode on an HTTP side listener.
+//
+// Instrument wraps the chaincode to count the invocations of each function, their latency, their errors and
+// their state reads and writes. The listener serves
+//
+//	/healthz  200 while no invocation has been running for longer than the hang timeout, for liveness probes
+//	/readyz   200 once the chaincode is ready to serve the peer, for readiness probes
+//	/metrics  the metrics in the Prometheus text format
+package monitor
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// DefaultHangTimeout is well above the 30s the peer waits for a chaincode by default
+const DefaultHangTimeout = 2 * time.Minute
+
+// unknownFunction labels the invocations of functions the chaincode does not have, so clients cannot add labels
+const unknownFunction = "unknown"
+
+// latencyBuckets are the upper bounds in seconds of the invoke latency histogram
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type functionMetrics struct {
+	invokes     uint64
+	errors      uint64
+	buckets     []uint64
+	latencySum  float64
+	stateReads  map[string]uint64
+	stateWrites map[string]uint64
+}
+
+// Monitor holds the metrics and the health of a chaincode
+type Monitor struct {
+	// HangTimeout is how long an invocation may run before the chaincode is reported unhealthy
+	HangTimeout time.Duration
+
+	mu        sync.Mutex
+	functions map[string]*functionMetrics
+	inFlight  map[uint64]time.Time
+	nextID    uint64
+	ready     bool
+	now       func() time.Time
+}
+
+// New returns a monitor of the given chaincode functions; invocations of other functions are labelled "unknown"
+func New(functions []string) *Monitor {
+	m := &Monitor{
+		HangTimeout: DefaultHangTimeout,
+		functions:   map[string]*functionMetrics{unknownFunction: newFunctionMetrics()},
+		inFlight:    map[uint64]time.Time{},
+		now:         time.Now,
+	}
+	for _, function := range functions {
+		m.functions[function] = newFunctionMetrics()
+	}
+	return m
+}
+
+func newFunctionMetrics() *functionMetrics {
+	return &functionMetrics{
+		buckets:     make([]uint64, len(latencyBuckets)),
+		stateReads:  map[string]uint64{},
+		stateWrites: map[string]uint64{},
+	}
+}
+
+// FromEnv starts a monitor listening on CHAINCODE_MONITOR_ADDRESS, with the hang timeout in
+// CHAINCODE_MONITOR_HANG_TIMEOUT, e.g. 90s. Without an address it returns a nil monitor, whose
+// methods do nothing, so the listener is optional.
+func FromEnv(functions []string) (*Monitor, error) {
+	address := os.Getenv("CHAINCODE_MONITOR_ADDRESS")
+	if address == "" {
+		return nil, nil
+	}
+	m := New(functions)
+	if timeout, ok := os.LookupEnv("CHAINCODE_MONITOR_HANG_TIMEOUT"); ok {
+		var err error
+		if m.HangTimeout, err = time.ParseDuration(timeout); err != nil || m.HangTimeout <= 0 {
+			return nil, fmt.Errorf("CHAINCODE_MONITOR_HANG_TIMEOUT must be a positive duration such as 90s, got %q", timeout)
+		}
+	}
+	if err := m.Listen(address); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Listen serves the monitor on the address in the background; it fails if it cannot listen
+func (m *Monitor) Listen(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("CHAINCODE_MONITOR_ADDRESS: %s", err)
+	}
+	go http.Serve(listener, m.Handler())
+	return nil
+}
+
+// SetReady reports whether the chaincode is ready to serve the peer
+func (m *Monitor) SetReady(ready bool) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ready = ready
+}
+
+// Instrument returns the chaincode with its invocations measured by the monitor
+func (m *Monitor) Instrument(cc shim.Chaincode) shim.Chaincode {
+	if m == nil {
+		return cc
+	}
+	return &instrumented{cc: cc, monitor: m}
+}
+
+// Handler serves /healthz, /readyz and /metrics
+func (m *Monitor) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", m.healthz)
+	mux.HandleFunc("/readyz", m.readyz)
+	mux.HandleFunc("/metrics", m.metrics)
+	return mux
+}
+
+func (m *Monitor) healthz(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	var oldest time.Duration
+	for _, started := range m.inFlight {
+		if running := m.now().Sub(started); running > oldest {
+			oldest = running
+		}
+	}
+	m.mu.Unlock()
+
+	if oldest > m.HangTimeout {
+		http.Error(w, fmt.Sprintf("an invocation has been running for %s", oldest.Round(time.Second)), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+func (m *Monitor) readyz(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	ready := m.ready
+	m.mu.Unlock()
+
+	if !ready {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+func (m *Monitor) metrics(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.functions))
+	for name := range m.functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintln(w, "# HELP chaincode_invokes_total Invocations of each chaincode function.")
+	fmt.Fprintln(w, "# TYPE chaincode_invokes_total counter")
+	for _, name := range names {
+		fmt.Fprintf(w, "chaincode_invokes_total{function=%q} %d\n", name, m.functions[name].invokes)
+	}
+	fmt.Fprintln(w, "# HELP chaincode_invoke_errors_total Invocations of each chaincode function that returned an error status.")
+	fmt.Fprintln(w, "# TYPE chaincode_invoke_errors_total counter")
+	for _, name := range names {
+		fmt.Fprintf(w, "chaincode_invoke_errors_total{function=%q} %d\n", name, m.functions[name].errors)
+	}
+	fmt.Fprintln(w, "# HELP chaincode_invoke_duration_seconds Latency of the invocations of each chaincode function.")
+	fmt.Fprintln(w, "# TYPE chaincode_invoke_duration_seconds histogram")
+	for _, name := range names {
+		f := m.functions[name]
+		var cumulative uint64
+		for i, le := range latencyBuckets {
+			cumulative += f.buckets[i]
+			fmt.Fprintf(w, "chaincode_invoke_duration_seconds_bucket{function=%q,le=\"%g\"} %d\n", name, le, cumulative)
+		}
+		fmt.Fprintf(w, "chaincode_invoke_duration_seconds_bucket{function=%q,le=\"+Inf\"} %d\n", name, f.invokes)
+		fmt.Fprintf(w, "chaincode_invoke_duration_seconds_sum{function=%q} %g\n", name, f.latencySum)
+		fmt.Fprintf(w, "chaincode_invoke_duration_seconds_count{function=%q} %d\n", name, f.invokes)
+	}
+	fmt.Fprintln(w, "# HELP chaincode_state_reads_total State reads of each chaincode function, by stub operation.")
+	fmt.Fprintln(w, "# TYPE chaincode_state_reads_total counter")
+	for _, name := range names {
+		writeOperations(w, "chaincode_state_reads_total", name, m.functions[name].stateReads)
+	}
+	fmt.Fprintln(w, "# HELP chaincode_state_writes_total State writes of each chaincode function, by stub operation.")
+	fmt.Fprintln(w, "# TYPE chaincode_state_writes_total counter")
+	for _, name := range names {
+		writeOperations(w, "chaincode_state_writes_total", name, m.functions[name].stateWrites)
+	}
+	fmt.Fprintln(w, "# HELP chaincode_invokes_in_flight Invocations currently running.")
+	fmt.Fprintln(w, "# TYPE chaincode_invokes_in_flight gauge")
+	fmt.Fprintf(w, "chaincode_invokes_in_flight %d\n", len(m.inFlight))
+}
+
+func writeOperations(w http.ResponseWriter, metric string, function string, counts map[string]uint64) {
+	operations := make([]string, 0, len(counts))
+	for operation := range counts {
+		operations = append(operations, operation)
+	}
+	sort.Strings(operations)
+	for _, operation := range operations {
+		fmt.Fprintf(w, "%s{function=%q,operation=%q} %d\n", metric, function, operation, counts[operation])
+	}
+}
+
+/* start records an invocation as running, returning its id and the metrics of its function */
+func (m *Monitor) start(function string) (uint64, *functionMetrics) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.functions[function]
+	if !ok {
+		f = m.functions[unknownFunction]
+	}
+	m.nextID++
+	m.inFlight[m.nextID] = m.now()
+	return m.nextID, f
+}
+
+func (m *Monitor) finish(id uint64, f *functionMetrics, status int32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	latency := m.now().Sub(m.inFlight[id]).Seconds()
+	delete(m.inFlight, id)
+
+	f.invokes++
+	if status >= shim.ERRORTHRESHOLD {
+		f.errors++
+	}
+	f.latencySum += latency
+	for i, le := range latencyBuckets {
+		if latency <= le {
+			f.buckets[i]++
+			break
+		}
+	}
+}
+
+func (m *Monitor) countState(f *functionMetrics, operation string, write bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if write {
+		f.stateWrites[operation]++
+	} else {
+		f.stateReads[operation]++
+	}
+}
+
+type instrumented struct {
+	cc      shim.Chaincode
+	monitor *Monitor
+}
+
+func (c *instrumented) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	return c.cc.Init(stub)
+}
+
+func (c *instrumented) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	function, _ := stub.GetFunctionAndParameters()
+	id, f := c.monitor.start(function)
+	status := int32(shim.ERRORTHRESHOLD)
+	// a panicking invocation counts as an error
+	defer func() { c.monitor.finish(id, f, status) }()
+
+	response := c.cc.Invoke(&countingStub{ChaincodeStubInterface: stub, monitor: c.monitor, function: f})
+	status = response.Status
+	return response
+}
+
+/* countingStub counts the state operations of an invocation */
+type countingStub struct {
+	shim.ChaincodeStubInterface
+	monitor  *Monitor
+	function *functionMetrics
+}
+
+func (s *countingStub) read(operation string) {
+	s.monitor.countState(s.function, operation, false)
+}
+
+func (s *countingStub) write(operation string) {
+	s.monitor.countState(s.function, operation, true)
+}
+
+func (s *countingStub) GetState(key string) ([]byte, error) {
+	s.read("GetState")
+	return s.ChaincodeStubInterface.GetState(key)
+}
+
+func (s *countingStub) GetStateByRange(startKey, endKey string) (shim.StateQueryIteratorInterface, error) {
+	s.read("GetStateByRange")
+	return s.ChaincodeStubInterface.GetStateByRange(startKey, endKey)
+}
+
+func (s *countingStub) GetStateByRangeWithPagination(startKey, endKey string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	s.read("GetStateByRangeWithPagination")
+	return s.ChaincodeStubInterface.GetStateByRangeWithPagination(startKey, endKey, pageSize, bookmark)
+}
+
+func (s *countingStub) GetStateByPartialCompositeKey(objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+	s.read("GetStateByPartialCompositeKey")
+	return s.ChaincodeStubInterface.GetStateByPartialCompositeKey(objectType, keys)
+}
+
+func (s *countingStub) GetStateByPartialCompositeKeyWithPagination(objectType string, keys []string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	s.read("GetStateByPartialCompositeKeyWithPagination")
+	return s.ChaincodeStubInterface.GetStateByPartialCompositeKeyWithPagination(objectType, keys, pageSize, bookmark)
+}
+
+func (s *countingStub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	s.read("GetQueryResult")
+	return s.ChaincodeStubInterface.GetQueryResult(query)
+}
+
+func (s *countingStub) GetQueryResultWithPagination(query string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	s.read("GetQueryResultWithPagination")
+	return s.ChaincodeStubInterface.GetQueryResultWithPagination(query, pageSize, bookmark)
+}
+
+func (s *countingStub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	s.read("GetHistoryForKey")
+	return s.ChaincodeStubInterface.GetHistoryForKey(key)
+}
+
+func (s *countingStub) GetPrivateData(collection, key string) ([]byte, error) {
+	s.read("GetPrivateData")
+	return s.ChaincodeStubInterface.GetPrivateData(collection, key)
+}
+
+func (s *countingStub) PutState(key string, value []byte) error {
+	s.write("PutState")
+	return s.ChaincodeStubInterface.PutState(key, value)
+}
+
+func (s *countingStub) DelState(key string) error {
+	s.write("DelState")
+	return s.ChaincodeStubInterface.DelState(key)
+}
+
+func (s *countingStub) PutPrivateData(collection string, key string, value []byte) error {
+	s.write("PutPrivateData")
+	return s.ChaincodeStubInterface.PutPrivateData(collection, key, value)
+}
+
+func (s *countingStub) DelPrivateData(collection, key string) error {
+	s.write("DelPrivateData")
+	return s.ChaincodeStubInterface.DelPrivateData(collection, key)
+}
@@ -0,0 +1,132 @@
+package monitor
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// testChaincode writes its argument in put, reads it back in get and fails in fail
+type testChaincode struct {
+	invoked func()
+}
+
+func (cc *testChaincode) Init(shim.ChaincodeStubInterface) pb.Response {
+	return shim.Success(nil)
+}
+
+func (cc *testChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	if cc.invoked != nil {
+		cc.invoked()
+	}
+	function, args := stub.GetFunctionAndParameters()
+	switch function {
+	case "put":
+		if err := stub.PutState("key", []byte(args[0])); err != nil {
+			return shim.Error(err.Error())
+		}
+		return shim.Success(nil)
+	case "get":
+		value, err := stub.GetState("key")
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		iterator, err := stub.GetStateByRange("", "")
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		iterator.Close()
+		return shim.Success(value)
+	}
+	return shim.Error("Invalid Smart Contract function name.")
+}
+
+func get(t *testing.T, handler http.Handler, path string) (int, string) {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", path, nil))
+	body, err := ioutil.ReadAll(recorder.Result().Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return recorder.Code, string(body)
+}
+
+func TestMetrics(t *testing.T) {
+	m := New([]string{"put", "get"})
+	stub := shimtest.NewMockStub("test", m.Instrument(&testChaincode{}))
+	stub.MockInvoke("tx1", [][]byte{[]byte("put"), []byte("value")})
+	stub.MockInvoke("tx2", [][]byte{[]byte("get")})
+	stub.MockInvoke("tx3", [][]byte{[]byte("get")})
+	stub.MockInvoke("tx4", [][]byte{[]byte("burn")})
+
+	status, body := get(t, m.Handler(), "/metrics")
+	if status != http.StatusOK {
+		t.Fatalf("/metrics returned %d", status)
+	}
+	for _, want := range []string{
+		`chaincode_invokes_total{function="get"} 2`,
+		`chaincode_invokes_total{function="put"} 1`,
+		`chaincode_invokes_total{function="unknown"} 1`,
+		`chaincode_invoke_errors_total{function="get"} 0`,
+		`chaincode_invoke_errors_total{function="unknown"} 1`,
+		`chaincode_invoke_duration_seconds_bucket{function="get",le="+Inf"} 2`,
+		`chaincode_invoke_duration_seconds_count{function="put"} 1`,
+		`chaincode_state_reads_total{function="get",operation="GetState"} 2`,
+		`chaincode_state_reads_total{function="get",operation="GetStateByRange"} 2`,
+		`chaincode_state_writes_total{function="put",operation="PutState"} 1`,
+		`chaincode_invokes_in_flight 0`,
+		`# TYPE chaincode_invoke_duration_seconds histogram`,
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("/metrics has no line %s", want)
+		}
+	}
+	if strings.Contains(body, `function="burn"`) {
+		t.Errorf("/metrics labels an unknown function by its name")
+	}
+}
+
+func TestHealthAndReadiness(t *testing.T) {
+	m := New([]string{"put"})
+	now := time.Now()
+	m.now = func() time.Time { return now }
+
+	if status, _ := get(t, m.Handler(), "/readyz"); status != http.StatusServiceUnavailable {
+		t.Errorf("/readyz returned %d before the chaincode is ready", status)
+	}
+	m.SetReady(true)
+	if status, _ := get(t, m.Handler(), "/readyz"); status != http.StatusOK {
+		t.Errorf("/readyz returned %d once the chaincode is ready", status)
+	}
+
+	// the invocation hangs for longer than the hang timeout while the probe runs
+	var healthz int
+	var body string
+	cc := &testChaincode{invoked: func() {
+		now = now.Add(m.HangTimeout + time.Second)
+		healthz, body = get(t, m.Handler(), "/healthz")
+	}}
+	shimtest.NewMockStub("test", m.Instrument(cc)).MockInvoke("tx1", [][]byte{[]byte("put"), []byte("value")})
+	if healthz != http.StatusServiceUnavailable || !strings.Contains(body, "running for 2m1s") {
+		t.Errorf("/healthz returned %d %q during a hung invocation", healthz, body)
+	}
+	if status, _ := get(t, m.Handler(), "/healthz"); status != http.StatusOK {
+		t.Errorf("/healthz returned %d once the invocation finished", status)
+	}
+}
+
+func TestNilMonitor(t *testing.T) {
+	var m *Monitor
+	cc := &testChaincode{}
+	if m.Instrument(cc) != shim.Chaincode(cc) {
+		t.Errorf("a nil monitor instruments the chaincode")
+	}
+	m.SetReady(true)
+}
@@ -0,0 +1,207 @@
+// Package router dispatches chaincode invocations to functions registered by name with an argument schema.
+//
+// The router does not depend on a fabric shim, so chaincode built on either shim can use it: Route
+// validates the arguments of an invocation and returns the registered function, whose Handler is of
+// the chaincode's own type. Arguments are positional, or a single JSON object naming them.
+//
+// Only the marbles chaincodes use it; the emissions chaincode gets its argument conversion and metadata
+// from fabric-contract-api-go instead.
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Type is the type of an argument. Arguments are always passed as strings; the type says how they must parse.
+type Type string
+
+const (
+	String  Type = "string"
+	Integer Type = "integer"
+	Number  Type = "number"
+	Boolean Type = "boolean"
+	JSON    Type = "json"
+)
+
+// Arg describes one argument of a function
+type Arg struct {
+	Name        string `json:"name"`
+	Type        Type   `json:"type"`
+	Required    bool   `json:"required"`
+	Description string `json:"description,omitempty"`
+}
+
+// Function is a registered chaincode function. Handler is not called by the router.
+type Function struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Args        []Arg       `json:"args"`
+	Handler     interface{} `json:"-"`
+}
+
+// Error is the error of an invocation the router rejected; its message is JSON so clients can parse it
+type Error struct {
+	Function string `json:"function"`
+	Argument string `json:"argument,omitempty"`
+	Message  string `json:"error"`
+}
+
+func (e *Error) Error() string {
+	errorAsBytes, err := json.Marshal(e)
+	if err != nil {
+		return e.Message
+	}
+	return string(errorAsBytes)
+}
+
+// Router holds the registered functions, in the order they were registered
+type Router struct {
+	functions map[string]*Function
+	order     []string
+}
+
+// New returns a router without functions
+func New() *Router {
+	return &Router{functions: map[string]*Function{}}
+}
+
+// Register adds a function. It panics if the name is taken or the schema is invalid, as registration happens at startup.
+func (r *Router) Register(f Function) {
+	if f.Name == "" {
+		panic("router: function without a name")
+	}
+	if _, ok := r.functions[f.Name]; ok {
+		panic("router: function registered twice: " + f.Name)
+	}
+	for _, arg := range f.Args {
+		switch arg.Type {
+		case String, Integer, Number, Boolean, JSON:
+		default:
+			panic(fmt.Sprintf("router: argument %s of %s has unknown type %q", arg.Name, f.Name, arg.Type))
+		}
+	}
+	if f.Args == nil {
+		f.Args = []Arg{}
+	}
+	r.functions[f.Name] = &f
+	r.order = append(r.order, f.Name)
+}
+
+// Functions returns the registered functions in registration order
+func (r *Router) Functions() []Function {
+	functions := make([]Function, 0, len(r.order))
+	for _, name := range r.order {
+		functions = append(functions, *r.functions[name])
+	}
+	return functions
+}
+
+// ListFunctions returns the registered functions and their arguments as JSON, for client tooling to discover the API
+func (r *Router) ListFunctions() ([]byte, error) {
+	return json.Marshal(r.Functions())
+}
+
+// Route finds the function and validates its arguments, returning one positional argument per
+// argument of the schema; omitted optional arguments are empty strings.
+func (r *Router) Route(name string, params []string) (*Function, []string, error) {
+	f, ok := r.functions[name]
+	if !ok {
+		return nil, nil, &Error{Function: name, Message: "unknown function"}
+	}
+
+	args := params
+	if named, ok := namedArgs(f, params); ok {
+		args = positionalArgs(f, named)
+	}
+	if len(args) > len(f.Args) {
+		return nil, nil, &Error{Function: name, Message: fmt.Sprintf("expects at most %d arguments, got %d", len(f.Args), len(args))}
+	}
+
+	for i, arg := range f.Args {
+		value := ""
+		if i < len(args) {
+			value = args[i]
+		}
+		if value == "" {
+			if arg.Required {
+				return nil, nil, &Error{Function: name, Argument: arg.Name, Message: "missing required argument"}
+			}
+			continue
+		}
+		if err := checkType(arg.Type, value); err != nil {
+			return nil, nil, &Error{Function: name, Argument: arg.Name, Message: err.Error()}
+		}
+	}
+	padded := make([]string, len(f.Args))
+	copy(padded, args)
+	return f, padded, nil
+}
+
+/* namedArgs reads a single JSON object argument whose keys are all argument names of the function; anything else stays positional */
+func namedArgs(f *Function, params []string) (map[string]json.RawMessage, bool) {
+	if len(params) != 1 || !strings.HasPrefix(strings.TrimSpace(params[0]), "{") {
+		return nil, false
+	}
+	named := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(params[0]), &named); err != nil || len(named) == 0 {
+		return nil, false
+	}
+	for key := range named {
+		if f.arg(key) == nil {
+			return nil, false
+		}
+	}
+	return named, true
+}
+
+func (f *Function) arg(name string) *Arg {
+	for i := range f.Args {
+		if f.Args[i].Name == name {
+			return &f.Args[i]
+		}
+	}
+	return nil
+}
+
+/* positionalArgs orders named arguments by the schema; strings are unquoted, other JSON values are passed as their JSON text */
+func positionalArgs(f *Function, named map[string]json.RawMessage) []string {
+	args := make([]string, len(f.Args))
+	for i, arg := range f.Args {
+		raw, ok := named[arg.Name]
+		if !ok || bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+			continue
+		}
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			value = string(bytes.TrimSpace(raw))
+		}
+		args[i] = value
+	}
+	return args
+}
+
+func checkType(argType Type, value string) error {
+	switch argType {
+	case Integer:
+		if _, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err != nil {
+			return fmt.Errorf("must be an integer, got %q", value)
+		}
+	case Number:
+		if _, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err != nil {
+			return fmt.Errorf("must be a number, got %q", value)
+		}
+	case Boolean:
+		if _, err := strconv.ParseBool(strings.TrimSpace(value)); err != nil {
+			return fmt.Errorf("must be true or false, got %q", value)
+		}
+	case JSON:
+		if !json.Valid([]byte(value)) {
+			return fmt.Errorf("must be JSON")
+		}
+	}
+	return nil
+}
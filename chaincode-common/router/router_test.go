@@ -0,0 +1,116 @@
+package router
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func newTestRouter() *Router {
+	r := New()
+	r.Register(Function{Name: "transfer", Args: []Arg{
+		{Name: "id", Type: String, Required: true},
+		{Name: "note", Type: String},
+		{Name: "amount", Type: Number, Required: true},
+		{Name: "limit", Type: Integer},
+		{Name: "force", Type: Boolean},
+	}})
+	r.Register(Function{Name: "setPolicy", Args: []Arg{{Name: "policy", Type: JSON, Required: true}}})
+	r.Register(Function{Name: "list"})
+	return r
+}
+
+func TestRoute(t *testing.T) {
+	r := newTestRouter()
+	tests := []struct {
+		name     string
+		function string
+		params   []string
+		want     []string
+		wantArg  string
+		wantErr  bool
+	}{
+		{"positional", "transfer", []string{"a", "", "1.5", "10", "true"}, []string{"a", "", "1.5", "10", "true"}, "", false},
+		{"trailing optional arguments are padded", "transfer", []string{"a", "", "2"}, []string{"a", "", "2", "", ""}, "", false},
+		{"named", "transfer", []string{`{"amount": 2.5, "id": "a", "force": false}`}, []string{"a", "", "2.5", "", "false"}, "", false},
+		{"named null is omitted", "transfer", []string{`{"id": "a", "amount": "3", "note": null}`}, []string{"a", "", "3", "", ""}, "", false},
+		{"missing required", "transfer", []string{"a"}, nil, "amount", true},
+		{"named missing required", "transfer", []string{`{"amount": 1}`}, nil, "id", true},
+		{"bad number", "transfer", []string{"a", "", "many"}, nil, "amount", true},
+		{"bad integer", "transfer", []string{"a", "", "1", "1.5"}, nil, "limit", true},
+		{"bad boolean", "transfer", []string{"a", "", "1", "", "yes"}, nil, "force", true},
+		{"too many arguments", "list", []string{"x"}, nil, "", true},
+		{"unknown function", "burn", nil, nil, "", true},
+		{"JSON argument stays positional", "setPolicy", []string{`{"functions": {}}`}, []string{`{"functions": {}}`}, "", false},
+		{"named JSON argument", "setPolicy", []string{`{"policy": {"functions": {}}}`}, []string{`{"functions": {}}`}, "", false},
+		{"invalid JSON", "setPolicy", []string{`{"functions"`}, nil, "policy", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, args, err := r.Route(tt.function, tt.params)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Route() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				routeErr, ok := err.(*Error)
+				if !ok || routeErr.Function != tt.function || routeErr.Argument != tt.wantArg {
+					t.Fatalf("Route() error = %v, want an Error of %s argument %q", err, tt.function, tt.wantArg)
+				}
+				return
+			}
+			if f.Name != tt.function || !reflect.DeepEqual(args, tt.want) {
+				t.Errorf("Route() = %s %q, want %s %q", f.Name, args, tt.function, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorIsJSON(t *testing.T) {
+	_, _, err := newTestRouter().Route("transfer", []string{"a"})
+	decoded := map[string]string{}
+	if jsonErr := json.Unmarshal([]byte(err.Error()), &decoded); jsonErr != nil {
+		t.Fatalf("error is not JSON: %s", err.Error())
+	}
+	if decoded["function"] != "transfer" || decoded["argument"] != "amount" || decoded["error"] != "missing required argument" {
+		t.Errorf("unexpected error %v", decoded)
+	}
+}
+
+func TestListFunctions(t *testing.T) {
+	listAsBytes, err := newTestRouter().ListFunctions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var functions []Function
+	if err := json.Unmarshal(listAsBytes, &functions); err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, f := range functions {
+		names = append(names, f.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"transfer", "setPolicy", "list"}) || len(functions[0].Args) != 5 || functions[2].Args == nil {
+		t.Errorf("unexpected functions %s", listAsBytes)
+	}
+}
+
+func TestRegisterPanics(t *testing.T) {
+	tests := []struct {
+		name string
+		f    Function
+	}{
+		{"duplicate", Function{Name: "list"}},
+		{"no name", Function{}},
+		{"unknown type", Function{Name: "bad", Args: []Arg{{Name: "x", Type: "date"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Register() did not panic")
+				}
+			}()
+			newTestRouter().Register(tt.f)
+		})
+	}
+}
@@ -1,12 +1,15 @@
 module github.com/marbles
-  
+
 go 1.12
 
 require (
-        github.com/hyperledger/fabric-chaincode-go v0.0.0-20200128192331-2d899240a7ed
-        github.com/hyperledger/fabric-protos-go v0.0.0-20200124220212-e9cfc186ba7b
-        golang.org/x/net v0.0.0-20200202094626-16171245cfb2 // indirect
-        golang.org/x/sys v0.0.0-20200212091648-12a6c2dcc1e4 // indirect
-        golang.org/x/text v0.3.2 // indirect
-        google.golang.org/genproto v0.0.0-20200218151345-dad8c97a84f5 // indirect
-)
\ No newline at end of file
+	chaincode-common v0.0.0
+	github.com/hyperledger/fabric-chaincode-go v0.0.0-20200128192331-2d899240a7ed
+	github.com/hyperledger/fabric-protos-go v0.0.0-20200124220212-e9cfc186ba7b
+	golang.org/x/net v0.0.0-20200202094626-16171245cfb2 // indirect
+	golang.org/x/sys v0.0.0-20200212091648-12a6c2dcc1e4 // indirect
+	golang.org/x/text v0.3.2 // indirect
+	google.golang.org/genproto v0.0.0-20200218151345-dad8c97a84f5 // indirect
+)
+
+replace chaincode-common => ../../../chaincode-common
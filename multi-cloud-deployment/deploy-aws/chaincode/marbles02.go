@@ -16,6 +16,8 @@
 // peer chaincode query -C myc1 -n marbles -c '{"Args":["readMarble","marble1"]}'
 // peer chaincode query -C myc1 -n marbles -c '{"Args":["getMarblesByRange","marble1","marble3"]}'
 // peer chaincode query -C myc1 -n marbles -c '{"Args":["getHistoryForMarble","marble1"]}'
+// peer chaincode query -C myc1 -n marbles -c '{"Args":["readMarble","{\"name\":\"marble1\"}"]}'
+// peer chaincode query -C myc1 -n marbles -c '{"Args":["listFunctions"]}'
 
 // Rich Query (Only supported if CouchDB is used as state database):
 // peer chaincode query -C myc1 -n marbles -c '{"Args":["queryMarblesByOwner","tom"]}'
@@ -90,6 +92,10 @@ import (
 
 	"github.com/hyperledger/fabric-chaincode-go/shim"
 	pb "github.com/hyperledger/fabric-protos-go/peer"
+	"chaincode-common/cclog"
+	"chaincode-common/ccserver"
+	"chaincode-common/monitor"
+	"chaincode-common/router"
 )
 
 // SimpleChaincode example simple Chaincode implementation
@@ -109,20 +115,35 @@ type marble struct {
 // ===================================================================================
 func main() {
 
-	server := &shim.ChaincodeServer{
-		CCID:    os.Getenv("CHAINCODE_CCID"),
-		Address: os.Getenv("CHAINCODE_ADDRESS"),
-		CC:      new(SimpleChaincode),
-		TLSProps: shim.TLSProperties{
-				Disabled: true,
-		},
+	// Health, readiness and metrics are served when CHAINCODE_MONITOR_ADDRESS is set, see the monitor package
+	names := []string{}
+	for _, f := range functions.Functions() {
+		names = append(names, f.Name)
+	}
+	mon, err := monitor.FromEnv(names)
+	if err != nil {
+		cclog.Error("Error configuring Marbles02 chaincode", "error", err)
+		os.Exit(1)
+	}
+
+	// Mutual TLS with the peer is configured from the environment, see the ccserver package
+	config, err := ccserver.ConfigFromEnv()
+	if err != nil {
+		cclog.Error("Error configuring Marbles02 chaincode", "error", err)
+		os.Exit(1)
+	}
+	server, err := ccserver.New(mon.Instrument(new(SimpleChaincode)), config)
+	if err != nil {
+		cclog.Error("Error configuring Marbles02 chaincode", "error", err)
+		os.Exit(1)
 	}
 
 	// Start the chaincode external server
-	err := server.Start()
+	mon.SetReady(true)
+	err = server.Start()
 
 	if err != nil {
-		fmt.Printf("Error starting Marbles02 chaincode: %s", err)
+		cclog.Error("Error starting Marbles02 chaincode", "error", err)
 	}
 }
 
@@ -136,35 +157,70 @@ func (t *SimpleChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
 // ========================================
 func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 	function, args := stub.GetFunctionAndParameters()
-	fmt.Println("invoke is running " + function)
+	logger := cclog.ForStub(stub)
+	logger.Debug("invoke is running")
 
 	// Handle different functions
-	if function == "initMarble" { //create a new marble
-		return t.initMarble(stub, args)
-	} else if function == "transferMarble" { //change owner of a specific marble
-		return t.transferMarble(stub, args)
-	} else if function == "transferMarblesBasedOnColor" { //transfer all marbles of a certain color
-		return t.transferMarblesBasedOnColor(stub, args)
-	} else if function == "delete" { //delete a marble
-		return t.delete(stub, args)
-	} else if function == "readMarble" { //read a marble
-		return t.readMarble(stub, args)
-	} else if function == "queryMarblesByOwner" { //find marbles for owner X using rich query
-		return t.queryMarblesByOwner(stub, args)
-	} else if function == "queryMarbles" { //find marbles based on an ad hoc rich query
-		return t.queryMarbles(stub, args)
-	} else if function == "getHistoryForMarble" { //get history of values for a marble
-		return t.getHistoryForMarble(stub, args)
-	} else if function == "getMarblesByRange" { //get marbles based on range query
-		return t.getMarblesByRange(stub, args)
-	} else if function == "getMarblesByRangeWithPagination" {
-		return t.getMarblesByRangeWithPagination(stub, args)
-	} else if function == "queryMarblesWithPagination" {
-		return t.queryMarblesWithPagination(stub, args)
-	}
-
-	fmt.Println("invoke did not find func: " + function) //error
-	return shim.Error("Received unknown function invocation")
+	f, args, err := functions.Route(function, args)
+	if err != nil {
+		logger.Warn("invoke rejected", "error", err)
+		return shim.Error(err.Error())
+	}
+	return f.Handler.(marblesFunction)(t, stub, args)
+}
+
+// marblesFunction is the handler type of the functions registered in the router
+type marblesFunction func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, args []string) pb.Response
+
+// functions routes the Invoke functions; assigned in init, as listFunctions reads it
+var functions *router.Router
+
+func init() {
+	functions = router.New()
+	register := func(name string, description string, handler marblesFunction, args ...router.Arg) {
+		functions.Register(router.Function{Name: name, Description: description, Args: args, Handler: handler})
+	}
+	required := func(name string, argType router.Type) router.Arg {
+		return router.Arg{Name: name, Type: argType, Required: true}
+	}
+	optional := func(name string, argType router.Type) router.Arg {
+		return router.Arg{Name: name, Type: argType}
+	}
+
+	register("listFunctions", "list the functions of the chaincode and their arguments", (*SimpleChaincode).listFunctions)
+	register("initMarble", "create a new marble", (*SimpleChaincode).initMarble,
+		required("name", router.String), required("color", router.String), required("size", router.Integer), required("owner", router.String))
+	register("transferMarble", "change owner of a specific marble", (*SimpleChaincode).transferMarble,
+		required("name", router.String), required("newOwner", router.String))
+	register("transferMarblesBasedOnColor", "transfer all marbles of a certain color", (*SimpleChaincode).transferMarblesBasedOnColor,
+		required("color", router.String), required("newOwner", router.String))
+	register("delete", "delete a marble", (*SimpleChaincode).delete,
+		required("name", router.String))
+	register("readMarble", "read a marble", (*SimpleChaincode).readMarble,
+		required("name", router.String))
+	register("queryMarblesByOwner", "find marbles for owner X using rich query", (*SimpleChaincode).queryMarblesByOwner,
+		required("owner", router.String))
+	register("queryMarbles", "find marbles based on an ad hoc rich query", (*SimpleChaincode).queryMarbles,
+		required("queryString", router.JSON))
+	register("getHistoryForMarble", "get history of values for a marble", (*SimpleChaincode).getHistoryForMarble,
+		required("name", router.String))
+	register("getMarblesByRange", "get marbles based on range query; an empty key leaves the range open", (*SimpleChaincode).getMarblesByRange,
+		optional("startKey", router.String), optional("endKey", router.String))
+	register("getMarblesByRangeWithPagination", "get a page of marbles based on range query", (*SimpleChaincode).getMarblesByRangeWithPagination,
+		optional("startKey", router.String), optional("endKey", router.String), required("pageSize", router.Integer), optional("bookmark", router.String))
+	register("queryMarblesWithPagination", "get a page of marbles based on an ad hoc rich query", (*SimpleChaincode).queryMarblesWithPagination,
+		required("queryString", router.JSON), required("pageSize", router.Integer), optional("bookmark", router.String))
+}
+
+// ===============================================================
+// listFunctions - list the functions and their arguments as JSON
+// ===============================================================
+func (t *SimpleChaincode) listFunctions(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	functionsAsBytes, err := functions.ListFunctions()
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(functionsAsBytes)
 }
 
 // ============================================================
@@ -180,7 +236,8 @@ func (t *SimpleChaincode) initMarble(stub shim.ChaincodeStubInterface, args []st
 	}
 
 	// ==== Input sanitation ====
-	fmt.Println("- start init marble")
+	logger := cclog.ForStub(stub)
+	logger.Debug("start init marble")
 	if len(args[0]) <= 0 {
 		return shim.Error("1st argument must be a non-empty string")
 	}
@@ -206,7 +263,7 @@ func (t *SimpleChaincode) initMarble(stub shim.ChaincodeStubInterface, args []st
 	if err != nil {
 		return shim.Error("Failed to get marble: " + err.Error())
 	} else if marbleAsBytes != nil {
-		fmt.Println("This marble already exists: " + marbleName)
+		logger.Debug("This marble already exists", "marble", marbleName)
 		return shim.Error("This marble already exists: " + marbleName)
 	}
 
@@ -243,7 +300,7 @@ func (t *SimpleChaincode) initMarble(stub shim.ChaincodeStubInterface, args []st
 	stub.PutState(colorNameIndexKey, value)
 
 	// ==== Marble saved and indexed. Return success ====
-	fmt.Println("- end init marble")
+	logger.Debug("end init marble", "marble", marbleName)
 	return shim.Success(nil)
 }
 
@@ -331,7 +388,8 @@ func (t *SimpleChaincode) transferMarble(stub shim.ChaincodeStubInterface, args
 
 	marbleName := args[0]
 	newOwner := strings.ToLower(args[1])
-	fmt.Println("- start transferMarble ", marbleName, newOwner)
+	logger := cclog.ForStub(stub).With("marble", marbleName, "newOwner", newOwner)
+	logger.Debug("start transferMarble")
 
 	marbleAsBytes, err := stub.GetState(marbleName)
 	if err != nil {
@@ -353,7 +411,7 @@ func (t *SimpleChaincode) transferMarble(stub shim.ChaincodeStubInterface, args
 		return shim.Error(err.Error())
 	}
 
-	fmt.Println("- end transferMarble (success)")
+	logger.Debug("end transferMarble (success)")
 	return shim.Success(nil)
 }
 
@@ -394,20 +452,25 @@ func constructQueryResponseFromIterator(resultsIterator shim.StateQueryIteratorI
 
 // ===========================================================================================
 // addPaginationMetadataToQueryResults adds QueryResponseMetadata, which contains pagination
-// info, to the constructed query results
+// info, to the constructed query results. The response is a single JSON object:
+// {"Results":[...], "ResponseMetadata":{"RecordsCount":"3", "Bookmark":"..."}}
 // ===========================================================================================
 func addPaginationMetadataToQueryResults(buffer *bytes.Buffer, responseMetadata *pb.QueryResponseMetadata) *bytes.Buffer {
-
-	buffer.WriteString("[{\"ResponseMetadata\":{\"RecordsCount\":")
-	buffer.WriteString("\"")
-	buffer.WriteString(fmt.Sprintf("%v", responseMetadata.FetchedRecordsCount))
-	buffer.WriteString("\"")
-	buffer.WriteString(", \"Bookmark\":")
-	buffer.WriteString("\"")
-	buffer.WriteString(responseMetadata.Bookmark)
-	buffer.WriteString("\"}}]")
-
-	return buffer
+	// the bookmark is opaque to the chaincode, so it is escaped rather than written as-is
+	bookmarkAsBytes, _ := json.Marshal(responseMetadata.Bookmark)
+
+	var bufferWithPaginationInfo bytes.Buffer
+	bufferWithPaginationInfo.WriteString("{\"Results\":")
+	bufferWithPaginationInfo.Write(buffer.Bytes())
+	bufferWithPaginationInfo.WriteString(", \"ResponseMetadata\":{\"RecordsCount\":")
+	bufferWithPaginationInfo.WriteString("\"")
+	bufferWithPaginationInfo.WriteString(fmt.Sprintf("%v", responseMetadata.FetchedRecordsCount))
+	bufferWithPaginationInfo.WriteString("\"")
+	bufferWithPaginationInfo.WriteString(", \"Bookmark\":")
+	bufferWithPaginationInfo.Write(bookmarkAsBytes)
+	bufferWithPaginationInfo.WriteString("}}")
+
+	return &bufferWithPaginationInfo
 }
 
 // ===========================================================================================
@@ -441,7 +504,7 @@ func (t *SimpleChaincode) getMarblesByRange(stub shim.ChaincodeStubInterface, ar
 		return shim.Error(err.Error())
 	}
 
-	fmt.Printf("- getMarblesByRange queryResult:\n%s\n", buffer.String())
+	cclog.ForStub(stub).Debug("getMarblesByRange queryResult", "result", cclog.Payload(buffer.Bytes()))
 
 	return shim.Success(buffer.Bytes())
 }
@@ -464,7 +527,8 @@ func (t *SimpleChaincode) transferMarblesBasedOnColor(stub shim.ChaincodeStubInt
 
 	color := args[0]
 	newOwner := strings.ToLower(args[1])
-	fmt.Println("- start transferMarblesBasedOnColor ", color, newOwner)
+	logger := cclog.ForStub(stub).With("color", color, "newOwner", newOwner)
+	logger.Debug("start transferMarblesBasedOnColor")
 
 	// Query the color~name index by color
 	// This will execute a key range query on all keys starting with 'color'
@@ -490,7 +554,7 @@ func (t *SimpleChaincode) transferMarblesBasedOnColor(stub shim.ChaincodeStubInt
 		}
 		returnedColor := compositeKeyParts[0]
 		returnedMarbleName := compositeKeyParts[1]
-		fmt.Printf("- found a marble from index:%s color:%s name:%s\n", objectType, returnedColor, returnedMarbleName)
+		logger.Debug("found a marble", "index", objectType, "marbleColor", returnedColor, "marble", returnedMarbleName)
 
 		// Now call the transfer function for the found marble.
 		// Re-use the same function that is used to transfer individual marbles
@@ -502,7 +566,7 @@ func (t *SimpleChaincode) transferMarblesBasedOnColor(stub shim.ChaincodeStubInt
 	}
 
 	responsePayload := fmt.Sprintf("Transferred %d %s marbles to %s", i, color, newOwner)
-	fmt.Println("- end transferMarblesBasedOnColor: " + responsePayload)
+	logger.Debug("end transferMarblesBasedOnColor", "transferred", i)
 	return shim.Success([]byte(responsePayload))
 }
 
@@ -574,7 +638,8 @@ func (t *SimpleChaincode) queryMarbles(stub shim.ChaincodeStubInterface, args []
 // =========================================================================================
 func getQueryResultForQueryString(stub shim.ChaincodeStubInterface, queryString string) ([]byte, error) {
 
-	fmt.Printf("- getQueryResultForQueryString queryString:\n%s\n", queryString)
+	logger := cclog.ForStub(stub)
+	logger.Debug("getQueryResultForQueryString", "queryString", cclog.Payload(queryString))
 
 	resultsIterator, err := stub.GetQueryResult(queryString)
 	if err != nil {
@@ -587,7 +652,7 @@ func getQueryResultForQueryString(stub shim.ChaincodeStubInterface, queryString
 		return nil, err
 	}
 
-	fmt.Printf("- getQueryResultForQueryString queryResult:\n%s\n", buffer.String())
+	logger.Debug("getQueryResultForQueryString queryResult", "result", cclog.Payload(buffer.Bytes()))
 
 	return buffer.Bytes(), nil
 }
@@ -639,9 +704,9 @@ func (t *SimpleChaincode) getMarblesByRangeWithPagination(stub shim.ChaincodeStu
 
 	bufferWithPaginationInfo := addPaginationMetadataToQueryResults(buffer, responseMetadata)
 
-	fmt.Printf("- getMarblesByRange queryResult:\n%s\n", bufferWithPaginationInfo.String())
+	cclog.ForStub(stub).Debug("getMarblesByRangeWithPagination queryResult", "result", cclog.Payload(bufferWithPaginationInfo.Bytes()))
 
-	return shim.Success(buffer.Bytes())
+	return shim.Success(bufferWithPaginationInfo.Bytes())
 }
 
 // ===== Example: Pagination with Ad hoc Rich Query ========================================================
@@ -682,7 +747,8 @@ func (t *SimpleChaincode) queryMarblesWithPagination(stub shim.ChaincodeStubInte
 // =========================================================================================
 func getQueryResultForQueryStringWithPagination(stub shim.ChaincodeStubInterface, queryString string, pageSize int32, bookmark string) ([]byte, error) {
 
-	fmt.Printf("- getQueryResultForQueryString queryString:\n%s\n", queryString)
+	logger := cclog.ForStub(stub)
+	logger.Debug("getQueryResultForQueryStringWithPagination", "queryString", cclog.Payload(queryString))
 
 	resultsIterator, responseMetadata, err := stub.GetQueryResultWithPagination(queryString, pageSize, bookmark)
 	if err != nil {
@@ -697,9 +763,9 @@ func getQueryResultForQueryStringWithPagination(stub shim.ChaincodeStubInterface
 
 	bufferWithPaginationInfo := addPaginationMetadataToQueryResults(buffer, responseMetadata)
 
-	fmt.Printf("- getQueryResultForQueryString queryResult:\n%s\n", bufferWithPaginationInfo.String())
+	logger.Debug("getQueryResultForQueryStringWithPagination queryResult", "result", cclog.Payload(bufferWithPaginationInfo.Bytes()))
 
-	return buffer.Bytes(), nil
+	return bufferWithPaginationInfo.Bytes(), nil
 }
 
 func (t *SimpleChaincode) getHistoryForMarble(stub shim.ChaincodeStubInterface, args []string) pb.Response {
@@ -710,7 +776,8 @@ func (t *SimpleChaincode) getHistoryForMarble(stub shim.ChaincodeStubInterface,
 
 	marbleName := args[0]
 
-	fmt.Printf("- start getHistoryForMarble: %s\n", marbleName)
+	logger := cclog.ForStub(stub).With("marble", marbleName)
+	logger.Debug("start getHistoryForMarble")
 
 	resultsIterator, err := stub.GetHistoryForKey(marbleName)
 	if err != nil {
@@ -762,7 +829,7 @@ func (t *SimpleChaincode) getHistoryForMarble(stub shim.ChaincodeStubInterface,
 	}
 	buffer.WriteString("]")
 
-	fmt.Printf("- getHistoryForMarble returning:\n%s\n", buffer.String())
+	logger.Debug("getHistoryForMarble returning", "result", cclog.Payload(buffer.Bytes()))
 
 	return shim.Success(buffer.Bytes())
 }
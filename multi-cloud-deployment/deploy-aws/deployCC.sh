@@ -5,7 +5,7 @@
 
 # Change CC_PACKAGE_ID according to your output from `peer lifecycle chaincode queryinstalled`
 echo "+++++Export chaincode package identifier+++++"
-export CC_PACKAGE_ID=utilityemissions:0ee431100d9b7ab740c0e72ec86db561b052fd1b9b1e47de198bbabd0954ee97
+export CC_PACKAGE_ID=utilityemissions:df340f4f90a06531dd8084a3f89814497c6c96e8b53ed95deb1c98a19e17d569
 echo $CC_PACKAGE_ID
 
 #export CHAINCODE_NAME=marbles
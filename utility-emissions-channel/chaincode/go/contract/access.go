@@ -0,0 +1,250 @@
+// Role based access control of the emissions chaincode functions in Golang
+
+package contract
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+/* roles are read from the "role" attribute of the client X.509 certificate; it may hold several roles separated by commas */
+const (
+	roleAttribute   = "role"
+	roleAdmin       = "admin"
+	roleAuditor     = "auditor"
+	roleFactorAdmin = "factor_admin"
+)
+
+/* class of the access policy; it is stored under the composite key of the class with no attributes, which no caller supplied id can be as ids must not contain U+0000 */
+const accessPolicyClass = "org.hyperledger.blockchain-carbon-accounting.accesspolicy"
+
+/* status of a denied call; fabric treats any status from 400 as an error */
+const statusForbidden = 403
+
+// AccessRule says who may call a function. An empty Roles or MSPs allows any role or any MSP.
+type AccessRule struct {
+	Roles []string `json:"roles"`
+	MSPs  []string `json:"msps,omitempty" metadata:",optional"`
+}
+
+// AccessPolicy maps function names to the rule of who may call them
+type AccessPolicy struct {
+	Class     string                `json:"class" metadata:",optional"`
+	Functions map[string]AccessRule `json:"functions"`
+}
+
+// AccessDenied is the message of a denied call, as JSON
+type AccessDenied struct {
+	Error    string     `json:"error"`
+	Function string     `json:"function"`
+	MSPID    string     `json:"mspId"`
+	Roles    []string   `json:"roles"`
+	Required AccessRule `json:"required"`
+}
+
+/* defaultAccessPolicy declares the roles of every Invoke function; a stored policy overrides it function by function */
+func defaultAccessPolicy() AccessPolicy {
+	open := AccessRule{Roles: []string{}}
+	return AccessPolicy{Class: accessPolicyClass, Functions: map[string]AccessRule{
+		getMetadataFunction:                      open,
+		"initLedger":                             {Roles: []string{roleAdmin}},
+		"setAccessPolicy":                        {Roles: []string{roleAdmin}},
+		"getAccessPolicy":                        open,
+		"createEmissionRecord":                   {Roles: []string{roleAuditor}},
+		"recordEmissions":                        {Roles: []string{roleAuditor}},
+		"recordFuelEmissions":                    {Roles: []string{roleAuditor}},
+		"recordVehicleEmissions":                 {Roles: []string{roleAuditor}},
+		"recordSpendEmissions":                   {Roles: []string{roleAuditor}},
+		"recordActivityEmissions":                {Roles: []string{roleAuditor}},
+		"recordSupplierEmissions":                {Roles: []string{roleAuditor}},
+		"getEmissionRecord":                      open,
+		"compEmissionAmount":                     open,
+		"getHistory":                             open,
+		"getAllEmissionsData":                    open,
+		"getAllEmissionsDataByDateRange":         open,
+		"getAllEmissionsDataByDateRangeAndParty": open,
+		"getEmissionsTotals":                     open,
+		"tokenizeEmissionsRecords":               {Roles: []string{roleAuditor}},
+		"getEmissionsRecordsByToken":             open,
+		"registerInstrument":                     {Roles: []string{roleAuditor}},
+		"retireInstrument":                       {Roles: []string{roleAuditor}},
+		"getInstrument":                          open,
+		"getInstrumentsByParty":                  open,
+		"importUtilityFactor":                    {Roles: []string{roleFactorAdmin}},
+		"updateUtilityFactor":                    {Roles: []string{roleFactorAdmin}},
+		"importUtilityFactorsBatch":              {Roles: []string{roleFactorAdmin}},
+		"importGWPSet":                           {Roles: []string{roleFactorAdmin}},
+		"initGWPSets":                            {Roles: []string{roleFactorAdmin}},
+		"getGWPSet":                              open,
+		"getAllGWPSets":                          open,
+		"importFuelFactor":                       {Roles: []string{roleFactorAdmin}},
+		"updateFuelFactor":                       {Roles: []string{roleFactorAdmin}},
+		"initFuelFactors":                        {Roles: []string{roleFactorAdmin}},
+		"getFuelFactor":                          open,
+		"getFuelFactors":                         open,
+		"importScope3Factor":                     {Roles: []string{roleFactorAdmin}},
+		"updateScope3Factor":                     {Roles: []string{roleFactorAdmin}},
+		"getScope3Factor":                        open,
+		"getScope3Factors":                       open,
+		"getUtilityFactor":                       open,
+		"getUtilityFactorsByDivision":            open,
+		"importUtilityIdentifier":                {Roles: []string{roleFactorAdmin}},
+		"updateUtilityIdentifier":                {Roles: []string{roleFactorAdmin}},
+		"getUtilityIdentifier":                   open,
+		"getAllUtilityIdentifiers":               open,
+	}}
+}
+
+/* accessPolicyKey is the ledger key of the access policy set with setAccessPolicy */
+func accessPolicyKey(APIstub shim.ChaincodeStubInterface) (string, error) {
+	return APIstub.CreateCompositeKey(accessPolicyClass, []string{})
+}
+
+/* getAccessPolicy reads the effective policy: the defaults with the rules of the stored policy applied over them */
+func getAccessPolicy(APIstub shim.ChaincodeStubInterface) (AccessPolicy, error) {
+	policy := defaultAccessPolicy()
+	key, err := accessPolicyKey(APIstub)
+	if err != nil {
+		return policy, err
+	}
+	policyAsBytes, err := APIstub.GetState(key)
+	if err != nil {
+		return policy, fmt.Errorf("Failed to get access policy: %s", err.Error())
+	} else if policyAsBytes == nil {
+		return policy, nil
+	}
+
+	stored := AccessPolicy{}
+	if err := json.Unmarshal(policyAsBytes, &stored); err != nil {
+		return policy, fmt.Errorf("Failed to decode access policy: %s", err.Error())
+	} else if stored.Class != accessPolicyClass {
+		return policy, fmt.Errorf("The access policy key holds a document of class %q", stored.Class)
+	}
+	for function, rule := range stored.Functions {
+		policy.Functions[function] = rule
+	}
+	return policy, nil
+}
+
+/* callerRoles reads the MSP id and the roles of the client that submitted the transaction */
+func callerRoles(APIstub shim.ChaincodeStubInterface) (string, []string, error) {
+	mspID, err := cid.GetMSPID(APIstub)
+	if err != nil {
+		return "", nil, err
+	}
+	value, found, err := cid.GetAttributeValue(APIstub, roleAttribute)
+	if err != nil {
+		return mspID, nil, err
+	}
+	roles := []string{}
+	if found {
+		for _, role := range strings.Split(value, ",") {
+			if role = strings.TrimSpace(role); role != "" {
+				roles = append(roles, role)
+			}
+		}
+	}
+	return mspID, roles, nil
+}
+
+/* allows checks the caller against the rule */
+func (rule AccessRule) allows(mspID string, roles []string) bool {
+	if len(rule.MSPs) > 0 && !containsString(rule.MSPs, mspID) {
+		return false
+	}
+	if len(rule.Roles) == 0 {
+		return true
+	}
+	for _, role := range roles {
+		if containsString(rule.Roles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+/* authorize checks that the caller may invoke the function, returning the response to send back if not; functions without a rule are denied */
+func authorize(APIstub shim.ChaincodeStubInterface, function string) (pb.Response, bool) {
+	policy, err := getAccessPolicy(APIstub)
+	if err != nil {
+		return shim.Error(err.Error()), false
+	}
+	rule, ok := policy.Functions[function]
+
+	denied := AccessDenied{Error: "access denied", Function: function, Required: rule}
+	mspID, roles, err := callerRoles(APIstub)
+	denied.MSPID, denied.Roles = mspID, roles
+	if !ok {
+		denied.Error = "access denied: the function has no access rule"
+	} else if err != nil {
+		denied.Error = "access denied: cannot read the client identity: " + err.Error()
+	} else if rule.allows(mspID, roles) {
+		return pb.Response{}, true
+	}
+
+	deniedAsBytes, err := json.Marshal(denied)
+	if err != nil {
+		return shim.Error(err.Error()), false
+	}
+	return pb.Response{Status: statusForbidden, Message: string(deniedAsBytes)}, false
+}
+
+/* Query the effective access policy */
+
+func (s *EmissionsContract) GetAccessPolicy(ctx contractapi.TransactionContextInterface) (*AccessPolicy, error) {
+	policy, err := getAccessPolicy(ctx.GetStub())
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+/* Store the access policy; its rules override the default rules of the functions they name */
+
+func (s *EmissionsContract) SetAccessPolicy(ctx contractapi.TransactionContextInterface, policy AccessPolicy) (*AccessPolicy, error) {
+	APIstub := ctx.GetStub()
+	known := defaultAccessPolicy().Functions
+	unknown := []string{}
+	for function, rule := range policy.Functions {
+		if _, ok := known[function]; !ok {
+			unknown = append(unknown, function)
+		}
+		if rule.Roles == nil {
+			return nil, fmt.Errorf("Access rule of %s must list its roles, [] for any role", function)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("Access policy names unknown functions: %s", strings.Join(unknown, ", "))
+	}
+
+	policy.Class = accessPolicyClass
+	policyAsBytes, err := json.Marshal(policy)
+	if err != nil {
+		return nil, err
+	}
+	key, err := accessPolicyKey(APIstub)
+	if err != nil {
+		return nil, err
+	}
+	if err := APIstub.PutState(key, policyAsBytes); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
@@ -0,0 +1,109 @@
+package contract
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+func TestAuthorize(t *testing.T) {
+	stub := newTestStub(t)
+	factorArgs := []string{`{"utilityID":"USA_2018_STATE_CA","year":"2018","country":"USA","divisionType":"STATE","divisionId":"CA","divisionName":"California","netGeneration":195212860,"netGenerationUOM":"MWH","CO2EquivalentEmissions":49628215,"emissionsUOM":"short tons"}`}
+
+	tests := []struct {
+		name     string
+		mspID    string
+		roles    string
+		function string
+		args     []string
+		wantOK   bool
+	}{
+		{"factor admin imports a factor", "Org1MSP", "factor_admin", "importUtilityFactor", factorArgs, true},
+		{"auditor cannot update a factor", "Org1MSP", "auditor", "updateUtilityFactor", factorArgs, false},
+		{"any client reads a factor", "Org2MSP", "", "getUtilityFactor", []string{"USA_2018_STATE_CA"}, true},
+		{"client without role cannot init the ledger", "Org1MSP", "", "initLedger", nil, false},
+		{"factor admin cannot set the policy", "Org1MSP", "factor_admin", "setAccessPolicy", []string{`{"functions": {}}`}, false},
+		{"admin restricts reads to Org2MSP", "Org1MSP", "admin", "setAccessPolicy", []string{`{"functions": {"getUtilityFactor": {"roles": [], "msps": ["Org2MSP"]}}}`}, true},
+		{"Org1MSP can no longer read a factor", "Org1MSP", "auditor", "getUtilityFactor", []string{"USA_2018_STATE_CA"}, false},
+		{"Org2MSP still reads a factor", "Org2MSP", "", "getUtilityFactor", []string{"USA_2018_STATE_CA"}, true},
+		{"policy cannot name unknown functions", "Org1MSP", "admin", "setAccessPolicy", []string{`{"functions": {"deleteEverything": {"roles": []}}}`}, false},
+		{"unknown functions are denied", "Org1MSP", "admin", "deleteEverything", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := stub.SetIdentity(tt.mspID, map[string]string{"role": tt.roles}); err != nil {
+				t.Fatal(err)
+			}
+			response := stub.MockInvoke("tx-"+tt.function, toByteArgs(tt.function, tt.args...))
+			if gotOK := response.Status == shim.OK; gotOK != tt.wantOK {
+				t.Fatalf("%s returned %d %s, want ok %v", tt.function, response.Status, response.Message, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestAuthorizeDeniedMessage(t *testing.T) {
+	stub := newTestStub(t)
+	if err := stub.SetIdentity("Org2MSP", map[string]string{"role": "auditor, viewer"}); err != nil {
+		t.Fatal(err)
+	}
+
+	response := stub.MockInvoke("tx-1", toByteArgs("importUtilityIdentifier", `{"uuid":"USA_EIA_1","year":"2019","utility_number":"1","utility_name":"Utility","country":"USA","state_province":"CA"}`))
+	if response.Status != statusForbidden {
+		t.Fatalf("got status %d, want %d", response.Status, statusForbidden)
+	}
+	denied := AccessDenied{}
+	if err := json.Unmarshal([]byte(response.Message), &denied); err != nil {
+		t.Fatalf("message is not an AccessDenied: %s", response.Message)
+	}
+	if denied.Function != "importUtilityIdentifier" || denied.MSPID != "Org2MSP" || len(denied.Roles) != 2 || denied.Required.Roles[0] != roleFactorAdmin {
+		t.Errorf("unexpected denial %+v", denied)
+	}
+}
+
+func TestAccessPolicyKey(t *testing.T) {
+	stub := newTestStub(t)
+	mustInvoke(t, stub, "setAccessPolicy", `{"functions": {"getUtilityFactor": {"roles": [], "msps": ["Org2MSP"]}}}`)
+	stub.MockTransactionStart("tx")
+	key, err := accessPolicyKey(stub)
+	stub.MockTransactionEnd("tx")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// no id a caller can supply is the key of the policy
+	factorArgs := func(utilityID string) []string {
+		return []string{utilityFactorJSON(utilityID, "2018", "STATE", "CA", 50, "")}
+	}
+	mustInvoke(t, stub, "importUtilityFactor", factorArgs(accessPolicyClass)...)
+	mustInvoke(t, stub, "updateUtilityFactor", factorArgs(accessPolicyClass)...)
+	mustInvoke(t, stub, "createEmissionRecord", calcInputJSON(accessPolicyClass, "MyCompany", "2020-01-01", "2020-01-31", 1650, "KWH"), "0.6328", "TONS", "430", "1220", "", "", "")
+	for _, function := range []string{"importUtilityFactor", "updateUtilityFactor"} {
+		if response := stub.MockInvoke("tx", toByteArgs(function, factorArgs(key)...)); response.Status == shim.OK {
+			t.Errorf("%s of the policy key succeeded", function)
+		}
+	}
+	report := BatchReport{}
+	if err := json.Unmarshal(mustInvoke(t, stub, "importUtilityFactorsBatch", "["+utilityFactorJSON(key, "2018", "STATE", "CA", 1, "")+"]"), &report); err != nil || report.Written != 0 {
+		t.Errorf("batch import of the policy key returned %+v, %v", report, err)
+	}
+
+	policy := AccessPolicy{}
+	if err := json.Unmarshal(mustInvoke(t, stub, "getAccessPolicy"), &policy); err != nil {
+		t.Fatal(err)
+	}
+	if rule := policy.Functions["getUtilityFactor"]; policy.Class != accessPolicyClass || len(rule.MSPs) != 1 || rule.MSPs[0] != "Org2MSP" {
+		t.Errorf("got policy %+v", policy)
+	}
+
+	// a policy key holding anything else is an error rather than no policy
+	stub.MockTransactionStart("tx")
+	if err := stub.PutState(key, []byte(`{"functions": {}}`)); err != nil {
+		t.Fatal(err)
+	}
+	stub.MockTransactionEnd("tx")
+	if response := stub.MockInvoke("tx", toByteArgs("getAccessPolicy")); response.Status == shim.OK {
+		t.Errorf("getAccessPolicy of a classless document returned %s", response.Payload)
+	}
+}
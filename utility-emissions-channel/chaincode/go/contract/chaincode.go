@@ -0,0 +1,65 @@
+// Chaincode of the emissions contract in Golang
+
+package contract
+
+import (
+	"sort"
+
+	"chaincode-common/cclog"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+/* name of the function of the system contract that returns the contract metadata */
+const getMetadataFunction = "org.hyperledger.fabric:GetMetadata"
+
+// emissionsChaincode checks the access policy and logs each invocation around the contract API chaincode,
+// which converts the arguments to the parameters of the transaction functions and serializes their results
+type emissionsChaincode struct {
+	contract *contractapi.ContractChaincode
+}
+
+// NewChaincode builds the chaincode of the emissions contract; its metadata is generated from the transaction functions
+func NewChaincode() (shim.Chaincode, error) {
+	contract, err := contractapi.NewChaincode(new(EmissionsContract))
+	if err != nil {
+		return nil, err
+	}
+	return &emissionsChaincode{contract: contract}, nil
+}
+
+/* The Init Method is called when the chaincode is instiated by the BC */
+func (c *emissionsChaincode) Init(APIstub shim.ChaincodeStubInterface) pb.Response {
+	return shim.Success(nil)
+}
+
+/* Invoke checks the caller may invoke the function, then calls its transaction function */
+func (c *emissionsChaincode) Invoke(APIstub shim.ChaincodeStubInterface) pb.Response {
+	function, _ := APIstub.GetFunctionAndParameters()
+	logger := cclog.ForStub(APIstub)
+
+	// Check the caller may invoke the function
+	if response, ok := authorize(APIstub, function); !ok {
+		logger.Warn("invoke denied", "status", response.Status, "error", response.Message)
+		return response
+	}
+
+	response := c.contract.Invoke(APIstub)
+	if response.Status >= shim.ERRORTHRESHOLD {
+		logger.Warn("invoke failed", "status", response.Status, "error", response.Message)
+	} else {
+		logger.Debug("invoke succeeded", "status", response.Status, "payload", cclog.Payload(response.Payload))
+	}
+	return response
+}
+
+// FunctionNames returns the names the functions of the chaincode are invoked by, e.g. to label its metrics
+func FunctionNames() []string {
+	names := []string{}
+	for name := range defaultAccessPolicy().Functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
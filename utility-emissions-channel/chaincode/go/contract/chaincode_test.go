@@ -0,0 +1,40 @@
+package contract
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/metadata"
+)
+
+func TestMetadataMatchesAccessPolicy(t *testing.T) {
+	stub := newTestStub(t)
+	if err := stub.SetIdentity("Org2MSP", map[string]string{"role": ""}); err != nil {
+		t.Fatal(err)
+	}
+	contractMetadata := metadata.ContractChaincodeMetadata{}
+	if err := json.Unmarshal(mustInvoke(t, stub, getMetadataFunction), &contractMetadata); err != nil {
+		t.Fatal(err)
+	}
+	contract, ok := contractMetadata.Contracts["EmissionsContract"]
+	if !ok {
+		t.Fatalf("no metadata of EmissionsContract in %+v", contractMetadata.Contracts)
+	}
+
+	// every transaction is invoked by its lower camel case name, which has an access rule, and every rule names a transaction
+	policy := defaultAccessPolicy()
+	transactions := map[string]bool{getMetadataFunction: true}
+	for _, transaction := range contract.Transactions {
+		name := strings.ToLower(transaction.Name[:1]) + transaction.Name[1:]
+		transactions[name] = true
+		if _, ok := policy.Functions[name]; !ok {
+			t.Errorf("transaction %s has no access rule under %s", transaction.Name, name)
+		}
+	}
+	for name := range policy.Functions {
+		if !transactions[name] {
+			t.Errorf("the access rule of %s names no transaction", name)
+		}
+	}
+}
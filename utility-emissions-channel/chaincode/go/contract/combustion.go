@@ -0,0 +1,214 @@
+// Scope 1 combustion emissions in Golang
+
+package contract
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// combustionInput is the input of a Scope 1 record: the fuel a source burnt over a period, as a quantity of fuel or,
+// with a vehicle type, as the distance the vehicle drove
+type combustionInput struct {
+	SourceID    string
+	PartyID     string
+	FromDate    string
+	ThruDate    string
+	Category    string
+	FuelType    string
+	VehicleType string
+	Quantity    float64
+	QuantityUom string
+}
+
+/* combustionRecordID is the deterministic key of a Scope 1 record: the MD5 of its source and fuel, party and period, so recording the fuel of a source again replaces its record */
+func combustionRecordID(sourceID string, fuelType string, partyID string, fromDate string, thruDate string) string {
+	return emissionsRecordID(sourceID+"~"+fuelType, partyID, fromDate, thruDate)
+}
+
+/* getFuelEmissions computes the emissions of a quantity of fuel, or of a distance with a vehicle factor, in exact arithmetic; a quantity of fuel other than energy is converted with the heat content of the factor, and the energy of the fuel is the nonrenewable energy use of the result */
+func getFuelEmissions(factor *FuelEmissionsFactor, quantity float64, quantityUom string, gwp *GWPSet) (*CO2Emissions, error) {
+	quantityRat, err := ratFromFloat(quantity)
+	if err != nil {
+		return nil, err
+	}
+	basisUom := factor.basisUom()
+	basisDimensions, err := uomDimensions(basisUom)
+	if err != nil {
+		return nil, err
+	}
+	quantityDimensions, err := uomDimensions(quantityUom)
+	if err != nil {
+		return nil, err
+	}
+
+	// the quantity in the energy or distance unit of the factor
+	var basis *big.Rat
+	if quantityDimensions == basisDimensions {
+		if basis, err = convertRat(quantityRat, quantityUom, basisUom); err != nil {
+			return nil, err
+		}
+	} else if basisDimensions == uomDimensionEnergy && factor.HeatContent != 0 && (quantityDimensions == uomDimensionVolume || quantityDimensions == uomDimensionMass) {
+		heatContent, err := ratFromFloat(factor.HeatContent)
+		if err != nil {
+			return nil, err
+		}
+		rate, err := convertRat(heatContent, factor.HeatContentUom, basisUom+"/"+quantityUom)
+		if err != nil {
+			return nil, err
+		}
+		basis = rate.Mul(rate, quantityRat)
+	} else {
+		return nil, fmt.Errorf("fuel emissions factor %s cannot apply to %s, expected %s or a quantity of fuel", factor.ID, quantityUom, basisDimensions)
+	}
+
+	// the tons emitted for the quantity, of an amount the factor emits per unit of energy or distance; e.g. KG/MMBTU times MMBTU converted to tons
+	massUom := factor.EmissionsUom[:strings.Index(factor.EmissionsUom, "/")]
+	emitted := func(amount float64) (*big.Rat, error) {
+		amountRat, err := ratFromFloat(amount)
+		if err != nil {
+			return nil, err
+		}
+		return convertRat(amountRat.Mul(amountRat, basis), massUom, emissionsUomTons)
+	}
+
+	co2Emissions := &CO2Emissions{
+		EmissionsUom: emissionsUomTons,
+		Year:         factor.Year,
+	}
+	if err := weighEmissions(co2Emissions, factor.ID, factor.CO2EquivalentEmissions, factor.GasEmissions, gwp, emitted); err != nil {
+		return nil, err
+	}
+	if basisDimensions == uomDimensionEnergy {
+		co2Emissions.NonrenewableEnergyUseAmount, _ = basis.Float64()
+	}
+	return co2Emissions, nil
+}
+
+/* getRecordFuelEmissions computes the emissions of a Scope 1 record again, with the factor of its fuel for its reporting year */
+func getRecordFuelEmissions(APIstub shim.ChaincodeStubInterface, record *EmissionsRecord, gwp *GWPSet) (*CO2Emissions, error) {
+	recordPeriod, err := record.period()
+	if err != nil {
+		return nil, err
+	}
+	factor, err := getFuelFactorForYear(APIstub, record.FuelType, record.VehicleType, recordPeriod.reportingYear())
+	if err != nil {
+		return nil, err
+	}
+	return getFuelEmissions(factor, record.ActivityAmount, record.ActivityUom, gwp)
+}
+
+/* newCombustionRecord computes a Scope 1 record with the factor of its fuel, or of its vehicle type if it has one, for its reporting year */
+func newCombustionRecord(APIstub shim.ChaincodeStubInterface, input combustionInput, gwpSetID string) (*EmissionsRecord, error) {
+	input.FuelType = normalizeFuelType(input.FuelType)
+	input.VehicleType = strings.TrimSpace(input.VehicleType)
+	if err := checkFuelType(input.FuelType); err != nil {
+		return nil, err
+	}
+	recordPeriod, err := parsePeriod(input.FromDate, input.ThruDate)
+	if err != nil {
+		return nil, err
+	}
+
+	factor, err := getFuelFactorForYear(APIstub, input.FuelType, input.VehicleType, recordPeriod.reportingYear())
+	if err != nil {
+		return nil, err
+	}
+	gwp, err := selectGWPSet(APIstub, gwpSetID)
+	if err != nil {
+		return nil, err
+	}
+	co2Emissions, err := getFuelEmissions(factor, input.Quantity, input.QuantityUom, gwp)
+	if err != nil {
+		return nil, err
+	}
+
+	record := &EmissionsRecord{
+		Class:                       emissionsRecordClass,
+		Version:                     emissionsRecordVersion,
+		UUID:                        combustionRecordID(input.SourceID, input.FuelType, input.PartyID, input.FromDate, input.ThruDate),
+		UtilityID:                   input.SourceID,
+		PartyID:                     input.PartyID,
+		FromDate:                    input.FromDate,
+		ThruDate:                    input.ThruDate,
+		EmissionsAmount:             co2Emissions.EmissionsAmount,
+		EmissionsUom:                co2Emissions.EmissionsUom,
+		NonrenewableEnergyUseAmount: co2Emissions.NonrenewableEnergyUseAmount,
+		FactorSource:                factor.ID,
+		GasEmissions:                co2Emissions.GasEmissions,
+		GWPSet:                      co2Emissions.GWPSet,
+		Scope:                       emissionsScope1,
+		Category:                    input.Category,
+		FuelType:                    input.FuelType,
+		VehicleType:                 input.VehicleType,
+		ActivityAmount:              input.Quantity,
+		ActivityUom:                 input.QuantityUom,
+	}
+	// the fuel is all nonrenewable energy
+	if co2Emissions.NonrenewableEnergyUseAmount != 0 {
+		record.EnergyUseAmount = co2Emissions.NonrenewableEnergyUseAmount
+		record.EnergyUseUom = factor.basisUom()
+	}
+	return record, nil
+}
+
+/* putCombustionRecord sets the document fields and the submitter of a Scope 1 or Scope 3 record and writes it */
+func putCombustionRecord(APIstub shim.ChaincodeStubInterface, record *EmissionsRecord, url string, md5 string) (*EmissionsRecord, error) {
+	var err error
+	record.URL = url
+	record.MD5 = md5
+	record.SubmittedBy, err = submittingMSP(APIstub)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := putEmissionsRecord(APIstub, record.UUID, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+/* Record the Scope 1 emissions of the fuel a source of a party burnt; the category is stationary combustion if empty, and an empty gwpSet selects the default set */
+
+func (s *EmissionsContract) RecordFuelEmissions(ctx contractapi.TransactionContextInterface, sourceId string, partyId string, fromDate string, thruDate string,
+	fuelType string, quantity float64, quantityUom string, url string, md5 string, category string, gwpSet string) (*EmissionsRecord, error) {
+	APIstub := ctx.GetStub()
+	normalizedCategory := strings.ToUpper(strings.TrimSpace(category))
+	switch normalizedCategory {
+	case "":
+		normalizedCategory = categoryStationaryCombustion
+	case categoryStationaryCombustion, categoryMobileCombustion:
+	default:
+		return nil, fmt.Errorf("category must be %s or %s, got %q", categoryStationaryCombustion, categoryMobileCombustion, category)
+	}
+	input := combustionInput{SourceID: sourceId, PartyID: partyId, FromDate: fromDate, ThruDate: thruDate, Category: normalizedCategory,
+		FuelType: fuelType, Quantity: quantity, QuantityUom: quantityUom}
+
+	record, err := newCombustionRecord(APIstub, input, gwpSet)
+	if err != nil {
+		return nil, err
+	}
+	return putCombustionRecord(APIstub, record, url, md5)
+}
+
+/* Record the Scope 1 mobile combustion emissions of the distance a vehicle of a party drove; an empty gwpSet selects the default set */
+
+func (s *EmissionsContract) RecordVehicleEmissions(ctx contractapi.TransactionContextInterface, vehicleId string, partyId string, fromDate string, thruDate string,
+	vehicleType string, fuelType string, distance float64, distanceUom string, url string, md5 string, gwpSet string) (*EmissionsRecord, error) {
+	APIstub := ctx.GetStub()
+	if strings.TrimSpace(vehicleType) == "" {
+		return nil, fmt.Errorf("vehicleType must be a non-empty string")
+	}
+	input := combustionInput{SourceID: vehicleId, PartyID: partyId, FromDate: fromDate, ThruDate: thruDate, Category: categoryMobileCombustion,
+		VehicleType: vehicleType, FuelType: fuelType, Quantity: distance, QuantityUom: distanceUom}
+
+	record, err := newCombustionRecord(APIstub, input, gwpSet)
+	if err != nil {
+		return nil, err
+	}
+	return putCombustionRecord(APIstub, record, url, md5)
+}
@@ -0,0 +1,105 @@
+package contract
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+func TestCombustionEmissions(t *testing.T) {
+	stub := newTestStub(t)
+	mustInvoke(t, stub, "initGWPSets")
+	imported := []FuelFactorResult{}
+	if err := json.Unmarshal(mustInvoke(t, stub, "initFuelFactors", "2020"), &imported); err != nil || len(imported) != len(fuelTypes) {
+		t.Fatalf("initFuelFactors imported %d factors, %v", len(imported), err)
+	}
+	if err := json.Unmarshal(mustInvoke(t, stub, "initFuelFactors", "2020"), &imported); err != nil || len(imported) != 0 {
+		t.Errorf("initFuelFactors imported %d factors again, %v", len(imported), err)
+	}
+	mustInvoke(t, stub, "importFuelFactor", `{"id":"CAR_GASOLINE_2020","fuelType":"gasoline","vehicleType":"Passenger Car","year":"2020","CO2EquivalentEmissions":0.35,"emissionsUom":"KG/MI",
+		"gasEmissions":{"CO2": 0.33, "CH4": 0.00001, "N2O": 0.00001}}`)
+
+	record := func(function string, args ...string) EmissionsRecord {
+		record := EmissionsRecord{}
+		if err := json.Unmarshal(mustInvoke(t, stub, function, args...), &record); err != nil {
+			t.Fatal(err)
+		}
+		return record
+	}
+
+	// 1000 therms are 100 MMBtu, emitting 5306 kg CO2, 0.1 kg CH4 and 0.01 kg N2O
+	boiler := record("recordFuelEmissions", "BOILER-1", "MyCompany", "2020-01-01", "2020-01-31", "natural gas", "1000", "THERMS", "", "", "", "")
+	if boiler.Scope != emissionsScope1 || boiler.Category != categoryStationaryCombustion || boiler.FuelType != fuelTypeNaturalGas || boiler.FactorSource != "EPA_2020_NATURAL_GAS" ||
+		!closeTo(boiler.EmissionsAmount, 5.306+0.0001*28+0.00001*265) || !closeTo(boiler.EnergyUseAmount, 100) || boiler.EnergyUseUom != "MMBTU" ||
+		!closeTo(boiler.NonrenewableEnergyUseAmount, 100) || boiler.GWPSet != defaultGWPSet {
+		t.Errorf("got record %+v", boiler)
+	}
+
+	// 378.5411784 l are 100 gallons of diesel, or 13.8 MMBtu with its heat content
+	generator := record("recordFuelEmissions", "GENERATOR-1", "MyCompany", "2020-01-01", "2020-01-31", "DIESEL", "378.5411784", "L", "", "", "", "AR6_100")
+	if !closeTo(generator.EmissionsAmount, (73.96+0.003*27.9+0.0006*273)*13.8/1000) || !closeTo(generator.EnergyUseAmount, 13.8) || generator.GWPSet != "AR6_100" {
+		t.Errorf("got record %+v", generator)
+	}
+
+	co2Emissions := CO2Emissions{}
+	if err := json.Unmarshal(mustInvoke(t, stub, "compEmissionAmount", generator.UUID, "kg", "AR5_100"), &co2Emissions); err != nil {
+		t.Fatal(err)
+	}
+	if !closeTo(co2Emissions.EmissionsAmount, (73.96+0.003*28+0.0006*265)*13.8) {
+		t.Errorf("got %+v", co2Emissions)
+	}
+
+	// a van recorded by fuel and then by distance for the same period keeps one record
+	van := record("recordFuelEmissions", "VAN-1", "MyCompany", "2020-02-01", "2020-02-29", "GASOLINE", "50", "GAL", "", "", "MOBILE_COMBUSTION", "")
+	vanByDistance := record("recordVehicleEmissions", "VAN-1", "MyCompany", "2020-02-01", "2020-02-29", "Passenger Car", "GASOLINE", "1000", "KM", "", "", "")
+	if van.Category != categoryMobileCombustion || vanByDistance.UUID != van.UUID || vanByDistance.VehicleType != "Passenger Car" ||
+		!closeTo(vanByDistance.EmissionsAmount, 1000/1.609344*(0.33+0.00001*28+0.00001*265)/1000) || vanByDistance.EnergyUseAmount != 0 || vanByDistance.EnergyUseUom != "" {
+		t.Errorf("got records %+v and %+v", van, vanByDistance)
+	}
+
+	totals := EmissionsTotals{}
+	if err := json.Unmarshal(mustInvoke(t, stub, "getEmissionsTotals", "MyCompany", "2020-01-01", "2020-12-31", "utility"), &totals); err != nil {
+		t.Fatal(err)
+	}
+	wantTotal := boiler.EmissionsAmount + generator.EmissionsAmount + vanByDistance.EmissionsAmount
+	// the heat content of the fuel is not electricity use
+	if len(totals.Groups) != 3 || !closeTo(totals.Total.EmissionsAmount, wantTotal) || !closeTo(totals.Total.MarketBasedEmissionsAmount, wantTotal) ||
+		totals.Total.EnergyUseAmount != 0 || totals.Total.NonrenewableEnergyUseAmount != 0 {
+		t.Errorf("got totals %+v", totals)
+	}
+
+	factors := []FuelFactorResult{}
+	if err := json.Unmarshal(mustInvoke(t, stub, "getFuelFactors", "GASOLINE", "", "0"), &factors); err != nil || len(factors) != 2 {
+		t.Errorf("getFuelFactors returned %d factors of gasoline, %v", len(factors), err)
+	}
+	if err := json.Unmarshal(mustInvoke(t, stub, "getFuelFactors", "GASOLINE", "", "2020"), &factors); err != nil || len(factors) != 1 {
+		t.Errorf("getFuelFactors returned %d fuel factors of gasoline, %v", len(factors), err)
+	}
+
+	tests := []struct {
+		name     string
+		function string
+		args     []string
+		wantErr  string
+	}{
+		{"unknown fuel", "recordFuelEmissions", []string{"BOILER-2", "MyCompany", "2020-01-01", "2020-01-31", "COAL", "1", "TONS", "", "", "", ""}, "fuelType must be"},
+		{"fuel by distance", "recordFuelEmissions", []string{"BOILER-2", "MyCompany", "2020-01-01", "2020-01-31", "DIESEL", "1", "MI", "", "", "", ""}, "cannot apply to MI"},
+		{"fuel by mass with a heat content by volume", "recordFuelEmissions", []string{"BOILER-2", "MyCompany", "2020-01-01", "2020-01-31", "DIESEL", "1", "KG", "", "", "", ""}, "Cannot convert"},
+		{"unknown category", "recordFuelEmissions", []string{"BOILER-2", "MyCompany", "2020-01-01", "2020-01-31", "DIESEL", "1", "GAL", "", "", "PROCESS", ""}, "category must be"},
+		{"no factor for the year", "recordFuelEmissions", []string{"BOILER-2", "MyCompany", "2030-01-01", "2030-01-31", "DIESEL", "1", "GAL", "", "", "", ""}, "No fuel emissions factor found"},
+		{"overlapping the same source and fuel", "recordVehicleEmissions", []string{"VAN-1", "MyCompany", "2020-02-15", "2020-03-15", "Passenger Car", "GASOLINE", "1", "MI", "", "", ""}, "overlaps record"},
+		{"vehicle factor per energy", "importFuelFactor", []string{`{"id":"TRUCK","fuelType":"DIESEL","vehicleType":"Truck","year":"2020","CO2EquivalentEmissions":1,"emissionsUom":"KG/MMBTU"}`}, "must be mass/distance"},
+		{"heat content without its unit", "importFuelFactor", []string{`{"id":"LPG","fuelType":"PROPANE","year":"2020","heatContent":0.091,"CO2EquivalentEmissions":62.87,"emissionsUom":"KG/MMBTU"}`}, "heatContentUom"},
+		{"existing factor", "importFuelFactor", []string{`{"id":"EPA_2020_DIESEL","fuelType":"DIESEL","year":"2020","heatContent":0.138,"heatContentUom":"MMBTU/GAL","CO2EquivalentEmissions":74,"emissionsUom":"KG/MMBTU"}`}, "already exists"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := stub.MockInvoke("tx", toByteArgs(tt.function, tt.args...))
+			if response.Status == shim.OK || !strings.Contains(response.Message, tt.wantErr) {
+				t.Errorf("got %d %q, want an error containing %q", response.Status, response.Message, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+// Emission Contract in Golang
+
+package contract
+
+import (
+	"fmt"
+
+	"chaincode-common/cclog"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/* Define the structure of Chaincode */
+
+type EmissionsContract struct {
+	contractapi.Contract
+}
+
+// this is the input for emissions calculation
+type EmissionsCalcInput struct {
+	UtilityID                 string `json:"utilityID"`
+	PartyID                   string `json:"partyID"`
+	FromDate                  string `json:"fromDate"`
+	ThruDate                  string `json:"thruDate"`
+	EnergyUseAmount           float64 `json:"energyUseAmount"`
+	EnergyUseUom              string `json:"energyUseUom"`
+}
+
+// this is seed data for emissions factors used to calculate emissions based on audited utility data
+type UtilityEmissionsFactors struct {
+	Class                     string `json:"class" metadata:",optional"`
+	UtilityID                 string `json:"utilityID"`
+	UtilityName               string `json:"utilitName" metadata:",optional"`
+	Year                      string `json:"year"`
+	Country                   string `json:"country" metadata:",optional"`
+	DivisionType              string `json:"divisionType"`
+	DivisionId                string `json:"divisionId"`
+	DivisionName              string `json:"divisionName" metadata:",optional"`
+	NetGeneration             float64 `json:"netGeneration"`
+	NetGenerationUOM          string `json:"netGenerationUOM"`
+	CO2EquivalentEmissions    float64 `json:"CO2EquivalentEmissions"`
+	EmissionsUOM              string `json:"emissionsUOM"`
+	// generation mix of the division, for the renewable share of the energy used: percentOfRenewables if set, otherwise renewables / (renewables + nonRenewables)
+	NonRenewables             float64 `json:"nonRenewables,omitempty" metadata:",optional"`
+	Renewables                float64 `json:"renewables,omitempty" metadata:",optional"`
+	PercentOfRenewables       float64 `json:"percentOfRenewables,omitempty" metadata:",optional"`
+	// GRID_AVERAGE, the default, for location-based emissions, or RESIDUAL_MIX for the market-based emissions of the energy use no contractual instrument covers
+	FactorType                string `json:"factorType,omitempty" metadata:",optional"`
+	// emissions of each of CO2, CH4 and N2O in emissionsUOM; when present, emissions are weighed with a GWP set instead of taken from CO2EquivalentEmissions
+	GasEmissions              map[string]float64 `json:"gasEmissions,omitempty" metadata:",optional"`
+}
+
+/* Transactions that only read the ledger, tagged in the contract metadata to be evaluated rather than submitted */
+func (s *EmissionsContract) GetEvaluateTransactions() []string {
+	return []string{
+		"GetAccessPolicy", "GetEmissionRecord", "CompEmissionAmount", "GetHistory",
+		"GetAllEmissionsData", "GetAllEmissionsDataByDateRange", "GetAllEmissionsDataByDateRangeAndParty", "GetEmissionsTotals",
+		"GetEmissionsRecordsByToken", "GetInstrument", "GetInstrumentsByParty", "GetGWPSet", "GetAllGWPSets",
+		"GetFuelFactor", "GetFuelFactors", "GetScope3Factor", "GetScope3Factors", "GetUtilityFactor", "GetUtilityFactorsByDivision",
+		"GetUtilityIdentifier", "GetAllUtilityIdentifiers",
+	}
+}
+
+/* InitLegder */
+func (s *EmissionsContract) InitLedger(ctx contractapi.TransactionContextInterface) error {
+	APIstub := ctx.GetStub()
+
+// initial values - we assume there is some other service which got us this emission factor reading
+// UtilityEmissionsFactors{UtilityID: "14328", Name: "Pacific Gas & Electric Co.", Year: "2018", Country: "USA",  DivisionType: "NERC", DivisionId: "WECC", DivisionName: "Western Electricity Coordinating Council", NetGeneration: 743291275, NetGenerationUOM: "MWH", CO2EquivalentEmissions: 288,021,204, EmissionsUOM: "TONS"
+
+	records := []EmissionsRecord{
+		EmissionsRecord{UtilityID: "Utility1", PartyID: "MyCOmpany1", FromDate: "2020-01-02", ThruDate: "2020-01-20", EnergyUseAmount: 1650, EnergyUseUom: "KWH", EmissionsAmount: 0.6328, EmissionsUom: "TONS", RenewableEnergyUseAmount: 430, NonrenewableEnergyUseAmount: 1220},
+		EmissionsRecord{UtilityID: "Utility2", PartyID: "MyCOmpany2", FromDate: "2020-01-02", ThruDate: "2020-01-20", EnergyUseAmount: 1750, EnergyUseUom: "KWH", EmissionsAmount: 0.6711, EmissionsUom: "TONS", RenewableEnergyUseAmount: 456, NonrenewableEnergyUseAmount: 1294},
+		EmissionsRecord{UtilityID: "Utility3", PartyID: "MyCOmpany3", FromDate: "2020-01-02", ThruDate: "2020-01-20", EnergyUseAmount: 1550, EnergyUseUom: "KWH", EmissionsAmount: 0.5944, EmissionsUom: "TONS", RenewableEnergyUseAmount: 404, NonrenewableEnergyUseAmount: 1146},
+		EmissionsRecord{UtilityID: "Utility4", PartyID: "MyCOmpany4", FromDate: "2020-01-02", ThruDate: "2020-01-20", EnergyUseAmount: 1550, EnergyUseUom: "KWH", EmissionsAmount: 0.5944, EmissionsUom: "TONS", RenewableEnergyUseAmount: 404, NonrenewableEnergyUseAmount: 1146},
+		EmissionsRecord{UtilityID: "Utility5", PartyID: "MyCOmpany5", FromDate: "2020-01-02", ThruDate: "2020-01-20", EnergyUseAmount: 1550, EnergyUseUom: "KWH", EmissionsAmount: 0.5944, EmissionsUom: "TONS", RenewableEnergyUseAmount: 404, NonrenewableEnergyUseAmount: 1146},
+	}
+	submittedBy, err := submittingMSP(APIstub)
+	if err != nil {
+		return err
+	}
+	for i := range records {
+		records[i].UUID = emissionsRecordID(records[i].UtilityID, records[i].PartyID, records[i].FromDate, records[i].ThruDate)
+		// running it again leaves the seeded records as they are, e.g. tokenized
+		existingAsBytes, err := APIstub.GetState(records[i].UUID)
+		if err != nil {
+			return err
+		} else if existingAsBytes != nil {
+			continue
+		}
+		records[i].Class = emissionsRecordClass
+		records[i].Version = emissionsRecordVersion
+		records[i].Scope = emissionsScope2
+		records[i].SubmittedBy = submittedBy
+		recordAsBytes, err := records[i].toJSON()
+		if err != nil {
+			return err
+		}
+		err = APIstub.PutState(records[i].UUID, recordAsBytes)
+		if err != nil {
+			return err
+		}
+		err = putEmissionsRecordIndex(APIstub, records[i].UUID, &records[i], nil)
+		if err != nil {
+			return err
+		}
+		cclog.ForStub(APIstub).Debug("added emissions record", "key", records[i].UUID)
+	}
+	return nil
+}
+
+/* Create an new entry of a utility, party and period; like recordEmissions it is stored under the MD5 of the three, so creating it again replaces it */
+
+func (s *EmissionsContract) CreateEmissionRecord(ctx contractapi.TransactionContextInterface, input EmissionsCalcInput, emissionsAmount float64, emissionsUom string, renewableEnergyUseAmount float64, nonrenewableEnergyUseAmount float64, factorSource string, url string, md5 string) (*EmissionsRecord, error) {
+	APIstub := ctx.GetStub()
+	uuid := emissionsRecordID(input.UtilityID, input.PartyID, input.FromDate, input.ThruDate)
+
+	record, err := newEmissionsRecord(uuid, input)
+	if err != nil {
+		return nil, err
+	}
+	record.EmissionsAmount = emissionsAmount
+	record.EmissionsUom = emissionsUom
+	record.RenewableEnergyUseAmount = renewableEnergyUseAmount
+	record.NonrenewableEnergyUseAmount = nonrenewableEnergyUseAmount
+	record.FactorSource = factorSource
+	record.URL = url
+	record.MD5 = md5
+	record.SubmittedBy, err = submittingMSP(APIstub)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := putEmissionsRecord(APIstub, uuid, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+/* Record the emissions of a party, computed from the emissions factor of the utility's division; an empty gwpSet selects the default set */
+
+func (s *EmissionsContract) RecordEmissions(ctx contractapi.TransactionContextInterface, input EmissionsCalcInput, url string, md5 string, gwpSet string) (*EmissionsRecord, error) {
+	APIstub := ctx.GetStub()
+	uuid := emissionsRecordID(input.UtilityID, input.PartyID, input.FromDate, input.ThruDate)
+
+	record, err := newEmissionsRecord(uuid, input)
+	if err != nil {
+		return nil, err
+	}
+
+	recordPeriod, err := record.period()
+	if err != nil {
+		return nil, err
+	}
+
+	// get emissions factor for the utility; convert energy use to the factor UOM; calculate emissions
+	factor, err := getEmissionsFactorForUtility(APIstub, input.UtilityID, recordPeriod.reportingYear())
+	if err != nil {
+		return nil, err
+	}
+	gwp, err := selectGWPSet(APIstub, gwpSet)
+	if err != nil {
+		return nil, err
+	}
+	co2Emissions, err := getCO2Emissions(factor, record.EnergyUseAmount, record.EnergyUseUom, gwp)
+	if err != nil {
+		return nil, err
+	}
+
+	record.EmissionsAmount = co2Emissions.EmissionsAmount
+	record.EmissionsUom = co2Emissions.EmissionsUom
+	record.GasEmissions = co2Emissions.GasEmissions
+	record.GWPSet = co2Emissions.GWPSet
+	record.RenewableEnergyUseAmount = co2Emissions.RenewableEnergyUseAmount
+	record.NonrenewableEnergyUseAmount = co2Emissions.NonrenewableEnergyUseAmount
+	record.FactorSource = fmt.Sprintf("eGrid %s %s %s", co2Emissions.Year, co2Emissions.DivisionType, co2Emissions.DivisionId)
+
+	// apply the retired instruments of the party, then the residual mix factor
+	item, err := getUtilityLookupItem(APIstub, input.UtilityID)
+	if err != nil {
+		return nil, err
+	}
+	var instruments []*ContractualInstrument
+	record.MarketBased, instruments, err = getMarketBasedEmissions(APIstub, uuid, record, item, recordPeriod.reportingYear(), factor, record.FactorSource, gwp)
+	if err != nil {
+		return nil, err
+	}
+
+	record.URL = url
+	record.MD5 = md5
+	record.SubmittedBy, err = submittingMSP(APIstub)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := putEmissionsRecord(APIstub, uuid, record); err != nil {
+		return nil, err
+	}
+	for _, instrument := range instruments {
+		if _, err := putInstrument(APIstub, instrument); err != nil {
+			return nil, err
+		}
+	}
+	return record, nil
+}
+
+/* Query a Value of Utility*/
+
+func (s *EmissionsContract) GetEmissionRecord(ctx contractapi.TransactionContextInterface, recordKey string) (*EmissionsRecord, error) {
+	valuesAsBytes, err := ctx.GetStub().GetState(recordKey)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get emissions record: %s", err.Error())
+	} else if valuesAsBytes == nil {
+		return nil, fmt.Errorf("Emissions record does not exist: %s", recordKey)
+	}
+	record, err := decodeEmissionsRecord(valuesAsBytes)
+	if err != nil {
+		return nil, fmt.Errorf("Emissions record %s: %s", recordKey, err.Error())
+	}
+	return record, nil
+}
+
+/* Compute the emissions of a record, in tons or the given unit, with its GWP set or the given one */
+
+func (s *EmissionsContract) CompEmissionAmount(ctx contractapi.TransactionContextInterface, recordKey string, emissionsUom string, gwpSet string) (*CO2Emissions, error) {
+	APIstub := ctx.GetStub()
+	valuesAsBytes, err := APIstub.GetState(recordKey)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get emissions record: %s", err.Error())
+	} else if valuesAsBytes == nil {
+		return nil, fmt.Errorf("Emissions record does not exist: %s", recordKey)
+	}
+
+	record, err := emissionsRecordFromJSON(valuesAsBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	recordPeriod, err := record.period()
+	if err != nil {
+		return nil, err
+	}
+
+	gwpSetID := record.GWPSet
+	if gwpSet != "" {
+		gwpSetID = gwpSet
+	}
+	gwp, err := selectGWPSet(APIstub, gwpSetID)
+	if err != nil {
+		return nil, err
+	}
+
+	var co2Emissions *CO2Emissions
+	if record.Scope == emissionsScope1 {
+		// use the FuelEmissionsFactor of the fuel, or vehicle type, of the record
+		co2Emissions, err = getRecordFuelEmissions(APIstub, record, gwp)
+	} else if record.Scope == emissionsScope3 {
+		// use the Scope3EmissionsFactor of the sector, or the emissions of the supplier, of the record
+		co2Emissions, err = getRecordScope3Emissions(APIstub, record, gwp)
+	} else {
+		// use UtilityEmissionsFactors for the UtilityID
+		var factor *UtilityEmissionsFactors
+		factor, err = getEmissionsFactorForUtility(APIstub, record.UtilityID, recordPeriod.reportingYear())
+		if err == nil {
+			co2Emissions, err = getCO2Emissions(factor, record.EnergyUseAmount, record.EnergyUseUom, gwp)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if emissionsUom != "" {
+		co2Emissions.EmissionsAmount, err = convertValues(co2Emissions.EmissionsAmount, co2Emissions.EmissionsUom, emissionsUom)
+		if err != nil {
+			return nil, err
+		}
+		co2Emissions.EmissionsUom = emissionsUom
+	}
+	return co2Emissions, nil
+}
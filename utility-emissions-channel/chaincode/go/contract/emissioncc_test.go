@@ -0,0 +1,87 @@
+package contract
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"emissions/events"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+/* calcInputJSON is the EmissionsCalcInput param of recordEmissions and createEmissionRecord */
+func calcInputJSON(utilityID string, partyID string, fromDate string, thruDate string, energyUseAmount float64, energyUseUom string) string {
+	inputAsBytes, _ := json.Marshal(EmissionsCalcInput{UtilityID: utilityID, PartyID: partyID, FromDate: fromDate, ThruDate: thruDate,
+		EnergyUseAmount: energyUseAmount, EnergyUseUom: energyUseUom})
+	return string(inputAsBytes)
+}
+
+func TestRecordEmissions(t *testing.T) {
+	stub := newTestStub(t)
+	mustInvoke(t, stub, "importUtilityIdentifier", `{"uuid":"USA_EIA_11208","state_province":"CA"}`)
+	mustInvoke(t, stub, "importUtilityIdentifier", `{"uuid":"USA_EIA_252","state_province":"AK"}`)
+	mustInvoke(t, stub, "importUtilityFactor", utilityFactorJSON("USA_2019_STATE_CA", "2019", "STATE", "CA", 40, ""))
+	mustInvoke(t, stub, "importUtilityFactor", utilityFactorJSON("USA_2020_STATE_CA", "2020", "STATE", "CA", 50, ""))
+
+	record := func(input string) EmissionsRecord {
+		record := EmissionsRecord{}
+		if err := json.Unmarshal(mustInvoke(t, stub, "recordEmissions", input, "", "", ""), &record); err != nil {
+			t.Fatal(err)
+		}
+		return record
+	}
+
+	// the 2020 record takes the factor of the state for 2020
+	first := record(calcInputJSON("USA_EIA_11208", "MyCompany", "2020-01-01", "2020-01-31", 1650, "KWH"))
+	if first.UUID != emissionsRecordID("USA_EIA_11208", "MyCompany", "2020-01-01", "2020-01-31") || first.FactorSource != "eGrid 2020 STATE CA" ||
+		!closeTo(first.EmissionsAmount, 0.825) || first.EmissionsUom != emissionsUomTons || first.Scope != emissionsScope2 {
+		t.Errorf("got record %+v", first)
+	}
+	if event := lastEvent(t, stub); event.Type != events.EmissionsRecordCreated {
+		t.Errorf("got event %s", event.Type)
+	}
+
+	// recording the same utility, party and period again replaces the record
+	second := record(calcInputJSON("USA_EIA_11208", "MyCompany", "2020-01-01", "2020-01-31", 3.3, "MWH"))
+	if second.UUID != first.UUID || second.EnergyUseAmount != 3.3 || second.EnergyUseUom != "MWH" || !closeTo(second.EmissionsAmount, 1.65) {
+		t.Errorf("got record %+v", second)
+	}
+	if event := lastEvent(t, stub); event.Type != events.EmissionsRecordUpdated {
+		t.Errorf("got event %s", event.Type)
+	}
+	stored := EmissionsRecord{}
+	if err := json.Unmarshal(mustInvoke(t, stub, "getEmissionRecord", first.UUID), &stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.EnergyUseAmount != 3.3 || !closeTo(stored.EmissionsAmount, 1.65) {
+		t.Errorf("stored record %+v", stored)
+	}
+	totals := EmissionsTotals{}
+	if err := json.Unmarshal(mustInvoke(t, stub, "getEmissionsTotals", "MyCompany", "2020-01-01", "2020-12-31", "utility"), &totals); err != nil {
+		t.Fatal(err)
+	}
+	if totals.Total.Records != 1 || !closeTo(totals.Total.EmissionsAmount, 1.65) {
+		t.Errorf("got totals %+v", totals.Total)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"no factor of the division", []string{calcInputJSON("USA_EIA_252", "MyCompany", "2020-01-01", "2020-01-31", 1650, "KWH"), "", "", ""}, "No utility emissions factor found for STATE AK in 2020"},
+		{"no factor of the year", []string{calcInputJSON("USA_EIA_11208", "MyCompany", "2021-01-01", "2021-01-31", 1650, "KWH"), "", "", ""}, "No utility emissions factor found for STATE CA in 2021"},
+		{"unknown utility", []string{calcInputJSON("USA_EIA_1", "MyCompany", "2020-01-01", "2020-01-31", 1650, "KWH"), "", "", ""}, "Utility does not exist: USA_EIA_1"},
+		{"energy use not a number", []string{`{"utilityID":"USA_EIA_11208","partyID":"MyCompany","fromDate":"2020-02-01","thruDate":"2020-02-29","energyUseAmount":"1650","energyUseUom":"KWH"}`, "", "", ""}, "was not passed in expected format"},
+		{"energy use not energy", []string{calcInputJSON("USA_EIA_11208", "MyCompany", "2020-02-01", "2020-02-29", 1650, "KG"), "", "", ""}, "Cannot convert"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := stub.MockInvoke("tx", toByteArgs("recordEmissions", tt.args...))
+			if response.Status == shim.OK || !strings.Contains(response.Message, tt.wantErr) {
+				t.Errorf("got %d %q, want an error containing %q", response.Status, response.Message, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+// Emissions calculation in Golang
+
+package contract
+
+import (
+	"fmt"
+	"math/big"
+)
+
+/* emissions are reported in metric tons of CO2e, as in the Node chaincode */
+const emissionsUomTons = "tons"
+
+// CO2Emissions is the result of applying a utility emissions factor to an energy use amount.
+// The renewable and nonrenewable energy use amounts split the usage by the generation mix of the factor, in the usage UOM.
+// If the factor is broken down by gas, GasEmissions has the emissions of each gas in the emissions UOM, weighed with the GWPSet.
+type CO2Emissions struct {
+	EmissionsAmount             float64            `json:"emissionsAmount"`
+	EmissionsUom                string             `json:"emissionsUom"`
+	RenewableEnergyUseAmount    float64            `json:"renewableEnergyUseAmount"`
+	NonrenewableEnergyUseAmount float64            `json:"nonrenewableEnergyUseAmount"`
+	DivisionType                string             `json:"divisionType"`
+	DivisionId                  string             `json:"divisionId"`
+	Year                        string             `json:"year"`
+	GasEmissions                map[string]float64 `json:"gasEmissions,omitempty" metadata:",optional"`
+	GWPSet                      string             `json:"gwpSet,omitempty" metadata:",optional"`
+}
+
+/* renewableShare is the renewable fraction of the generation of a factor: its percentOfRenewables if set, as in the Node chaincode, otherwise its renewables over its total generation; 0 if it has neither */
+func renewableShare(factor *UtilityEmissionsFactors) (*big.Rat, error) {
+	if factor.PercentOfRenewables != 0 {
+		percent, err := ratFromFloat(factor.PercentOfRenewables)
+		if err != nil {
+			return nil, err
+		}
+		return percent.Quo(percent, big.NewRat(100, 1)), nil
+	}
+	if factor.Renewables == 0 {
+		return new(big.Rat), nil
+	}
+	renewables, err := ratFromFloat(factor.Renewables)
+	if err != nil {
+		return nil, err
+	}
+	nonRenewables, err := ratFromFloat(factor.NonRenewables)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Rat).Quo(renewables, new(big.Rat).Add(renewables, nonRenewables)), nil
+}
+
+/* getCO2Emissions computes emissions = CO2EquivalentEmissions / NetGeneration * usage in exact arithmetic, converting the factor to tons per usage UOM; the emissions of a factor broken down by gas are weighed with the GWP set instead */
+func getCO2Emissions(factor *UtilityEmissionsFactors, usage float64, usageUom string, gwp *GWPSet) (*CO2Emissions, error) {
+	if factor.NetGeneration == 0 {
+		return nil, fmt.Errorf("emissions factor %s %s %s has no net generation", factor.Year, factor.DivisionType, factor.DivisionId)
+	}
+	netGeneration, err := ratFromFloat(factor.NetGeneration)
+	if err != nil {
+		return nil, err
+	}
+	usageRat, err := ratFromFloat(usage)
+	if err != nil {
+		return nil, err
+	}
+	// the tons emitted for the usage, of an amount the factor emits for its net generation; e.g. TONS/MWH converted to tons/KWH
+	emitted := func(amount float64) (*big.Rat, error) {
+		amountRat, err := ratFromFloat(amount)
+		if err != nil {
+			return nil, err
+		}
+		rate, err := convertRat(new(big.Rat).Quo(amountRat, netGeneration), factor.EmissionsUOM+"/"+factor.NetGenerationUOM, emissionsUomTons+"/"+usageUom)
+		if err != nil {
+			return nil, err
+		}
+		return rate.Mul(rate, usageRat), nil
+	}
+
+	co2Emissions := &CO2Emissions{
+		EmissionsUom: emissionsUomTons,
+		DivisionType: factor.DivisionType,
+		DivisionId:   factor.DivisionId,
+		Year:         factor.Year,
+	}
+	name := fmt.Sprintf("%s %s %s", factor.Year, factor.DivisionType, factor.DivisionId)
+	if err := weighEmissions(co2Emissions, name, factor.CO2EquivalentEmissions, factor.GasEmissions, gwp, emitted); err != nil {
+		return nil, err
+	}
+
+	// the nonrenewable use is the rest of the usage, so the two always add up to it
+	share, err := renewableShare(factor)
+	if err != nil {
+		return nil, err
+	}
+	renewableRat := new(big.Rat).Mul(usageRat, share)
+	co2Emissions.RenewableEnergyUseAmount, _ = renewableRat.Float64()
+	co2Emissions.NonrenewableEnergyUseAmount, _ = new(big.Rat).Sub(usageRat, renewableRat).Float64()
+	return co2Emissions, nil
+}
+
+/* weighEmissions sets the emissions of a factor named name, computed by emitted from its CO2 equivalent emissions or, if it is broken down by gas, from each of its gases weighed with the GWP set */
+func weighEmissions(co2Emissions *CO2Emissions, name string, co2EquivalentEmissions float64, gasEmissions map[string]float64, gwp *GWPSet, emitted func(amount float64) (*big.Rat, error)) error {
+	var emissions *big.Rat
+	var err error
+	if len(gasEmissions) == 0 {
+		if emissions, err = emitted(co2EquivalentEmissions); err != nil {
+			return err
+		}
+	} else {
+		if gwp == nil {
+			return fmt.Errorf("emissions factor %s is broken down by gas and needs a GWP set", name)
+		}
+		gasAmounts := map[string]*big.Rat{}
+		co2Emissions.GasEmissions = map[string]float64{}
+		for gas, amount := range gasEmissions {
+			if gasAmounts[gas], err = emitted(amount); err != nil {
+				return err
+			}
+			co2Emissions.GasEmissions[gas], _ = gasAmounts[gas].Float64()
+		}
+		if emissions, err = gwp.co2Equivalent(gasAmounts); err != nil {
+			return err
+		}
+		co2Emissions.GWPSet = gwp.ID
+	}
+	co2Emissions.EmissionsAmount, _ = emissions.Float64()
+	return nil
+}
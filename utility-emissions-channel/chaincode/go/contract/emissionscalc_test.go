@@ -0,0 +1,67 @@
+package contract
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+func TestGetCO2Emissions(t *testing.T) {
+	tests := []struct {
+		name             string
+		nonRenewables    float64
+		renewables       float64
+		percent          float64
+		wantRenewable    float64
+		wantNonrenewable float64
+	}{
+		{"renewables over total generation", 750, 250, 0, 412.5, 1237.5},
+		{"percent of renewables before generation totals", 750, 250, 40, 660, 990},
+		{"all renewable", 0, 100, 0, 1650, 0},
+		{"no generation mix", 0, 0, 0, 0, 1650},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			factor := &UtilityEmissionsFactors{Year: "2020", DivisionType: divisionTypeState, DivisionId: "CA",
+				NetGeneration: 100, NetGenerationUOM: "MWH", CO2EquivalentEmissions: 50, EmissionsUOM: "TONS",
+				NonRenewables: tt.nonRenewables, Renewables: tt.renewables, PercentOfRenewables: tt.percent}
+			co2Emissions, err := getCO2Emissions(factor, 1650, "KWH", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !closeTo(co2Emissions.EmissionsAmount, 0.825) || !closeTo(co2Emissions.RenewableEnergyUseAmount, tt.wantRenewable) ||
+				!closeTo(co2Emissions.NonrenewableEnergyUseAmount, tt.wantNonrenewable) {
+				t.Errorf("got %+v", co2Emissions)
+			}
+		})
+	}
+}
+
+func TestRecordEmissionsRenewableSplit(t *testing.T) {
+	stub := newTestStub(t)
+	mustInvoke(t, stub, "importUtilityIdentifier", `{"uuid":"USA_EIA_11208","year":"2019","utility_number":"11208","utility_name":"Los Angeles Department of Water & Power","country":"USA","state_province":"CA"}`)
+	mustInvoke(t, stub, "importUtilityFactor", utilityFactorJSON("USA_2020_STATE_CA", "2020", "STATE", "CA", 50, `"nonRenewables":75,"renewables":25`))
+
+	record := EmissionsRecord{}
+	if err := json.Unmarshal(mustInvoke(t, stub, "recordEmissions", calcInputJSON("USA_EIA_11208", "MyCompany", "2020-01-01", "2020-01-31", 1650, "KWH"), "", "", ""), &record); err != nil {
+		t.Fatal(err)
+	}
+	if !closeTo(record.RenewableEnergyUseAmount, 412.5) || !closeTo(record.NonrenewableEnergyUseAmount, 1237.5) {
+		t.Errorf("got renewable %v and nonrenewable %v", record.RenewableEnergyUseAmount, record.NonrenewableEnergyUseAmount)
+	}
+
+	co2Emissions := CO2Emissions{}
+	if err := json.Unmarshal(mustInvoke(t, stub, "compEmissionAmount", record.UUID, "kg", ""), &co2Emissions); err != nil {
+		t.Fatal(err)
+	}
+	if !closeTo(co2Emissions.EmissionsAmount, 825) || !closeTo(co2Emissions.RenewableEnergyUseAmount, 412.5) {
+		t.Errorf("got %+v", co2Emissions)
+	}
+
+	for _, mix := range []string{`"nonRenewables":-1`, `"percentOfRenewables":101`} {
+		if response := stub.MockInvoke("tx", toByteArgs("updateUtilityFactor", utilityFactorJSON("USA_2020_STATE_CA", "2020", "STATE", "CA", 50, mix))); response.Status == shim.OK {
+			t.Errorf("updateUtilityFactor with generation mix %v did not fail", mix)
+		}
+	}
+}
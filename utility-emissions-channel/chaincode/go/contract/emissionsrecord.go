@@ -0,0 +1,337 @@
+// Emissions record model in Golang
+
+package contract
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+/* class identifier shared with the Node chaincode, so both write the same documents */
+const emissionsRecordClass = "org.hyperledger.blockchain-carbon-accounting.emissionsrecord"
+
+/* current schema version of EmissionsRecord; bump it whenever a field changes meaning */
+const emissionsRecordVersion = 1
+
+/* composite key index of the records of a party; the period follows the party so a scan can skip records outside a period without reading them */
+const emissionsRecordPartyIndex = "partyId~fromDate~thruDate~uuid"
+
+/* GHG Protocol scopes: direct emissions, the indirect emissions of purchased energy, and the other indirect emissions of the value chain; a record without a scope is Scope 2 */
+const (
+	emissionsScope1 = 1
+	emissionsScope2 = 2
+	emissionsScope3 = 3
+)
+
+/* categories of Scope 1 records; Scope 2 records have no category, and are purchased electricity in totals */
+const (
+	categoryStationaryCombustion = "STATIONARY_COMBUSTION"
+	categoryMobileCombustion     = "MOBILE_COMBUSTION"
+	categoryPurchasedElectricity = "PURCHASED_ELECTRICITY"
+)
+
+var md5Pattern = regexp.MustCompile(`^[0-9a-fA-F]{32}$`)
+
+// EmissionsRecord is the emissions of a party for one utility billing period, for the fuel one source burnt over a period,
+// or for one Scope 3 category of a supplier or other source over a period.
+// The json tags follow the Node emissions record so records written by either chaincode are interchangeable.
+type EmissionsRecord struct {
+	Class                       string  `json:"class"`
+	Version                     int     `json:"version"`
+	UUID                        string  `json:"uuid"`
+	UtilityID                   string  `json:"utilityId"`
+	PartyID                     string  `json:"partyId"`
+	FromDate                    string  `json:"fromDate"`
+	ThruDate                    string  `json:"thruDate"`
+	EnergyUseAmount             float64 `json:"energyUseAmount"`
+	EnergyUseUom                string  `json:"energyUseUom"`
+	EmissionsAmount             float64 `json:"emissionsAmount"`
+	EmissionsUom                string  `json:"emissionsUom"`
+	RenewableEnergyUseAmount    float64 `json:"renewableEnergyUseAmount"`
+	NonrenewableEnergyUseAmount float64 `json:"nonrenewableEnergyUseAmount"`
+	FactorSource                string  `json:"factorSource"`
+	URL                         string  `json:"url"`
+	MD5                         string  `json:"md5"`
+	TokenID                     string  `json:"tokenId"`
+	// address of the NetEmissionsTokenNetwork account that issued the token, set with TokenID
+	TokenIssuedBy string `json:"tokenIssuedBy,omitempty" metadata:",optional"`
+	// MSP id of the client that wrote this version of the record
+	SubmittedBy string `json:"submittedBy,omitempty" metadata:",optional"`
+	// derived from the period when the record is written: the year of the thru date and the YYYY-MM months with days in the period
+	ReportingYear int      `json:"reportingYear,omitempty" metadata:",optional"`
+	MonthsCovered []string `json:"monthsCovered,omitempty" metadata:",optional"`
+	// set by recordEmissions; EmissionsAmount is then the location-based emissions
+	MarketBased *MarketBasedEmissions `json:"marketBased,omitempty" metadata:",optional"`
+	// set by recordEmissions with a factor broken down by gas: the emissions of each gas in EmissionsUom and the GWP set that weighed them
+	GasEmissions map[string]float64 `json:"gasEmissions,omitempty" metadata:",optional"`
+	GWPSet       string             `json:"gwpSet,omitempty" metadata:",optional"`
+	// the GHG Protocol scope of the emissions and, for Scopes 1 and 3, their category
+	Scope    int    `json:"scope,omitempty" metadata:",optional"`
+	Category string `json:"category,omitempty" metadata:",optional"`
+	// set by recordFuelEmissions and recordVehicleEmissions, whose UtilityID is the id of the source burning the fuel:
+	// the fuel, the vehicle type of distance-based emissions, and the quantity of fuel or distance the emissions are computed from
+	FuelType       string  `json:"fuelType,omitempty" metadata:",optional"`
+	VehicleType    string  `json:"vehicleType,omitempty" metadata:",optional"`
+	ActivityAmount float64 `json:"activityAmount,omitempty" metadata:",optional"`
+	ActivityUom    string  `json:"activityUom,omitempty" metadata:",optional"`
+	// set by the Scope 3 functions, whose UtilityID is the id of the supplier or other source and whose activity is the spend in its currency,
+	// the activity, or the emissions of the supplier: the calculation method, the NAICS sector or activity type of the factor, and the share
+	// of the emissions of the supplier allocated to the party
+	Method          string  `json:"method,omitempty" metadata:",optional"`
+	Sector          string  `json:"sector,omitempty" metadata:",optional"`
+	AllocationShare float64 `json:"allocationShare,omitempty" metadata:",optional"`
+}
+
+// EmissionsRecordResult is one entry of a query of emissions records, in the same shape as the Node chaincode returns
+type EmissionsRecordResult struct {
+	Key    string           `json:"Key"`
+	Record *EmissionsRecord `json:"Record"`
+}
+
+/* emissionsRecordID is the deterministic key of a record: the MD5 of its utility, party and period, as in the Node chaincode */
+func emissionsRecordID(utilityID string, partyID string, fromDate string, thruDate string) string {
+	sum := md5.Sum([]byte(utilityID + partyID + fromDate + thruDate))
+	return hex.EncodeToString(sum[:])
+}
+
+/* emissionsRecordPartyIndexKey is the composite index entry of a record stored under key */
+func emissionsRecordPartyIndexKey(APIstub shim.ChaincodeStubInterface, key string, record *EmissionsRecord) (string, error) {
+	return APIstub.CreateCompositeKey(emissionsRecordPartyIndex, []string{record.PartyID, record.FromDate, record.ThruDate, key})
+}
+
+/* putEmissionsRecordIndex indexes a record written under key; previous is the record it replaced, if any */
+func putEmissionsRecordIndex(APIstub shim.ChaincodeStubInterface, key string, record *EmissionsRecord, previous *EmissionsRecord) error {
+	indexKey, err := emissionsRecordPartyIndexKey(APIstub, key, record)
+	if err != nil {
+		return err
+	}
+	if previous != nil {
+		previousIndexKey, err := emissionsRecordPartyIndexKey(APIstub, key, previous)
+		if err != nil {
+			return err
+		}
+		if previousIndexKey != indexKey {
+			if err := APIstub.DelState(previousIndexKey); err != nil {
+				return err
+			}
+		}
+	}
+	//  Only the key name is needed, passing a 'nil' value would delete the key, therefore we pass null character as value
+	return APIstub.PutState(indexKey, []byte{0x00})
+}
+
+/* newEmissionsRecord starts a record from the calculation input; amounts derived from factors are filled in by the caller */
+func newEmissionsRecord(uuid string, input EmissionsCalcInput) (*EmissionsRecord, error) {
+	if _, err := parsePeriod(input.FromDate, input.ThruDate); err != nil {
+		return nil, err
+	}
+	return &EmissionsRecord{
+		Class:           emissionsRecordClass,
+		Version:         emissionsRecordVersion,
+		UUID:            uuid,
+		UtilityID:       input.UtilityID,
+		PartyID:         input.PartyID,
+		FromDate:        input.FromDate,
+		ThruDate:        input.ThruDate,
+		EnergyUseAmount: input.EnergyUseAmount,
+		EnergyUseUom:    input.EnergyUseUom,
+		Scope:           emissionsScope2,
+	}, nil
+}
+
+/* validate checks the record before it is written to the ledger */
+func (r *EmissionsRecord) validate() error {
+	if r.Class != emissionsRecordClass {
+		return fmt.Errorf("emissions record has class %q, expected %q", r.Class, emissionsRecordClass)
+	}
+	if r.Version < 1 || r.Version > emissionsRecordVersion {
+		return fmt.Errorf("unsupported emissions record version %d", r.Version)
+	}
+
+	// the energy use of a Scope 1 record is the heat content of its fuel, which distance-based emissions do not have
+	scopeRequired := []struct{ name, value string }{{"energyUseUom", r.EnergyUseUom}}
+	if r.Scope == emissionsScope1 {
+		scopeRequired = []struct{ name, value string }{{"fuelType", r.FuelType}, {"activityUom", r.ActivityUom}}
+	} else if r.Scope == emissionsScope3 {
+		scopeRequired = []struct{ name, value string }{{"method", r.Method}, {"activityUom", r.ActivityUom}}
+	}
+	required := append([]struct{ name, value string }{
+		{"uuid", r.UUID},
+		{"utilityId", r.UtilityID},
+		{"partyId", r.PartyID},
+		{"fromDate", r.FromDate},
+		{"thruDate", r.ThruDate},
+	}, scopeRequired...)
+	for _, field := range required {
+		if strings.TrimSpace(field.value) == "" {
+			return fmt.Errorf("emissions record %s must be a non-empty string", field.name)
+		}
+	}
+
+	if _, err := r.period(); err != nil {
+		return fmt.Errorf("emissions record %s", err.Error())
+	}
+
+	amounts := []struct {
+		name  string
+		value float64
+	}{
+		{"energyUseAmount", r.EnergyUseAmount},
+		{"emissionsAmount", r.EmissionsAmount},
+		{"renewableEnergyUseAmount", r.RenewableEnergyUseAmount},
+		{"nonrenewableEnergyUseAmount", r.NonrenewableEnergyUseAmount},
+		{"activityAmount", r.ActivityAmount},
+	}
+	for _, amount := range amounts {
+		if amount.value < 0 {
+			return fmt.Errorf("emissions record %s must not be negative", amount.name)
+		}
+	}
+	if r.EmissionsAmount > 0 && r.EmissionsUom == "" {
+		return errors.New("emissions record emissionsUom is required when emissionsAmount is set")
+	}
+	if r.EnergyUseAmount > 0 && r.EnergyUseUom == "" {
+		return errors.New("emissions record energyUseUom is required when energyUseAmount is set")
+	}
+	switch {
+	case r.Scope == emissionsScope2 && r.Category == "":
+	case r.Scope == emissionsScope1 && (r.Category == categoryStationaryCombustion || r.Category == categoryMobileCombustion):
+	case r.Scope == emissionsScope3 && isScope3Category(r.Category):
+	default:
+		return fmt.Errorf("emissions record scope %d and category %q do not match", r.Scope, r.Category)
+	}
+	if r.AllocationShare < 0 || r.AllocationShare > 1 {
+		return errors.New("emissions record allocationShare must be between 0 and 1")
+	}
+
+	if r.URL != "" {
+		if _, err := url.ParseRequestURI(r.URL); err != nil {
+			return fmt.Errorf("emissions record url is invalid: %s", err.Error())
+		}
+	}
+	if r.MD5 != "" && !md5Pattern.MatchString(r.MD5) {
+		return errors.New("emissions record md5 must be 32 hexadecimal characters")
+	}
+	return nil
+}
+
+/* period parses the billing period of the record */
+func (r *EmissionsRecord) period() (period, error) {
+	return parsePeriod(r.FromDate, r.ThruDate)
+}
+
+/* toJSON validates the record, derives its reporting year and months, and serializes it for PutState; field order is fixed by the struct, so the bytes are stable */
+func (r *EmissionsRecord) toJSON() ([]byte, error) {
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+	recordPeriod, _ := r.period()
+	r.ReportingYear = recordPeriod.reportingYear()
+	r.MonthsCovered = recordPeriod.months()
+	return json.Marshal(r)
+}
+
+/* sourceKey is what a record counts the emissions of: its utility, its source and fuel, or its source and Scope 3 category */
+func (r *EmissionsRecord) sourceKey() string {
+	if r.Scope == emissionsScope3 {
+		return r.UtilityID + "~" + r.Category
+	}
+	return r.UtilityID + "~" + r.FuelType
+}
+
+/* category is the category of a record in totals */
+func (r *EmissionsRecord) category() string {
+	if r.Category == "" {
+		return categoryPurchasedElectricity
+	}
+	return r.Category
+}
+
+/* checkOverlaps refuses a record whose period shares days with another record of the same party and source key, which would be counted twice */
+func checkOverlaps(APIstub shim.ChaincodeStubInterface, key string, record *EmissionsRecord) error {
+	recordPeriod, err := record.period()
+	if err != nil {
+		return err
+	}
+	resultsIterator, err := APIstub.GetStateByPartialCompositeKey(emissionsRecordPartyIndex, []string{record.PartyID})
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+		_, compositeKeyParts, err := APIstub.SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return err
+		}
+		otherKey := compositeKeyParts[3]
+		otherPeriod, err := parsePeriod(compositeKeyParts[1], compositeKeyParts[2])
+		// records written before dates were checked cannot be compared
+		if otherKey == key || err != nil || !otherPeriod.overlaps(recordPeriod) {
+			continue
+		}
+		otherAsBytes, err := APIstub.GetState(otherKey)
+		if err != nil {
+			return err
+		} else if otherAsBytes == nil {
+			return fmt.Errorf("Emissions record %s is indexed but does not exist", otherKey)
+		}
+		other, err := decodeEmissionsRecord(otherAsBytes)
+		if err != nil {
+			return err
+		}
+		if other.sourceKey() == record.sourceKey() {
+			return fmt.Errorf("Emissions record period %s overlaps record %s of utility %s and party %s for %s", recordPeriod, otherKey, record.UtilityID, record.PartyID, otherPeriod)
+		}
+	}
+	return nil
+}
+
+/* decodeEmissionsRecord decodes a stored record without validating it, filling in the defaults of older versions */
+func decodeEmissionsRecord(data []byte) (*EmissionsRecord, error) {
+	if len(data) == 0 {
+		return nil, errors.New("emissions record is empty")
+	}
+	record := &EmissionsRecord{}
+	if err := json.Unmarshal(data, record); err != nil {
+		return nil, fmt.Errorf("failed to decode emissions record: %s", err.Error())
+	}
+	// records written before the version field existed are version 1
+	if record.Version == 0 {
+		record.Version = 1
+	}
+	if record.Class == "" {
+		record.Class = emissionsRecordClass
+	} else if record.Class != emissionsRecordClass {
+		return nil, fmt.Errorf("the document has class %q, it is not an emissions record", record.Class)
+	}
+	// records written before Scope 1 records existed are Scope 2
+	if record.Scope == 0 {
+		record.Scope = emissionsScope2
+	}
+	return record, nil
+}
+
+/* emissionsRecordFromJSON decodes a record read from the ledger */
+func emissionsRecordFromJSON(data []byte) (*EmissionsRecord, error) {
+	record, err := decodeEmissionsRecord(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := record.validate(); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
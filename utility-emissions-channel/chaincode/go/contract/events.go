@@ -0,0 +1,76 @@
+// Chaincode events of the emissions chaincode in Golang
+
+package contract
+
+import (
+	"fmt"
+	"time"
+
+	"emissions/events"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+/* setEvent sets the event of the transaction; Fabric keeps only the last event set, so a function sets at most one */
+func setEvent(APIstub shim.ChaincodeStubInterface, eventType events.Type, data interface{}) error {
+	txTimestamp, err := APIstub.GetTxTimestamp()
+	if err != nil {
+		return err
+	}
+	timestamp := time.Unix(txTimestamp.GetSeconds(), int64(txTimestamp.GetNanos())).UTC().Format(time.RFC3339Nano)
+	payload, err := events.Marshal(eventType, APIstub.GetTxID(), timestamp, data)
+	if err != nil {
+		return err
+	}
+	return APIstub.SetEvent(string(eventType), payload)
+}
+
+/* putEmissionsRecord writes a record that overlaps no other, over nothing but a record, and sets EmissionsRecordCreated, or EmissionsRecordUpdated if it replaced one; a replaced record keeps its token, and a replacement without market-based emissions releases the instrument volume allocated to it */
+func putEmissionsRecord(APIstub shim.ChaincodeStubInterface, key string, record *EmissionsRecord) ([]byte, error) {
+	existingAsBytes, err := APIstub.GetState(key)
+	if err != nil {
+		return nil, err
+	}
+	eventType := events.EmissionsRecordCreated
+	var existing *EmissionsRecord
+	if existingAsBytes != nil {
+		eventType = events.EmissionsRecordUpdated
+		existing, err = decodeEmissionsRecord(existingAsBytes)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot write emissions record %s: %s", key, err.Error())
+		}
+		if err := checkTokenizedAmounts(existing, record); err != nil {
+			return nil, err
+		}
+		record.TokenID = existing.TokenID
+		record.TokenIssuedBy = existing.TokenIssuedBy
+		// a record written without market-based emissions no longer uses the instruments allocated to the one it replaces
+		if record.MarketBased == nil {
+			if err := releaseAllocations(APIstub, key, existing.PartyID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	recordAsBytes, err := record.toJSON()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkOverlaps(APIstub, key, record); err != nil {
+		return nil, err
+	}
+	if err := APIstub.PutState(key, recordAsBytes); err != nil {
+		return nil, err
+	}
+	if err := putEmissionsRecordIndex(APIstub, key, record, existing); err != nil {
+		return nil, err
+	}
+	return recordAsBytes, setEvent(APIstub, eventType, events.RecordData{Key: key, Record: recordAsBytes})
+}
+
+/* setFactorImported sets FactorImported for the factors a transaction wrote */
+func setFactorImported(APIstub shim.ChaincodeStubInterface, changes []events.FactorChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	return setEvent(APIstub, events.FactorImported, events.FactorImportedData{Factors: changes})
+}
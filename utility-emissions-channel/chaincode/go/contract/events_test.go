@@ -0,0 +1,111 @@
+package contract
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"chaincode-common/mockidentity"
+	"emissions/events"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+/* lastEvent decodes the event of the last transaction of the stub */
+func lastEvent(t *testing.T, stub *mockidentity.Stub) *events.Event {
+	if stub.Event == nil {
+		t.Fatal("the transaction set no event")
+	}
+	event, err := events.Decode(stub.Event.EventName, stub.Event.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+func TestEmissionsRecordEvents(t *testing.T) {
+	stub := newTestStub(t)
+	args := []string{calcInputJSON("USA_EIA_11208", "MyCompany", "2020-01-01", "2020-01-31", 1650, "KWH"), "0.6328", "TONS", "430", "1220", "", "", ""}
+	key := emissionsRecordID("USA_EIA_11208", "MyCompany", "2020-01-01", "2020-01-31")
+
+	for _, wantType := range []events.Type{events.EmissionsRecordCreated, events.EmissionsRecordUpdated} {
+		recordAsBytes := mustInvoke(t, stub, "createEmissionRecord", args...)
+		event := lastEvent(t, stub)
+		if event.Type != wantType || event.Version != 1 || event.TxID != "tx-createEmissionRecord" || event.Timestamp == "" {
+			t.Fatalf("unexpected event %+v, want %s", event, wantType)
+		}
+		data, err := event.RecordData()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data.Key != key || string(data.Record) != string(recordAsBytes) {
+			t.Errorf("unexpected data %+v", data)
+		}
+	}
+
+	mustInvoke(t, stub, "getEmissionRecord", key)
+	if stub.Event != nil {
+		t.Errorf("a query set the event %s", stub.Event.EventName)
+	}
+}
+
+func TestEmissionsRecordKeys(t *testing.T) {
+	stub := newTestStub(t)
+	mustInvoke(t, stub, "importUtilityIdentifier", `{"uuid":"USA_EIA_11208","year":"2019","utility_number":"11208","utility_name":"Los Angeles Department of Water & Power","country":"USA","state_province":"CA","divisions":{"division_type":"NERC_REGION","division_id":"WECC"}}`)
+
+	// records of a utility for other parties or periods are kept apart, and none replaces the utility identifier
+	for _, party := range []string{"MyCompany", "OtherCompany"} {
+		mustInvoke(t, stub, "createEmissionRecord", calcInputJSON("USA_EIA_11208", party, "2020-01-01", "2020-01-31", 1650, "KWH"), "0.6328", "TONS", "430", "1220", "", "", "")
+	}
+	for _, party := range []string{"MyCompany", "OtherCompany"} {
+		record := EmissionsRecord{}
+		if err := json.Unmarshal(mustInvoke(t, stub, "getEmissionRecord", emissionsRecordID("USA_EIA_11208", party, "2020-01-01", "2020-01-31")), &record); err != nil {
+			t.Fatal(err)
+		}
+		if record.PartyID != party {
+			t.Errorf("got record %+v of %s", record, party)
+		}
+	}
+	item := UtilityLookupItem{}
+	if err := json.Unmarshal(mustInvoke(t, stub, "getUtilityIdentifier", "USA_EIA_11208"), &item); err != nil || item.Class != utilityLookupItemClass {
+		t.Errorf("got identifier %+v, %v", item, err)
+	}
+
+	// a key holding another document is neither read nor overwritten as a record
+	response := stub.MockInvoke("tx", toByteArgs("getEmissionRecord", "USA_EIA_11208"))
+	if response.Status == shim.OK || !strings.Contains(response.Message, "not an emissions record") {
+		t.Errorf("getEmissionRecord of an identifier returned %d %q", response.Status, response.Message)
+	}
+	stub.MockTransactionStart("tx")
+	record := &EmissionsRecord{Class: emissionsRecordClass, Version: emissionsRecordVersion, UUID: "USA_EIA_11208", UtilityID: "USA_EIA_11208", PartyID: "MyCompany",
+		FromDate: "2020-03-01", ThruDate: "2020-03-31", EnergyUseUom: "KWH", Scope: emissionsScope2}
+	if _, err := putEmissionsRecord(stub, "USA_EIA_11208", record); err == nil || !strings.Contains(err.Error(), "not an emissions record") {
+		t.Errorf("putEmissionsRecord over an identifier returned %v", err)
+	}
+	stub.MockTransactionEnd("tx")
+}
+
+func TestFactorImportedEvent(t *testing.T) {
+	stub := newTestStub(t)
+	mustInvoke(t, stub, "importUtilityFactor", `{"utilityID":"USA_2018_STATE_CA","year":"2018","country":"USA","divisionType":"STATE","divisionId":"CA","divisionName":"California","netGeneration":195212860,"netGenerationUOM":"MWH","CO2EquivalentEmissions":49628215,"emissionsUOM":"short tons"}`)
+
+	batch := `[
+		{"utilityID": "USA_2018_STATE_CA", "year": "2018", "country": "USA", "divisionType": "STATE", "divisionId": "CA", "netGeneration": 195212860, "netGenerationUOM": "MWH", "CO2EquivalentEmissions": 49628216, "emissionsUOM": "short tons"},
+		{"utilityID": "USA_2018_STATE_NY", "year": "2018", "country": "USA", "divisionType": "STATE", "divisionId": "NY", "netGeneration": 130000000, "netGenerationUOM": "MWH", "CO2EquivalentEmissions": 26000000, "emissionsUOM": "short tons"},
+		{"utilityID": "", "year": "2018", "divisionType": "STATE", "divisionId": "TX", "netGeneration": 1, "netGenerationUOM": "MWH", "CO2EquivalentEmissions": 1, "emissionsUOM": "TONS"}
+	]`
+	mustInvoke(t, stub, "importUtilityFactorsBatch", batch)
+	data, err := lastEvent(t, stub).FactorImportedData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []events.FactorChange{{Key: "USA_2018_STATE_CA", Status: batchRowUpdated}, {Key: "USA_2018_STATE_NY", Status: batchRowCreated}}
+	if len(data.Factors) != len(want) {
+		t.Fatalf("got factors %+v, want %+v", data.Factors, want)
+	}
+	for i := range want {
+		if data.Factors[i] != want[i] {
+			t.Errorf("factor %d = %+v, want %+v", i, data.Factors[i], want[i])
+		}
+	}
+}
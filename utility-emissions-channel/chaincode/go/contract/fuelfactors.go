@@ -0,0 +1,370 @@
+// Fuel and vehicle emissions factor registry in Golang
+
+package contract
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"emissions/events"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/* class identifier of fuel emissions factors */
+const fuelFactorClass = "org.hyperledger.blockchain-carbon-accounting.fuelemissionsfactor"
+
+/* composite key index of the fuel factors; the fuel, vehicle type and year come first so lookups are range scans. Fuel factors have an empty vehicle type */
+const fuelFactorIndex = "fuelType~vehicleType~year~id"
+
+/* fuel types */
+const (
+	fuelTypeNaturalGas = "NATURAL_GAS"
+	fuelTypeDiesel     = "DIESEL"
+	fuelTypeGasoline   = "GASOLINE"
+	fuelTypePropane    = "PROPANE"
+	fuelTypeFuelOil    = "FUEL_OIL"
+)
+
+var fuelTypes = []string{fuelTypeNaturalGas, fuelTypeDiesel, fuelTypeGasoline, fuelTypePropane, fuelTypeFuelOil}
+
+/* if no fuel or Scope 3 factor is found for a year, try each preceding year up to this many times; the record names the factor it used in factorSource */
+const maximumYearLookback = 5
+
+/* the source of the factors written by initFuelFactors */
+const epaFactorsSource = "EPA GHG Emission Factors Hub"
+
+// FuelEmissionsFactor is the emissions of burning a fuel, per unit of energy with the heat content converting a quantity of fuel to energy,
+// or, for a vehicle type, the emissions of the vehicle per unit of distance.
+type FuelEmissionsFactor struct {
+	Class       string `json:"class" metadata:",optional"`
+	ID          string `json:"id"`
+	FuelType    string `json:"fuelType"`
+	VehicleType string `json:"vehicleType,omitempty" metadata:",optional"`
+	Year        string `json:"year"`
+	// energy per quantity of fuel, e.g. 0.138 MMBTU/GAL
+	HeatContent    float64 `json:"heatContent,omitempty" metadata:",optional"`
+	HeatContentUom string  `json:"heatContentUom,omitempty" metadata:",optional"`
+	// emissions per unit of energy of a fuel factor, e.g. KG/MMBTU, or per unit of distance of a vehicle factor, e.g. KG/MI
+	CO2EquivalentEmissions float64 `json:"CO2EquivalentEmissions"`
+	EmissionsUom           string  `json:"emissionsUom"`
+	// emissions of each of CO2, CH4 and N2O in emissionsUom; when present, emissions are weighed with a GWP set instead of taken from CO2EquivalentEmissions
+	GasEmissions map[string]float64 `json:"gasEmissions,omitempty" metadata:",optional"`
+	Source       string             `json:"source,omitempty" metadata:",optional"`
+}
+
+// FuelFactorResult is one entry of getFuelFactors and initFuelFactors, in the same shape as the Node chaincode returns
+type FuelFactorResult struct {
+	Key    string               `json:"Key"`
+	Record *FuelEmissionsFactor `json:"Record"`
+}
+
+// epaFuelFactors are the stationary combustion factors of the EPA GHG Emission Factors Hub written by initFuelFactors, with
+// CO2EquivalentEmissions weighed with AR5_100. Fuel oil is residual fuel oil No. 6; diesel is distillate fuel oil No. 2.
+var epaFuelFactors = []FuelEmissionsFactor{
+	{FuelType: fuelTypeNaturalGas, HeatContent: 0.001026, HeatContentUom: "MMBTU/SCF", CO2EquivalentEmissions: 53.1145, EmissionsUom: "KG/MMBTU",
+		GasEmissions: map[string]float64{gasCO2: 53.06, gasCH4: 0.001, gasN2O: 0.0001}},
+	{FuelType: fuelTypeDiesel, HeatContent: 0.138, HeatContentUom: "MMBTU/GAL", CO2EquivalentEmissions: 74.203, EmissionsUom: "KG/MMBTU",
+		GasEmissions: map[string]float64{gasCO2: 73.96, gasCH4: 0.003, gasN2O: 0.0006}},
+	{FuelType: fuelTypeGasoline, HeatContent: 0.125, HeatContentUom: "MMBTU/GAL", CO2EquivalentEmissions: 70.463, EmissionsUom: "KG/MMBTU",
+		GasEmissions: map[string]float64{gasCO2: 70.22, gasCH4: 0.003, gasN2O: 0.0006}},
+	{FuelType: fuelTypePropane, HeatContent: 0.091, HeatContentUom: "MMBTU/GAL", CO2EquivalentEmissions: 63.113, EmissionsUom: "KG/MMBTU",
+		GasEmissions: map[string]float64{gasCO2: 62.87, gasCH4: 0.003, gasN2O: 0.0006}},
+	{FuelType: fuelTypeFuelOil, HeatContent: 0.150, HeatContentUom: "MMBTU/GAL", CO2EquivalentEmissions: 75.343, EmissionsUom: "KG/MMBTU",
+		GasEmissions: map[string]float64{gasCO2: 75.10, gasCH4: 0.003, gasN2O: 0.0006}},
+}
+
+/* normalizeFuelType maps a fuel type to its upper case form, accepting spaces for underscores */
+func normalizeFuelType(fuelType string) string {
+	return strings.Replace(strings.ToUpper(strings.TrimSpace(fuelType)), " ", "_", -1)
+}
+
+/* checkFuelType checks a normalized fuel type is known */
+func checkFuelType(fuelType string) error {
+	for _, known := range fuelTypes {
+		if fuelType == known {
+			return nil
+		}
+	}
+	return fmt.Errorf("fuelType must be one of %s, got %q", strings.Join(fuelTypes, ", "), fuelType)
+}
+
+/* Validate normalizes the factor and checks it before it is written to the ledger */
+func (f *FuelEmissionsFactor) Validate() error {
+	f.FuelType = normalizeFuelType(f.FuelType)
+	f.VehicleType = strings.TrimSpace(f.VehicleType)
+	required := []struct{ name, value string }{
+		{"id", f.ID},
+		{"year", f.Year},
+		{"emissionsUom", f.EmissionsUom},
+	}
+	for _, field := range required {
+		if strings.TrimSpace(field.value) == "" {
+			return fmt.Errorf("fuel emissions factor %s must be a non-empty string", field.name)
+		}
+	}
+	if strings.Contains(f.ID, "\x00") || strings.Contains(f.VehicleType, "\x00") {
+		return fmt.Errorf("fuel emissions factor keys must not contain U+0000")
+	}
+	if err := checkFuelType(f.FuelType); err != nil {
+		return fmt.Errorf("fuel emissions factor %s", err.Error())
+	}
+	if _, err := strconv.Atoi(f.Year); err != nil || len(f.Year) != 4 {
+		return fmt.Errorf("fuel emissions factor year must be a 4 digit year, got %q", f.Year)
+	}
+	if f.CO2EquivalentEmissions < 0 {
+		return fmt.Errorf("fuel emissions factor CO2EquivalentEmissions must not be negative")
+	}
+	if err := checkGasEmissions("fuel emissions factor gasEmissions", f.GasEmissions); err != nil {
+		return err
+	}
+
+	wantDimensions := uomDimensionMass + "/" + uomDimensionEnergy
+	if f.VehicleType != "" {
+		wantDimensions = uomDimensionMass + "/" + uomDimensionDistance
+	}
+	if dimensions, err := uomDimensions(f.EmissionsUom); err != nil {
+		return err
+	} else if dimensions != wantDimensions {
+		return fmt.Errorf("fuel emissions factor emissionsUom %s must be %s", f.EmissionsUom, wantDimensions)
+	}
+	if f.HeatContent < 0 || (f.HeatContent == 0) != (f.HeatContentUom == "") {
+		return fmt.Errorf("fuel emissions factor heatContent must be positive and have a heatContentUom")
+	}
+	if f.HeatContentUom != "" {
+		dimensions, err := uomDimensions(f.HeatContentUom)
+		if err != nil {
+			return err
+		}
+		if dimensions != uomDimensionEnergy+"/"+uomDimensionVolume && dimensions != uomDimensionEnergy+"/"+uomDimensionMass {
+			return fmt.Errorf("fuel emissions factor heatContentUom %s must be energy/volume or energy/mass", f.HeatContentUom)
+		}
+	}
+	return nil
+}
+
+/* basisUom is the unit of energy or distance the factor emits its emissions for, e.g. MMBTU of KG/MMBTU */
+func (f *FuelEmissionsFactor) basisUom() string {
+	return strings.TrimSpace(f.EmissionsUom[strings.Index(f.EmissionsUom, "/")+1:])
+}
+
+/* fuelFactorIndexKey is the composite index entry of a factor */
+func fuelFactorIndexKey(APIstub shim.ChaincodeStubInterface, factor *FuelEmissionsFactor) (string, error) {
+	return APIstub.CreateCompositeKey(fuelFactorIndex, []string{factor.FuelType, factor.VehicleType, factor.Year, factor.ID})
+}
+
+/* getFuelFactorState reads a factor by its id; it returns nil if the factor does not exist */
+func getFuelFactorState(APIstub shim.ChaincodeStubInterface, id string) (*FuelEmissionsFactor, error) {
+	factorAsBytes, err := APIstub.GetState(id)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get fuel emissions factor %s: %s", id, err.Error())
+	} else if factorAsBytes == nil {
+		return nil, nil
+	}
+	factor := &FuelEmissionsFactor{}
+	if err := json.Unmarshal(factorAsBytes, factor); err != nil {
+		return nil, fmt.Errorf("Failed to decode fuel emissions factor %s: %s", id, err.Error())
+	} else if factor.Class != fuelFactorClass {
+		return nil, fmt.Errorf("%s is not a fuel emissions factor", id)
+	}
+	return factor, nil
+}
+
+/* putFuelFactor writes the factor under its id and maintains the fuel index; previous is the stored version, if any */
+func putFuelFactor(APIstub shim.ChaincodeStubInterface, factor *FuelEmissionsFactor, previous *FuelEmissionsFactor) ([]byte, error) {
+	factor.Class = fuelFactorClass
+	factorAsBytes, err := json.Marshal(factor)
+	if err != nil {
+		return nil, err
+	}
+	if err := APIstub.PutState(factor.ID, factorAsBytes); err != nil {
+		return nil, err
+	}
+
+	indexKey, err := fuelFactorIndexKey(APIstub, factor)
+	if err != nil {
+		return nil, err
+	}
+	if previous != nil {
+		previousIndexKey, err := fuelFactorIndexKey(APIstub, previous)
+		if err != nil {
+			return nil, err
+		}
+		if previousIndexKey != indexKey {
+			if err := APIstub.DelState(previousIndexKey); err != nil {
+				return nil, err
+			}
+		}
+	}
+	//  Only the key name is needed, passing a 'nil' value would delete the key, therefore we pass null character as value
+	if err := APIstub.PutState(indexKey, []byte{0x00}); err != nil {
+		return nil, err
+	}
+	return factorAsBytes, nil
+}
+
+/* queryFuelFactors range scans the fuel index by its leading attributes */
+func queryFuelFactors(APIstub shim.ChaincodeStubInterface, attributes []string) ([]FuelEmissionsFactor, error) {
+	resultsIterator, err := APIstub.GetStateByPartialCompositeKey(fuelFactorIndex, attributes)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	factors := []FuelEmissionsFactor{}
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, compositeKeyParts, err := APIstub.SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return nil, err
+		}
+		id := compositeKeyParts[3]
+		factor, err := getFuelFactorState(APIstub, id)
+		if err != nil {
+			return nil, err
+		} else if factor == nil {
+			return nil, fmt.Errorf("Fuel emissions factor %s is indexed but does not exist", id)
+		}
+		factors = append(factors, *factor)
+	}
+	return factors, nil
+}
+
+/* getFuelFactorForYear picks the factor of a fuel, and of a vehicle type for distance-based factors, for a year, or else for one of the preceding years */
+func getFuelFactorForYear(APIstub shim.ChaincodeStubInterface, fuelType string, vehicleType string, year int) (*FuelEmissionsFactor, error) {
+	for lookback := 0; lookback <= maximumYearLookback; lookback++ {
+		factors, err := queryFuelFactors(APIstub, []string{fuelType, vehicleType, fmt.Sprintf("%d", year-lookback)})
+		if err != nil {
+			return nil, err
+		}
+		if len(factors) > 0 {
+			return &factors[0], nil
+		}
+	}
+	if vehicleType != "" {
+		return nil, fmt.Errorf("No fuel emissions factor found for %s %s in %d", vehicleType, fuelType, year)
+	}
+	return nil, fmt.Errorf("No fuel emissions factor found for %s in %d", fuelType, year)
+}
+
+/* Import a new fuel or vehicle emissions factor */
+
+func (s *EmissionsContract) ImportFuelFactor(ctx contractapi.TransactionContextInterface, factor FuelEmissionsFactor) (*FuelEmissionsFactor, error) {
+	APIstub := ctx.GetStub()
+	if err := factor.Validate(); err != nil {
+		return nil, err
+	}
+
+	existingAsBytes, err := APIstub.GetState(factor.ID)
+	if err != nil {
+		return nil, err
+	} else if existingAsBytes != nil {
+		return nil, fmt.Errorf("This key already exists: %s", factor.ID)
+	}
+
+	if _, err := putFuelFactor(APIstub, &factor, nil); err != nil {
+		return nil, err
+	}
+	err = setFactorImported(APIstub, []events.FactorChange{{Key: factor.ID, Status: batchRowCreated}})
+	if err != nil {
+		return nil, err
+	}
+	return &factor, nil
+}
+
+/* Update an existing fuel or vehicle emissions factor, re-indexing it if its fuel, vehicle type or year changed */
+
+func (s *EmissionsContract) UpdateFuelFactor(ctx contractapi.TransactionContextInterface, factor FuelEmissionsFactor) (*FuelEmissionsFactor, error) {
+	APIstub := ctx.GetStub()
+	if err := factor.Validate(); err != nil {
+		return nil, err
+	}
+
+	existing, err := getFuelFactorState(APIstub, factor.ID)
+	if err != nil {
+		return nil, err
+	} else if existing == nil {
+		return nil, fmt.Errorf("Fuel emissions factor does not exist: %s", factor.ID)
+	}
+
+	if _, err := putFuelFactor(APIstub, &factor, existing); err != nil {
+		return nil, err
+	}
+	err = setFactorImported(APIstub, []events.FactorChange{{Key: factor.ID, Status: batchRowUpdated}})
+	if err != nil {
+		return nil, err
+	}
+	return &factor, nil
+}
+
+/* Import the EPA stationary combustion factors of each fuel for a year, unless the fuel already has a factor for the year */
+
+func (s *EmissionsContract) InitFuelFactors(ctx contractapi.TransactionContextInterface, year int) ([]FuelFactorResult, error) {
+	APIstub := ctx.GetStub()
+	results := []FuelFactorResult{}
+	changes := []events.FactorChange{}
+	for i := range epaFuelFactors {
+		factor := epaFuelFactors[i]
+		factor.ID = fmt.Sprintf("EPA_%d_%s", year, factor.FuelType)
+		factor.Year = strconv.Itoa(year)
+		factor.Source = epaFactorsSource
+		if err := factor.Validate(); err != nil {
+			return nil, err
+		}
+		existing, err := queryFuelFactors(APIstub, []string{factor.FuelType, "", factor.Year})
+		if err != nil {
+			return nil, err
+		} else if len(existing) > 0 {
+			continue
+		}
+		if _, err := putFuelFactor(APIstub, &factor, nil); err != nil {
+			return nil, err
+		}
+		results = append(results, FuelFactorResult{Key: factor.ID, Record: &factor})
+		changes = append(changes, events.FactorChange{Key: factor.ID, Status: batchRowCreated})
+	}
+	if err := setFactorImported(APIstub, changes); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+/* Query a fuel or vehicle emissions factor by its id */
+
+func (s *EmissionsContract) GetFuelFactor(ctx contractapi.TransactionContextInterface, id string) (*FuelEmissionsFactor, error) {
+	factor, err := getFuelFactorState(ctx.GetStub(), id)
+	if err != nil {
+		return nil, err
+	} else if factor == nil {
+		return nil, fmt.Errorf("Fuel emissions factor does not exist: %s", id)
+	}
+	return factor, nil
+}
+
+/* Query the emissions factors of a fuel, only those of a vehicle type unless it is empty, and of a year unless it is 0;
+   with a year and no vehicle type, only the fuel factors of the year */
+
+func (s *EmissionsContract) GetFuelFactors(ctx contractapi.TransactionContextInterface, fuelType string, vehicleType string, year int) ([]FuelFactorResult, error) {
+	attributes := []string{normalizeFuelType(fuelType)}
+	if vehicleType != "" || year != 0 {
+		attributes = append(attributes, strings.TrimSpace(vehicleType))
+	}
+	if year != 0 {
+		attributes = append(attributes, strconv.Itoa(year))
+	}
+	factors, err := queryFuelFactors(ctx.GetStub(), attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []FuelFactorResult{}
+	for i := range factors {
+		results = append(results, FuelFactorResult{Key: factors[i].ID, Record: &factors[i]})
+	}
+	return results, nil
+}
@@ -0,0 +1,254 @@
+// Global warming potential sets in Golang
+
+package contract
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/* class identifier of GWP sets */
+const gwpSetClass = "org.hyperledger.blockchain-carbon-accounting.gwpset"
+
+/* composite key index listing every GWP set */
+const gwpSetIndex = "gwpSet~id"
+
+/* the greenhouse gases factors may break their emissions down into */
+const (
+	gasCO2 = "CO2"
+	gasCH4 = "CH4"
+	gasN2O = "N2O"
+)
+
+var greenhouseGases = []string{gasCO2, gasCH4, gasN2O}
+
+/* the GWP set of a record when none is selected: AR5 100-year, as eGRID uses for its CO2 equivalent emissions */
+const defaultGWPSet = "AR5_100"
+
+// GWPSet is the global warming potential of each greenhouse gas over a time horizon, as published in an IPCC assessment report.
+// A set never changes once imported, so emissions computed with it can always be computed again.
+type GWPSet struct {
+	Class   string             `json:"class" metadata:",optional"`
+	ID      string             `json:"id"`
+	Report  string             `json:"report"`
+	Horizon int                `json:"horizon"`
+	Values  map[string]float64 `json:"values"`
+}
+
+// GWPSetResult is one entry of getAllGWPSets and initGWPSets, in the same shape as the Node chaincode returns
+type GWPSetResult struct {
+	Key    string  `json:"Key"`
+	Record *GWPSet `json:"Record"`
+}
+
+// standardGWPSets are the IPCC values written by initGWPSets; AR6 CH4 is the value of table 7.SM.7, without the fossil and non-fossil split
+var standardGWPSets = []GWPSet{
+	{ID: "AR4_100", Report: "AR4", Horizon: 100, Values: map[string]float64{gasCO2: 1, gasCH4: 25, gasN2O: 298}},
+	{ID: "AR4_20", Report: "AR4", Horizon: 20, Values: map[string]float64{gasCO2: 1, gasCH4: 72, gasN2O: 289}},
+	{ID: "AR5_100", Report: "AR5", Horizon: 100, Values: map[string]float64{gasCO2: 1, gasCH4: 28, gasN2O: 265}},
+	{ID: "AR5_20", Report: "AR5", Horizon: 20, Values: map[string]float64{gasCO2: 1, gasCH4: 84, gasN2O: 264}},
+	{ID: "AR6_100", Report: "AR6", Horizon: 100, Values: map[string]float64{gasCO2: 1, gasCH4: 27.9, gasN2O: 273}},
+	{ID: "AR6_20", Report: "AR6", Horizon: 20, Values: map[string]float64{gasCO2: 1, gasCH4: 81.2, gasN2O: 273}},
+}
+
+/* checkGasEmissions checks the gases of a breakdown of emissions are known and their amounts are not negative */
+func checkGasEmissions(name string, gasEmissions map[string]float64) error {
+	for gas, amount := range gasEmissions {
+		if !isGreenhouseGas(gas) {
+			return fmt.Errorf("%s has unknown gas %q, expected one of %s", name, gas, strings.Join(greenhouseGases, ", "))
+		}
+		if amount < 0 {
+			return fmt.Errorf("%s of %s must not be negative", name, gas)
+		}
+	}
+	return nil
+}
+
+func isGreenhouseGas(gas string) bool {
+	for _, known := range greenhouseGases {
+		if gas == known {
+			return true
+		}
+	}
+	return false
+}
+
+/* Validate normalizes the set and checks it has a positive value for every greenhouse gas */
+func (g *GWPSet) Validate() error {
+	g.ID = strings.TrimSpace(g.ID)
+	g.Report = strings.ToUpper(strings.TrimSpace(g.Report))
+	if g.ID == "" || g.Report == "" {
+		return fmt.Errorf("GWP set id and report must be non-empty strings")
+	}
+	if strings.Contains(g.ID, "\x00") {
+		return fmt.Errorf("GWP set keys must not contain U+0000")
+	}
+	if g.Horizon <= 0 {
+		return fmt.Errorf("GWP set horizon must be a positive number of years")
+	}
+	if err := checkGasEmissions("GWP set values", g.Values); err != nil {
+		return err
+	}
+	for _, gas := range greenhouseGases {
+		if g.Values[gas] <= 0 {
+			return fmt.Errorf("GWP set %s must have a positive value for %s", g.ID, gas)
+		}
+	}
+	return nil
+}
+
+/* co2Equivalent weighs the amounts of each gas by its GWP */
+func (g *GWPSet) co2Equivalent(gasAmounts map[string]*big.Rat) (*big.Rat, error) {
+	total := new(big.Rat)
+	for gas, amount := range gasAmounts {
+		gwp, err := ratFromFloat(g.Values[gas])
+		if err != nil {
+			return nil, err
+		}
+		total.Add(total, new(big.Rat).Mul(amount, gwp))
+	}
+	return total, nil
+}
+
+/* getGWPSetState reads a GWP set by its id; it returns nil if the set does not exist */
+func getGWPSetState(APIstub shim.ChaincodeStubInterface, id string) (*GWPSet, error) {
+	setAsBytes, err := APIstub.GetState(id)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get GWP set %s: %s", id, err.Error())
+	} else if setAsBytes == nil {
+		return nil, nil
+	}
+	set := &GWPSet{}
+	if err := json.Unmarshal(setAsBytes, set); err != nil {
+		return nil, fmt.Errorf("Failed to decode GWP set %s: %s", id, err.Error())
+	} else if set.Class != gwpSetClass {
+		return nil, fmt.Errorf("%s is not a GWP set", id)
+	}
+	return set, nil
+}
+
+/* selectGWPSet reads the GWP set of an id, or of the default id if it is empty; only a set selected by id must exist */
+func selectGWPSet(APIstub shim.ChaincodeStubInterface, id string) (*GWPSet, error) {
+	if strings.TrimSpace(id) == "" {
+		return getGWPSetState(APIstub, defaultGWPSet)
+	}
+	set, err := getGWPSetState(APIstub, strings.TrimSpace(id))
+	if err != nil {
+		return nil, err
+	} else if set == nil {
+		return nil, fmt.Errorf("GWP set does not exist: %s", id)
+	}
+	return set, nil
+}
+
+/* putGWPSet writes a new GWP set under its id and indexes it for getAllGWPSets */
+func putGWPSet(APIstub shim.ChaincodeStubInterface, set *GWPSet) ([]byte, error) {
+	set.Class = gwpSetClass
+	setAsBytes, err := json.Marshal(set)
+	if err != nil {
+		return nil, err
+	}
+	if err := APIstub.PutState(set.ID, setAsBytes); err != nil {
+		return nil, err
+	}
+	indexKey, err := APIstub.CreateCompositeKey(gwpSetIndex, []string{set.ID})
+	if err != nil {
+		return nil, err
+	}
+	//  Only the key name is needed, passing a 'nil' value would delete the key, therefore we pass null character as value
+	return setAsBytes, APIstub.PutState(indexKey, []byte{0x00})
+}
+
+/* Import a new GWP set */
+
+func (s *EmissionsContract) ImportGWPSet(ctx contractapi.TransactionContextInterface, set GWPSet) (*GWPSet, error) {
+	APIstub := ctx.GetStub()
+	if err := set.Validate(); err != nil {
+		return nil, err
+	}
+
+	existingAsBytes, err := APIstub.GetState(set.ID)
+	if err != nil {
+		return nil, err
+	} else if existingAsBytes != nil {
+		return nil, fmt.Errorf("This key already exists: %s", set.ID)
+	}
+	if _, err := putGWPSet(APIstub, &set); err != nil {
+		return nil, err
+	}
+	return &set, nil
+}
+
+/* Import the IPCC AR4, AR5 and AR6 100-year and 20-year GWP sets not yet on the ledger */
+
+func (s *EmissionsContract) InitGWPSets(ctx contractapi.TransactionContextInterface) ([]GWPSetResult, error) {
+	APIstub := ctx.GetStub()
+	results := []GWPSetResult{}
+	for i := range standardGWPSets {
+		set := standardGWPSets[i]
+		existing, err := getGWPSetState(APIstub, set.ID)
+		if err != nil {
+			return nil, err
+		} else if existing != nil {
+			continue
+		}
+		if _, err := putGWPSet(APIstub, &set); err != nil {
+			return nil, err
+		}
+		results = append(results, GWPSetResult{Key: set.ID, Record: &set})
+	}
+	return results, nil
+}
+
+/* Query a GWP set */
+
+func (s *EmissionsContract) GetGWPSet(ctx contractapi.TransactionContextInterface, id string) (*GWPSet, error) {
+	set, err := getGWPSetState(ctx.GetStub(), id)
+	if err != nil {
+		return nil, err
+	} else if set == nil {
+		return nil, fmt.Errorf("GWP set does not exist: %s", id)
+	}
+	return set, nil
+}
+
+/* Query every GWP set */
+
+func (s *EmissionsContract) GetAllGWPSets(ctx contractapi.TransactionContextInterface) ([]GWPSetResult, error) {
+	APIstub := ctx.GetStub()
+	resultsIterator, err := APIstub.GetStateByPartialCompositeKey(gwpSetIndex, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	ids := []string{}
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, compositeKeyParts, err := APIstub.SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, compositeKeyParts[0])
+	}
+
+	results := []GWPSetResult{}
+	for _, id := range ids {
+		set, err := getGWPSetState(APIstub, id)
+		if err != nil {
+			return nil, err
+		} else if set == nil {
+			return nil, fmt.Errorf("GWP set %s is indexed but does not exist", id)
+		}
+		results = append(results, GWPSetResult{Key: id, Record: set})
+	}
+	return results, nil
+}
@@ -0,0 +1,88 @@
+package contract
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+func TestGWPSets(t *testing.T) {
+	stub := newTestStub(t)
+	mustInvoke(t, stub, "importUtilityIdentifier", `{"uuid":"USA_EIA_11208","year":"2019","utility_number":"11208","utility_name":"Los Angeles Department of Water & Power","country":"USA","state_province":"CA"}`)
+	mustInvoke(t, stub, "importUtilityFactor", utilityFactorJSON("USA_2020_STATE_CA", "2020", "STATE", "CA", 50, `"gasEmissions":{"CO2": 49, "CH4": 0.02, "N2O": 0.001}`))
+	recordArgs := func(gwpSet string) []string {
+		return []string{calcInputJSON("USA_EIA_11208", "MyCompany", "2020-01-01", "2020-01-31", 1000, "KWH"), "", "", gwpSet}
+	}
+
+	// a factor broken down by gas cannot be used before the GWP sets are imported
+	response := stub.MockInvoke("tx", toByteArgs("recordEmissions", recordArgs("")...))
+	if response.Status == shim.OK || !strings.Contains(response.Message, "needs a GWP set") {
+		t.Errorf("got %d %q", response.Status, response.Message)
+	}
+
+	imported := []GWPSetResult{}
+	if err := json.Unmarshal(mustInvoke(t, stub, "initGWPSets"), &imported); err != nil {
+		t.Fatal(err)
+	}
+	if len(imported) != len(standardGWPSets) {
+		t.Errorf("initGWPSets imported %d sets, want %d", len(imported), len(standardGWPSets))
+	}
+	if err := json.Unmarshal(mustInvoke(t, stub, "initGWPSets"), &imported); err != nil || len(imported) != 0 {
+		t.Errorf("initGWPSets imported %d sets again, %v", len(imported), err)
+	}
+	mustInvoke(t, stub, "importGWPSet", `{"id":"CUSTOM_100","report":"custom","horizon":100,"values":{"CO2": 1, "CH4": 30, "N2O": 300}}`)
+	all := []GWPSetResult{}
+	if err := json.Unmarshal(mustInvoke(t, stub, "getAllGWPSets"), &all); err != nil || len(all) != len(standardGWPSets)+1 {
+		t.Errorf("getAllGWPSets returned %d sets, %v", len(all), err)
+	}
+
+	// 1 MWh emits 0.49 t CO2, 0.0002 t CH4 and 0.00001 t N2O
+	record := EmissionsRecord{}
+	if err := json.Unmarshal(mustInvoke(t, stub, "recordEmissions", recordArgs("")...), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.GWPSet != defaultGWPSet || !closeTo(record.EmissionsAmount, 0.49+0.0002*28+0.00001*265) ||
+		!closeTo(record.GasEmissions[gasCO2], 0.49) || !closeTo(record.GasEmissions[gasCH4], 0.0002) || !closeTo(record.GasEmissions[gasN2O], 0.00001) {
+		t.Errorf("got record %+v", record)
+	}
+
+	co2Emissions := CO2Emissions{}
+	if err := json.Unmarshal(mustInvoke(t, stub, "compEmissionAmount", record.UUID, "", "AR6_20"), &co2Emissions); err != nil {
+		t.Fatal(err)
+	}
+	if co2Emissions.GWPSet != "AR6_20" || !closeTo(co2Emissions.EmissionsAmount, 0.49+0.0002*81.2+0.00001*273) {
+		t.Errorf("got %+v", co2Emissions)
+	}
+
+	// restating the record with another set computes it again from the same factor
+	if err := json.Unmarshal(mustInvoke(t, stub, "recordEmissions", recordArgs("AR6_20")...), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.GWPSet != "AR6_20" || !closeTo(record.EmissionsAmount, co2Emissions.EmissionsAmount) || !closeTo(record.MarketBased.EmissionsAmount, co2Emissions.EmissionsAmount) {
+		t.Errorf("got record %+v", record)
+	}
+
+	tests := []struct {
+		name     string
+		function string
+		args     []string
+		wantErr  string
+	}{
+		{"unknown set", "recordEmissions", recordArgs("AR7_100"), "GWP set does not exist"},
+		{"existing set", "importGWPSet", []string{`{"id":"AR5_100","report":"AR5","horizon":100,"values":{"CO2": 1, "CH4": 28, "N2O": 265}}`}, "already exists"},
+		{"set without N2O", "importGWPSet", []string{`{"id":"NO_N2O","report":"AR5","horizon":100,"values":{"CO2": 1, "CH4": 28}}`}, "must have a positive value for N2O"},
+		{"set with an unknown gas", "importGWPSet", []string{`{"id":"SF6","report":"AR5","horizon":100,"values":{"CO2": 1, "CH4": 28, "N2O": 265, "SF6": 23500}}`}, "unknown gas"},
+		{"factor with an unknown gas", "importUtilityFactor", []string{utilityFactorJSON("F", "2020", "STATE", "CA", 50, `"gasEmissions":{"HFC": 1}`)}, "unknown gas"},
+		{"factor with negative gas emissions", "importUtilityFactor", []string{utilityFactorJSON("F", "2020", "STATE", "CA", 50, `"gasEmissions":{"CH4": -1}`)}, "must not be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := stub.MockInvoke("tx", toByteArgs(tt.function, tt.args...))
+			if response.Status == shim.OK || !strings.Contains(response.Message, tt.wantErr) {
+				t.Errorf("got %d %q, want an error containing %q", response.Status, response.Message, tt.wantErr)
+			}
+		})
+	}
+}
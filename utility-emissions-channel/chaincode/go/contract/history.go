@@ -0,0 +1,103 @@
+// History of emissions records in Golang
+
+package contract
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// HistoryEntry is one modification of an emissions record. Record is nil when the modification was a delete.
+type HistoryEntry struct {
+	TxID        string           `json:"txId"`
+	Timestamp   string           `json:"timestamp"`
+	IsDelete    bool             `json:"isDelete"`
+	Record      *EmissionsRecord `json:"record,omitempty" metadata:",optional"`
+	SubmittedBy string           `json:"submittedBy"`
+}
+
+/* submittingMSP is the MSP id of the client that submitted the transaction; records keep it because the history of a key does not */
+func submittingMSP(APIstub shim.ChaincodeStubInterface) (string, error) {
+	mspID, err := cid.GetMSPID(APIstub)
+	if err != nil {
+		return "", fmt.Errorf("Failed to get the MSP of the submitter: %s", err.Error())
+	}
+	return mspID, nil
+}
+
+/* parseHistoryTime parses an optional RFC3339 bound of a history query; empty means unbounded */
+func parseHistoryTime(name string, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be an RFC3339 timestamp, got %q", name, value)
+	}
+	return t, nil
+}
+
+/* readHistory collects the entries of a history iterator modified between from and to inclusive, stopping after limit entries if limit > 0 */
+func readHistory(iterator shim.HistoryQueryIteratorInterface, from time.Time, to time.Time, limit int) ([]HistoryEntry, error) {
+	entries := []HistoryEntry{}
+	for iterator.HasNext() {
+		modification, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		timestamp := time.Unix(modification.Timestamp.GetSeconds(), int64(modification.Timestamp.GetNanos())).UTC()
+		if (!from.IsZero() && timestamp.Before(from)) || (!to.IsZero() && timestamp.After(to)) {
+			continue
+		}
+
+		entry := HistoryEntry{
+			TxID:      modification.TxId,
+			Timestamp: timestamp.Format(time.RFC3339Nano),
+			IsDelete:  modification.IsDelete,
+		}
+		if !modification.IsDelete {
+			// earlier versions are returned as written, even if they would not pass today's validation
+			record, err := decodeEmissionsRecord(modification.Value)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to decode emissions record of transaction %s: %s", modification.TxId, err.Error())
+			}
+			entry.Record = record
+			entry.SubmittedBy = record.SubmittedBy
+		}
+		entries = append(entries, entry)
+
+		if limit > 0 && len(entries) == limit {
+			break
+		}
+	}
+	return entries, nil
+}
+
+/* Query the modifications of an emissions record, only those between two RFC3339 timestamps unless they are empty, and at most limit of them unless it is 0 */
+
+func (s *EmissionsContract) GetHistory(ctx contractapi.TransactionContextInterface, recordKey string, from string, to string, limit int) ([]HistoryEntry, error) {
+	if limit < 0 {
+		return nil, fmt.Errorf("limit must be a non-negative integer, got %d", limit)
+	}
+	fromTime, err := parseHistoryTime("from", from)
+	if err != nil {
+		return nil, err
+	}
+	toTime, err := parseHistoryTime("to", to)
+	if err != nil {
+		return nil, err
+	}
+
+	iterator, err := ctx.GetStub().GetHistoryForKey(recordKey)
+	if err != nil {
+		return nil, err
+	}
+	defer iterator.Close()
+
+	return readHistory(iterator, fromTime, toTime, limit)
+}
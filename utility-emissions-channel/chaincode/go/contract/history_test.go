@@ -0,0 +1,130 @@
+package contract
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+)
+
+/* fakeHistory iterates over fixed modifications, newest first as the peer returns them; an error is returned instead of the modification at index errAt */
+type fakeHistory struct {
+	modifications []*queryresult.KeyModification
+	next          int
+	errAt         int
+}
+
+func (h *fakeHistory) HasNext() bool {
+	return h.next < len(h.modifications)
+}
+
+func (h *fakeHistory) Next() (*queryresult.KeyModification, error) {
+	if h.next == h.errAt {
+		return nil, errors.New("iterator failed")
+	}
+	h.next++
+	return h.modifications[h.next-1], nil
+}
+
+func (h *fakeHistory) Close() error {
+	return nil
+}
+
+func newFakeHistory() *fakeHistory {
+	modification := func(txID string, seconds int64, nanos int32, value string) *queryresult.KeyModification {
+		return &queryresult.KeyModification{TxId: txID, Timestamp: &timestamp.Timestamp{Seconds: seconds, Nanos: nanos}, IsDelete: value == "", Value: []byte(value)}
+	}
+	return &fakeHistory{errAt: -1, modifications: []*queryresult.KeyModification{
+		modification("tx4", 1583020800, 0, `{"class": "`+emissionsRecordClass+`", "uuid": "key", "emissionsAmount": 0.7, "submittedBy": "Org2MSP"}`),
+		modification("tx3", 1580515200, 500000000, ""),
+		modification("tx2", 1580515200, 0, `{"uuid": "key", "emissionsAmount": 0.65, "submittedBy": "Org1MSP"}`),
+		modification("tx1", 1577836800, 0, `{"class": "`+emissionsRecordClass+`", "uuid": "key", "emissionsAmount": 0.6328, "submittedBy": "Org1MSP"}`),
+	}}
+}
+
+func TestReadHistory(t *testing.T) {
+	at := func(value string) time.Time {
+		t, _ := time.Parse(time.RFC3339Nano, value)
+		return t
+	}
+	tests := []struct {
+		name  string
+		from  time.Time
+		to    time.Time
+		limit int
+		want  string
+	}{
+		{"every entry in the order of the iterator", time.Time{}, time.Time{}, 0, "tx4,tx3,tx2,tx1"},
+		{"bounds are inclusive", at("2020-02-01T00:00:00Z"), at("2020-03-01T00:00:00Z"), 0, "tx4,tx3,tx2"},
+		{"bounds compare sub-second timestamps", at("2020-02-01T00:00:00.5Z"), at("2020-02-01T00:00:00.5Z"), 0, "tx3"},
+		{"only a from bound", at("2020-02-15T00:00:00Z"), time.Time{}, 0, "tx4"},
+		{"only a to bound", time.Time{}, at("2020-01-31T00:00:00Z"), 0, "tx1"},
+		{"the limit counts the entries in the bounds", time.Time{}, at("2020-02-01T00:00:00.5Z"), 2, "tx3,tx2"},
+		{"no entries in the bounds", at("2021-01-01T00:00:00Z"), time.Time{}, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := readHistory(newFakeHistory(), tt.from, tt.to, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			txIDs := []string{}
+			for _, entry := range entries {
+				txIDs = append(txIDs, entry.TxID)
+			}
+			if got := strings.Join(txIDs, ","); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	entries, err := readHistory(newFakeHistory(), time.Time{}, time.Time{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := entries[0]; e.Timestamp != "2020-03-01T00:00:00Z" || e.IsDelete || e.Record == nil || e.Record.EmissionsAmount != 0.7 || e.SubmittedBy != "Org2MSP" {
+		t.Errorf("got entry %+v", e)
+	}
+	if e := entries[1]; e.Timestamp != "2020-02-01T00:00:00.5Z" || !e.IsDelete || e.Record != nil || e.SubmittedBy != "" {
+		t.Errorf("got delete entry %+v", e)
+	}
+	// a record written before records had a class is still returned as written
+	if e := entries[2]; e.Record == nil || e.Record.EmissionsAmount != 0.65 || e.SubmittedBy != "Org1MSP" {
+		t.Errorf("got classless entry %+v", e)
+	}
+}
+
+func TestReadHistoryErrors(t *testing.T) {
+	history := newFakeHistory()
+	history.errAt = 2
+	if _, err := readHistory(history, time.Time{}, time.Time{}, 0); err == nil || err.Error() != "iterator failed" {
+		t.Errorf("a failed iterator returned %v", err)
+	}
+
+	history = newFakeHistory()
+	history.modifications[2].Value = []byte(`{"class": "` + utilityLookupItemClass + `", "uuid": "key"}`)
+	if _, err := readHistory(history, time.Time{}, time.Time{}, 0); err == nil || !strings.Contains(err.Error(), "of transaction tx2") {
+		t.Errorf("a version that is not a record returned %v", err)
+	}
+
+	stub := newTestStub(t)
+	tests := []struct {
+		args    []string
+		wantErr string
+	}{
+		{[]string{}, "Incorrect number of params"},
+		{[]string{"key", "2020-01-01", "", ""}, "from must be an RFC3339 timestamp"},
+		{[]string{"key", "", "yesterday", ""}, "to must be an RFC3339 timestamp"},
+		{[]string{"key", "", "", "-1"}, "limit must be a non-negative integer"},
+	}
+	for _, tt := range tests {
+		response := stub.MockInvoke("tx", toByteArgs("getHistory", tt.args...))
+		if response.Status == shim.OK || !strings.Contains(response.Message, tt.wantErr) {
+			t.Errorf("getHistory%q returned %d %q, want an error containing %q", tt.args, response.Status, response.Message, tt.wantErr)
+		}
+	}
+}
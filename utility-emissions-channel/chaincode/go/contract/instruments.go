@@ -0,0 +1,466 @@
+// Contractual instruments and market-based Scope 2 emissions in Golang
+
+package contract
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"emissions/events"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/* class identifier of contractual instruments */
+const contractualInstrumentClass = "org.hyperledger.blockchain-carbon-accounting.contractualinstrument"
+
+/* composite key index of the instruments of a party */
+const instrumentPartyIndex = "partyId~instrumentId"
+
+/* instrument types: renewable energy certificates, guarantees of origin, power purchase agreements and green tariffs */
+const (
+	instrumentTypeREC         = "REC"
+	instrumentTypeGO          = "GO"
+	instrumentTypePPA         = "PPA"
+	instrumentTypeGreenTariff = "GREEN_TARIFF"
+)
+
+/* an instrument is registered active, and only applied to energy use once retired */
+const (
+	instrumentStatusActive  = "ACTIVE"
+	instrumentStatusRetired = "RETIRED"
+)
+
+// InstrumentAllocation is the volume of an instrument applied to the energy use of an emissions record, in the volume UOM of the instrument
+type InstrumentAllocation struct {
+	RecordKey string  `json:"recordKey"`
+	Volume    float64 `json:"volume"`
+}
+
+// ContractualInstrument is an energy attribute certificate or contract held by a party.
+// Once retired, its volume is applied at its emissions rate to the energy use of the records of the party in its vintage year,
+// until its allocations use it up.
+type ContractualInstrument struct {
+	Class            string                 `json:"class"`
+	InstrumentID     string                 `json:"instrumentId"`
+	InstrumentType   string                 `json:"instrumentType"`
+	PartyID          string                 `json:"partyId"`
+	GeneratorID      string                 `json:"generatorId"`
+	GeneratorName    string                 `json:"generatorName"`
+	EnergySource     string                 `json:"energySource"`
+	Country          string                 `json:"country"`
+	Vintage          int                    `json:"vintage"`
+	Volume           float64                `json:"volume"`
+	VolumeUom        string                 `json:"volumeUom"`
+	EmissionsRate    float64                `json:"emissionsRate"`
+	EmissionsRateUom string                 `json:"emissionsRateUom,omitempty" metadata:",optional"`
+	Status           string                 `json:"status"`
+	RetiredAt        string                 `json:"retiredAt,omitempty" metadata:",optional"`
+	Allocations      []InstrumentAllocation `json:"allocations"`
+	SubmittedBy      string                 `json:"submittedBy,omitempty" metadata:",optional"`
+}
+
+// InstrumentResult is one entry of getInstrumentsByParty, in the same shape as the Node chaincode returns
+type InstrumentResult struct {
+	Key    string                 `json:"Key"`
+	Record *ContractualInstrument `json:"Record"`
+}
+
+// AppliedInstrument is the energy use of a record an instrument covers and its emissions at the rate of the instrument, in the UOMs of the record
+type AppliedInstrument struct {
+	InstrumentID    string  `json:"instrumentId"`
+	InstrumentType  string  `json:"instrumentType"`
+	EnergyUseAmount float64 `json:"energyUseAmount"`
+	EmissionsAmount float64 `json:"emissionsAmount"`
+}
+
+// MarketBasedEmissions is the market-based Scope 2 emissions of a record: the energy use covered by retired instruments at their
+// emissions rates, and the rest at the residual mix factor of the utility's division, or at its grid average factor if it has none.
+type MarketBasedEmissions struct {
+	EmissionsAmount            float64             `json:"emissionsAmount"`
+	EmissionsUom               string              `json:"emissionsUom"`
+	InstrumentsEnergyUseAmount float64             `json:"instrumentsEnergyUseAmount"`
+	ResidualEnergyUseAmount    float64             `json:"residualEnergyUseAmount"`
+	ResidualFactorSource       string              `json:"residualFactorSource,omitempty" metadata:",optional"`
+	Instruments                []AppliedInstrument `json:"instruments"`
+}
+
+/* Validate normalizes the instrument and checks it before it is written to the ledger */
+func (i *ContractualInstrument) Validate() error {
+	i.InstrumentType = strings.ToUpper(strings.TrimSpace(i.InstrumentType))
+	required := []struct{ name, value string }{
+		{"instrumentId", i.InstrumentID},
+		{"instrumentType", i.InstrumentType},
+		{"partyId", i.PartyID},
+		{"generatorId", i.GeneratorID},
+		{"volumeUom", i.VolumeUom},
+	}
+	for _, field := range required {
+		if strings.TrimSpace(field.value) == "" {
+			return fmt.Errorf("instrument %s must be a non-empty string", field.name)
+		}
+	}
+	if strings.Contains(i.InstrumentID, "\x00") || strings.Contains(i.PartyID, "\x00") {
+		return fmt.Errorf("instrument keys must not contain U+0000")
+	}
+	switch i.InstrumentType {
+	case instrumentTypeREC, instrumentTypeGO, instrumentTypePPA, instrumentTypeGreenTariff:
+	default:
+		return fmt.Errorf("instrument instrumentType must be REC, GO, PPA or GREEN_TARIFF, got %q", i.InstrumentType)
+	}
+	if i.Vintage < 1000 || i.Vintage > 9999 {
+		return fmt.Errorf("instrument vintage must be a 4 digit year, got %d", i.Vintage)
+	}
+	if i.Volume <= 0 {
+		return fmt.Errorf("instrument volume must be positive")
+	}
+	if unit, err := lookupUom(i.VolumeUom); err != nil {
+		return err
+	} else if unit.dimension != uomDimensionEnergy {
+		return fmt.Errorf("instrument volumeUom %s is not an energy unit", i.VolumeUom)
+	}
+	if i.EmissionsRate < 0 {
+		return fmt.Errorf("instrument emissionsRate must not be negative")
+	}
+	if i.EmissionsRate > 0 {
+		if _, err := uomConversionFactor(i.EmissionsRateUom, emissionsUomTons+"/"+i.VolumeUom); err != nil {
+			return fmt.Errorf("instrument emissionsRateUom must be a mass per energy unit such as TONS/MWH: %s", err.Error())
+		}
+	}
+	switch i.Status {
+	case instrumentStatusActive, instrumentStatusRetired:
+	default:
+		return fmt.Errorf("instrument status must be ACTIVE or RETIRED, got %q", i.Status)
+	}
+	return nil
+}
+
+/* appliesTo tells whether the retired instrument can cover energy use of the utility reported in year; the countries must match when both are known */
+func (i *ContractualInstrument) appliesTo(item *UtilityLookupItem, year int) bool {
+	if i.Status != instrumentStatusRetired || i.Vintage != year {
+		return false
+	}
+	return i.Country == "" || item.Country == "" || strings.EqualFold(i.Country, item.Country)
+}
+
+/* availableVolume is the volume of the instrument that the allocations leave, in its volume UOM */
+func (i *ContractualInstrument) availableVolume(allocations []InstrumentAllocation) (*big.Rat, error) {
+	available, err := ratFromFloat(i.Volume)
+	if err != nil {
+		return nil, err
+	}
+	for _, allocation := range allocations {
+		volume, err := ratFromFloat(allocation.Volume)
+		if err != nil {
+			return nil, err
+		}
+		available.Sub(available, volume)
+	}
+	return available, nil
+}
+
+/* getInstrumentState reads an instrument by its id; it returns nil if the instrument does not exist */
+func getInstrumentState(APIstub shim.ChaincodeStubInterface, instrumentID string) (*ContractualInstrument, error) {
+	instrumentAsBytes, err := APIstub.GetState(instrumentID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get instrument %s: %s", instrumentID, err.Error())
+	} else if instrumentAsBytes == nil {
+		return nil, nil
+	}
+	instrument := &ContractualInstrument{}
+	if err := json.Unmarshal(instrumentAsBytes, instrument); err != nil {
+		return nil, fmt.Errorf("Failed to decode instrument %s: %s", instrumentID, err.Error())
+	} else if instrument.Class != contractualInstrumentClass {
+		return nil, fmt.Errorf("%s is not a contractual instrument", instrumentID)
+	}
+	return instrument, nil
+}
+
+/* putInstrument writes the instrument under its id */
+func putInstrument(APIstub shim.ChaincodeStubInterface, instrument *ContractualInstrument) ([]byte, error) {
+	instrumentAsBytes, err := json.Marshal(instrument)
+	if err != nil {
+		return nil, err
+	}
+	return instrumentAsBytes, APIstub.PutState(instrument.InstrumentID, instrumentAsBytes)
+}
+
+/* queryInstrumentsByParty range scans the party index; the instruments are in the order of their ids */
+func queryInstrumentsByParty(APIstub shim.ChaincodeStubInterface, partyID string) ([]*ContractualInstrument, error) {
+	resultsIterator, err := APIstub.GetStateByPartialCompositeKey(instrumentPartyIndex, []string{partyID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	instruments := []*ContractualInstrument{}
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, compositeKeyParts, err := APIstub.SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return nil, err
+		}
+		instrumentID := compositeKeyParts[1]
+		instrument, err := getInstrumentState(APIstub, instrumentID)
+		if err != nil {
+			return nil, err
+		} else if instrument == nil {
+			return nil, fmt.Errorf("Instrument %s is indexed but does not exist", instrumentID)
+		}
+		instruments = append(instruments, instrument)
+	}
+	return instruments, nil
+}
+
+/* releaseAllocations removes the allocations to the record stored under key from the instruments of the party, so their volume can cover other records */
+func releaseAllocations(APIstub shim.ChaincodeStubInterface, key string, partyID string) error {
+	instruments, err := queryInstrumentsByParty(APIstub, partyID)
+	if err != nil {
+		return err
+	}
+	for _, instrument := range instruments {
+		allocations := []InstrumentAllocation{}
+		for _, allocation := range instrument.Allocations {
+			if allocation.RecordKey != key {
+				allocations = append(allocations, allocation)
+			}
+		}
+		if len(allocations) == len(instrument.Allocations) {
+			continue
+		}
+		instrument.Allocations = allocations
+		if _, err := putInstrument(APIstub, instrument); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/* getMarketBasedEmissions applies the retired instruments of the party to the energy use of the record stored under key, replacing what they covered of an earlier version of it, and returns the instruments whose allocations changed */
+func getMarketBasedEmissions(APIstub shim.ChaincodeStubInterface, key string, record *EmissionsRecord, item *UtilityLookupItem, year int, locationFactor *UtilityEmissionsFactors, locationFactorSource string, gwp *GWPSet) (*MarketBasedEmissions, []*ContractualInstrument, error) {
+	remaining, err := ratFromFloat(record.EnergyUseAmount)
+	if err != nil {
+		return nil, nil, err
+	}
+	emissions := new(big.Rat)
+	covered := new(big.Rat)
+	marketBased := &MarketBasedEmissions{EmissionsUom: emissionsUomTons, Instruments: []AppliedInstrument{}}
+
+	instruments, err := queryInstrumentsByParty(APIstub, record.PartyID)
+	if err != nil {
+		return nil, nil, err
+	}
+	changed := []*ContractualInstrument{}
+	for _, instrument := range instruments {
+		allocations := []InstrumentAllocation{}
+		for _, allocation := range instrument.Allocations {
+			if allocation.RecordKey != key {
+				allocations = append(allocations, allocation)
+			}
+		}
+		released := len(allocations) != len(instrument.Allocations)
+
+		applied := false
+		if remaining.Sign() > 0 && instrument.appliesTo(item, year) {
+			available, err := instrument.availableVolume(allocations)
+			if err != nil {
+				return nil, nil, err
+			}
+			if available.Sign() > 0 {
+				use, err := convertRat(available, instrument.VolumeUom, record.EnergyUseUom)
+				if err != nil {
+					return nil, nil, err
+				}
+				if use.Cmp(remaining) > 0 {
+					use.Set(remaining)
+				}
+				volume, err := convertRat(use, record.EnergyUseUom, instrument.VolumeUom)
+				if err != nil {
+					return nil, nil, err
+				}
+				instrumentEmissions := new(big.Rat)
+				if instrument.EmissionsRate > 0 {
+					rate, err := ratFromFloat(instrument.EmissionsRate)
+					if err != nil {
+						return nil, nil, err
+					}
+					rate, err = convertRat(rate, instrument.EmissionsRateUom, emissionsUomTons+"/"+record.EnergyUseUom)
+					if err != nil {
+						return nil, nil, err
+					}
+					instrumentEmissions.Mul(rate, use)
+				}
+				emissions.Add(emissions, instrumentEmissions)
+				covered.Add(covered, use)
+				remaining.Sub(remaining, use)
+
+				volumeAmount, _ := volume.Float64()
+				useAmount, _ := use.Float64()
+				emissionsAmount, _ := instrumentEmissions.Float64()
+				allocations = append(allocations, InstrumentAllocation{RecordKey: key, Volume: volumeAmount})
+				marketBased.Instruments = append(marketBased.Instruments, AppliedInstrument{
+					InstrumentID: instrument.InstrumentID, InstrumentType: instrument.InstrumentType, EnergyUseAmount: useAmount, EmissionsAmount: emissionsAmount})
+				applied = true
+			}
+		}
+		if released || applied {
+			instrument.Allocations = allocations
+			changed = append(changed, instrument)
+		}
+	}
+
+	if remaining.Sign() > 0 {
+		residualFactor, err := getEmissionsFactorForItem(APIstub, item, year, factorTypeResidualMix)
+		if err != nil {
+			return nil, nil, err
+		}
+		marketBased.ResidualFactorSource = locationFactorSource
+		if residualFactor != nil {
+			marketBased.ResidualFactorSource = fmt.Sprintf("Residual mix %s %s %s", residualFactor.Year, residualFactor.DivisionType, residualFactor.DivisionId)
+		} else {
+			residualFactor = locationFactor
+		}
+		residualUse, _ := remaining.Float64()
+		residualEmissions, err := getCO2Emissions(residualFactor, residualUse, record.EnergyUseUom, gwp)
+		if err != nil {
+			return nil, nil, err
+		}
+		residualEmissionsRat, err := ratFromFloat(residualEmissions.EmissionsAmount)
+		if err != nil {
+			return nil, nil, err
+		}
+		emissions.Add(emissions, residualEmissionsRat)
+	}
+
+	marketBased.EmissionsAmount, _ = emissions.Float64()
+	marketBased.InstrumentsEnergyUseAmount, _ = covered.Float64()
+	marketBased.ResidualEnergyUseAmount, _ = remaining.Float64()
+	return marketBased, changed, nil
+}
+
+/* Register a contractual instrument held by a party; an emissions rate of 0 needs no emissionsRateUom */
+
+func (s *EmissionsContract) RegisterInstrument(ctx contractapi.TransactionContextInterface, instrumentId string, instrumentType string, partyId string,
+	generatorId string, generatorName string, energySource string, country string, vintage int, volume float64, volumeUom string,
+	emissionsRate float64, emissionsRateUom string) (*ContractualInstrument, error) {
+	APIstub := ctx.GetStub()
+	instrument := &ContractualInstrument{
+		Class:            contractualInstrumentClass,
+		InstrumentID:     strings.TrimSpace(instrumentId),
+		InstrumentType:   instrumentType,
+		PartyID:          partyId,
+		GeneratorID:      generatorId,
+		GeneratorName:    generatorName,
+		EnergySource:     energySource,
+		Country:          country,
+		Vintage:          vintage,
+		Volume:           volume,
+		VolumeUom:        volumeUom,
+		EmissionsRate:    emissionsRate,
+		EmissionsRateUom: emissionsRateUom,
+		Status:           instrumentStatusActive,
+		Allocations:      []InstrumentAllocation{},
+	}
+	if err := instrument.Validate(); err != nil {
+		return nil, err
+	}
+	var err error
+	if instrument.SubmittedBy, err = submittingMSP(APIstub); err != nil {
+		return nil, err
+	}
+
+	existingAsBytes, err := APIstub.GetState(instrument.InstrumentID)
+	if err != nil {
+		return nil, err
+	} else if existingAsBytes != nil {
+		return nil, fmt.Errorf("This key already exists: %s", instrument.InstrumentID)
+	}
+	instrumentAsBytes, err := putInstrument(APIstub, instrument)
+	if err != nil {
+		return nil, err
+	}
+	indexKey, err := APIstub.CreateCompositeKey(instrumentPartyIndex, []string{instrument.PartyID, instrument.InstrumentID})
+	if err != nil {
+		return nil, err
+	}
+	//  Only the key name is needed, passing a 'nil' value would delete the key, therefore we pass null character as value
+	if err := APIstub.PutState(indexKey, []byte{0x00}); err != nil {
+		return nil, err
+	}
+
+	err = setEvent(APIstub, events.InstrumentRegistered, events.InstrumentData{Key: instrument.InstrumentID, Instrument: instrumentAsBytes})
+	if err != nil {
+		return nil, err
+	}
+	return instrument, nil
+}
+
+/* Retire a contractual instrument on behalf of its party, so it is applied to the market-based emissions of its records.
+   Only the MSP that registered the instrument may retire it. Records already written are not recomputed; the instrument is applied when they are recorded again. */
+
+func (s *EmissionsContract) RetireInstrument(ctx contractapi.TransactionContextInterface, instrumentId string) (*ContractualInstrument, error) {
+	APIstub := ctx.GetStub()
+	instrument, err := getInstrumentState(APIstub, instrumentId)
+	if err != nil {
+		return nil, err
+	} else if instrument == nil {
+		return nil, fmt.Errorf("Instrument does not exist: %s", instrumentId)
+	} else if instrument.Status == instrumentStatusRetired {
+		return nil, fmt.Errorf("Instrument %s was already retired at %s", instrument.InstrumentID, instrument.RetiredAt)
+	}
+	mspID, err := submittingMSP(APIstub)
+	if err != nil {
+		return nil, err
+	} else if mspID != instrument.SubmittedBy {
+		return nil, fmt.Errorf("Instrument %s was registered by %s, it cannot be retired by %s", instrument.InstrumentID, instrument.SubmittedBy, mspID)
+	}
+
+	txTimestamp, err := APIstub.GetTxTimestamp()
+	if err != nil {
+		return nil, err
+	}
+	instrument.Status = instrumentStatusRetired
+	instrument.RetiredAt = time.Unix(txTimestamp.GetSeconds(), int64(txTimestamp.GetNanos())).UTC().Format(time.RFC3339)
+	instrumentAsBytes, err := putInstrument(APIstub, instrument)
+	if err != nil {
+		return nil, err
+	}
+
+	err = setEvent(APIstub, events.InstrumentRetired, events.InstrumentData{Key: instrument.InstrumentID, Instrument: instrumentAsBytes})
+	if err != nil {
+		return nil, err
+	}
+	return instrument, nil
+}
+
+/* Query a contractual instrument */
+
+func (s *EmissionsContract) GetInstrument(ctx contractapi.TransactionContextInterface, instrumentId string) (*ContractualInstrument, error) {
+	instrument, err := getInstrumentState(ctx.GetStub(), instrumentId)
+	if err != nil {
+		return nil, err
+	} else if instrument == nil {
+		return nil, fmt.Errorf("Instrument does not exist: %s", instrumentId)
+	}
+	return instrument, nil
+}
+
+/* Query the contractual instruments of a party */
+
+func (s *EmissionsContract) GetInstrumentsByParty(ctx contractapi.TransactionContextInterface, partyId string) ([]InstrumentResult, error) {
+	instruments, err := queryInstrumentsByParty(ctx.GetStub(), partyId)
+	if err != nil {
+		return nil, err
+	}
+	results := []InstrumentResult{}
+	for _, instrument := range instruments {
+		results = append(results, InstrumentResult{Key: instrument.InstrumentID, Record: instrument})
+	}
+	return results, nil
+}
@@ -0,0 +1,206 @@
+package contract
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"emissions/events"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+func TestMarketBasedEmissions(t *testing.T) {
+	stub := newTestStub(t)
+	mustInvoke(t, stub, "importUtilityIdentifier", `{"uuid":"USA_EIA_11208","year":"2019","utility_number":"11208","utility_name":"Los Angeles Department of Water & Power","country":"USA","state_province":"CA"}`)
+	mustInvoke(t, stub, "importUtilityIdentifier", `{"uuid":"USA_EIA_13407","year":"2019","utility_number":"13407","utility_name":"Nevada Power Co","country":"USA","state_province":"NV"}`)
+	mustInvoke(t, stub, "importUtilityFactor", utilityFactorJSON("USA_2020_STATE_CA", "2020", "STATE", "CA", 50, ""))
+	mustInvoke(t, stub, "importUtilityFactor", utilityFactorJSON("USA_2020_STATE_CA_RESIDUAL", "2020", "STATE", "CA", 60, `"factorType":"RESIDUAL_MIX"`))
+	mustInvoke(t, stub, "importUtilityFactor", utilityFactorJSON("USA_2020_STATE_NV", "2020", "STATE", "NV", 40, ""))
+
+	//                                                   instrumentId, instrumentType, partyId, generatorId, generatorName, energySource, country, vintage, volume, volumeUom, emissionsRate, emissionsRateUom
+	mustInvoke(t, stub, "registerInstrument", "REC-1", "rec", "MyCompany", "GEN-1", "Wind Farm", "wind", "USA", "2020", "1", "MWH", "0", "")
+	mustInvoke(t, stub, "registerInstrument", "PPA-2", "PPA", "MyCompany", "GEN-2", "Gas Plant", "gas", "USA", "2020", "500", "KWH", "0.1", "TONS/MWH")
+	mustInvoke(t, stub, "registerInstrument", "GO-2019", "GO", "MyCompany", "GEN-3", "Hydro Plant", "hydro", "Norway", "2019", "10", "MWH", "0", "")
+	mustInvoke(t, stub, "registerInstrument", "GO-NO", "GO", "MyCompany", "GEN-3", "Hydro Plant", "hydro", "Norway", "2020", "10", "MWH", "0", "")
+	for _, instrumentID := range []string{"PPA-2", "GO-2019", "GO-NO"} {
+		mustInvoke(t, stub, "retireInstrument", instrumentID)
+	}
+
+	record := func(utilityID string, fromDate string, thruDate string, energyUseAmount float64) EmissionsRecord {
+		record := EmissionsRecord{}
+		if err := json.Unmarshal(mustInvoke(t, stub, "recordEmissions", calcInputJSON(utilityID, "MyCompany", fromDate, thruDate, energyUseAmount, "KWH"), "", "", ""), &record); err != nil {
+			t.Fatal(err)
+		}
+		return record
+	}
+
+	// REC-1 is not retired yet, so the PPA covers 500 kWh and the residual mix the rest
+	january := record("USA_EIA_11208", "2020-01-01", "2020-01-31", 1650)
+	if !closeTo(january.EmissionsAmount, 0.825) || january.MarketBased == nil || !closeTo(january.MarketBased.EmissionsAmount, 0.05+0.69) ||
+		!closeTo(january.MarketBased.ResidualEnergyUseAmount, 1150) || january.MarketBased.ResidualFactorSource != "Residual mix 2020 STATE CA" {
+		t.Errorf("got location-based %v and market-based %+v", january.EmissionsAmount, january.MarketBased)
+	}
+
+	// once retired, REC-1 covers 1000 kWh more when January is recorded again; the PPA is not counted twice
+	mustInvoke(t, stub, "retireInstrument", "REC-1")
+	if event := lastEvent(t, stub); event.Type != events.InstrumentRetired {
+		t.Errorf("got event %s, want %s", event.Type, events.InstrumentRetired)
+	} else if data, err := event.InstrumentData(); err != nil || data.Key != "REC-1" {
+		t.Errorf("InstrumentData() = %+v, %v", data, err)
+	}
+	january = record("USA_EIA_11208", "2020-01-01", "2020-01-31", 1650)
+	if !closeTo(january.MarketBased.EmissionsAmount, 0.05+0.09) || !closeTo(january.MarketBased.InstrumentsEnergyUseAmount, 1500) || len(january.MarketBased.Instruments) != 2 {
+		t.Errorf("got market-based %+v", january.MarketBased)
+	}
+
+	// the instruments are used up, so February is all residual mix
+	february := record("USA_EIA_11208", "2020-02-01", "2020-02-29", 1000)
+	if !closeTo(february.MarketBased.EmissionsAmount, 0.6) || len(february.MarketBased.Instruments) != 0 {
+		t.Errorf("got market-based %+v", february.MarketBased)
+	}
+
+	// without a residual mix factor, the grid average factor applies
+	nevada := record("USA_EIA_13407", "2020-01-01", "2020-01-31", 1000)
+	if !closeTo(nevada.MarketBased.EmissionsAmount, 0.4) || nevada.MarketBased.ResidualFactorSource != nevada.FactorSource {
+		t.Errorf("got market-based %+v", nevada.MarketBased)
+	}
+
+	instrument := ContractualInstrument{}
+	if err := json.Unmarshal(mustInvoke(t, stub, "getInstrument", "REC-1"), &instrument); err != nil {
+		t.Fatal(err)
+	}
+	if instrument.Status != instrumentStatusRetired || instrument.RetiredAt == "" || instrument.InstrumentType != instrumentTypeREC ||
+		len(instrument.Allocations) != 1 || instrument.Allocations[0].RecordKey != january.UUID || !closeTo(instrument.Allocations[0].Volume, 1) {
+		t.Errorf("got instrument %+v", instrument)
+	}
+	instruments := []InstrumentResult{}
+	if err := json.Unmarshal(mustInvoke(t, stub, "getInstrumentsByParty", "MyCompany"), &instruments); err != nil {
+		t.Fatal(err)
+	}
+	if len(instruments) != 4 {
+		t.Errorf("got %d instruments of MyCompany, want 4", len(instruments))
+	}
+
+	totals := EmissionsTotals{}
+	if err := json.Unmarshal(mustInvoke(t, stub, "getEmissionsTotals", "MyCompany", "2020-01-01", "2020-12-31", "utility"), &totals); err != nil {
+		t.Fatal(err)
+	}
+	if !closeTo(totals.Total.EmissionsAmount, 0.825+0.5+0.4) || !closeTo(totals.Total.MarketBasedEmissionsAmount, 0.14+0.6+0.4) {
+		t.Errorf("got totals %+v", totals.Total)
+	}
+
+	tests := []struct {
+		name     string
+		function string
+		args     []string
+		wantErr  string
+	}{
+		{"unknown type", "registerInstrument", []string{"I-1", "CERT", "MyCompany", "GEN-1", "", "", "", "2020", "1", "MWH", "0", ""}, "instrumentType must be"},
+		{"volume not energy", "registerInstrument", []string{"I-1", "REC", "MyCompany", "GEN-1", "", "", "", "2020", "1", "TONS", "0", ""}, "is not an energy unit"},
+		{"rate without its unit", "registerInstrument", []string{"I-1", "PPA", "MyCompany", "GEN-1", "", "", "", "2020", "1", "MWH", "0.1", ""}, "emissionsRateUom must be"},
+		{"two digit vintage", "registerInstrument", []string{"I-1", "REC", "MyCompany", "GEN-1", "", "", "", "20", "1", "MWH", "0", ""}, "vintage must be"},
+		{"existing key", "registerInstrument", []string{"REC-1", "REC", "MyCompany", "GEN-1", "", "", "", "2020", "1", "MWH", "0", ""}, "already exists"},
+		{"retired twice", "retireInstrument", []string{"REC-1"}, "was already retired"},
+		{"not an instrument", "getInstrument", []string{"USA_2020_STATE_CA"}, "is not a contractual instrument"},
+		{"unknown factor type", "importUtilityFactor", []string{utilityFactorJSON("F", "2020", "STATE", "CA", 50, `"factorType":"MARGINAL"`)}, "factorType must be"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := stub.MockInvoke("tx", toByteArgs(tt.function, tt.args...))
+			if response.Status == shim.OK || !strings.Contains(response.Message, tt.wantErr) {
+				t.Errorf("got %d %q, want an error containing %q", response.Status, response.Message, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRetireInstrument(t *testing.T) {
+	stub := newTestStub(t)
+	mustInvoke(t, stub, "importUtilityIdentifier", `{"uuid":"USA_EIA_11208","year":"2019","utility_number":"11208","utility_name":"Los Angeles Department of Water & Power","country":"USA","state_province":"CA"}`)
+	mustInvoke(t, stub, "importUtilityFactor", utilityFactorJSON("USA_2020_STATE_CA", "2020", "STATE", "CA", 50, ""))
+	mustInvoke(t, stub, "registerInstrument", "REC-1", "REC", "MyCompany", "GEN-1", "Wind Farm", "wind", "USA", "2020", "1", "MWH", "0", "")
+	mustInvoke(t, stub, "registerInstrument", "REC-2", "REC", "MyCompany", "GEN-1", "Wind Farm", "wind", "USA", "2020", "1", "MWH", "0", "")
+	january := EmissionsRecord{}
+	if err := json.Unmarshal(mustInvoke(t, stub, "recordEmissions", calcInputJSON("USA_EIA_11208", "MyCompany", "2020-01-01", "2020-01-31", 1650, "KWH"), "", "", ""), &january); err != nil {
+		t.Fatal(err)
+	}
+	mustInvoke(t, stub, "recordEmissions", calcInputJSON("USA_EIA_11208", "MyCompany", "2020-02-01", "2020-02-29", 1650, "KWH"), "", "", "")
+	february := emissionsRecordID("USA_EIA_11208", "MyCompany", "2020-02-01", "2020-02-29")
+	mustInvoke(t, stub, "tokenizeEmissionsRecords", "12", testIssuer, `["`+february+`"]`)
+
+	// an auditor of another MSP cannot retire the instruments of Org1MSP
+	if err := stub.SetIdentity("Org2MSP", map[string]string{"role": "auditor"}); err != nil {
+		t.Fatal(err)
+	}
+	response := stub.MockInvoke("tx", toByteArgs("retireInstrument", "REC-1"))
+	if response.Status == shim.OK || !strings.Contains(response.Message, "registered by Org1MSP, it cannot be retired by Org2MSP") {
+		t.Errorf("retireInstrument by Org2MSP returned %d %q", response.Status, response.Message)
+	}
+	if err := stub.SetIdentity("Org1MSP", map[string]string{"role": "auditor"}); err != nil {
+		t.Fatal(err)
+	}
+	mustInvoke(t, stub, "retireInstrument", "REC-1")
+
+	// the records written before are unchanged until they are recorded again
+	stored := EmissionsRecord{}
+	if err := json.Unmarshal(mustInvoke(t, stub, "getEmissionRecord", january.UUID), &stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.MarketBased == nil || len(stored.MarketBased.Instruments) != 0 || !closeTo(stored.MarketBased.EmissionsAmount, 0.825) {
+		t.Errorf("got market-based %+v before recording again", stored.MarketBased)
+	}
+	if err := json.Unmarshal(mustInvoke(t, stub, "recordEmissions", calcInputJSON("USA_EIA_11208", "MyCompany", "2020-01-01", "2020-01-31", 1650, "KWH"), "", "", ""), &stored); err != nil {
+		t.Fatal(err)
+	}
+	if len(stored.MarketBased.Instruments) != 1 || !closeTo(stored.MarketBased.EmissionsAmount, 0.325) {
+		t.Errorf("got market-based %+v after recording again", stored.MarketBased)
+	}
+
+	// a tokenized record cannot take up a newly retired instrument, as its market-based emissions would change
+	mustInvoke(t, stub, "retireInstrument", "REC-2")
+	response = stub.MockInvoke("tx", toByteArgs("recordEmissions", calcInputJSON("USA_EIA_11208", "MyCompany", "2020-02-01", "2020-02-29", 1650, "KWH"), "", "", ""))
+	if response.Status == shim.OK || !strings.Contains(response.Message, "amounts cannot change") {
+		t.Errorf("recording a tokenized record again returned %d %q", response.Status, response.Message)
+	}
+}
+
+func TestReplacedRecordReleasesInstruments(t *testing.T) {
+	stub := newTestStub(t)
+	mustInvoke(t, stub, "importUtilityIdentifier", `{"uuid":"USA_EIA_11208","year":"2019","utility_number":"11208","utility_name":"Los Angeles Department of Water & Power","country":"USA","state_province":"CA"}`)
+	mustInvoke(t, stub, "importUtilityFactor", utilityFactorJSON("USA_2020_STATE_CA", "2020", "STATE", "CA", 50, ""))
+	mustInvoke(t, stub, "registerInstrument", "REC-1", "REC", "MyCompany", "GEN-1", "Wind Farm", "wind", "USA", "2020", "1", "MWH", "0", "")
+	mustInvoke(t, stub, "retireInstrument", "REC-1")
+
+	january := calcInputJSON("USA_EIA_11208", "MyCompany", "2020-01-01", "2020-01-31", 600, "KWH")
+	mustInvoke(t, stub, "recordEmissions", january, "", "", "")
+	remaining := func() float64 {
+		instrument := ContractualInstrument{}
+		if err := json.Unmarshal(mustInvoke(t, stub, "getInstrument", "REC-1"), &instrument); err != nil {
+			t.Fatal(err)
+		}
+		available, err := instrument.availableVolume(instrument.Allocations)
+		if err != nil {
+			t.Fatal(err)
+		}
+		volume, _ := available.Float64()
+		return volume
+	}
+	if got := remaining(); !closeTo(got, 0.4) {
+		t.Fatalf("REC-1 has %v MWH left after recording January, want 0.4", got)
+	}
+
+	// creating January again with given amounts has no market-based emissions, so REC-1 is released
+	mustInvoke(t, stub, "createEmissionRecord", january, "0.3", "TONS", "0", "600", "", "", "")
+	if got := remaining(); !closeTo(got, 1) {
+		t.Errorf("REC-1 has %v MWH left after January was created again, want 1", got)
+	}
+
+	// and covers all of February
+	february := EmissionsRecord{}
+	if err := json.Unmarshal(mustInvoke(t, stub, "recordEmissions", calcInputJSON("USA_EIA_11208", "MyCompany", "2020-02-01", "2020-02-29", 1000, "KWH"), "", "", ""), &february); err != nil {
+		t.Fatal(err)
+	}
+	if !closeTo(february.MarketBased.InstrumentsEnergyUseAmount, 1000) || !closeTo(remaining(), 0) {
+		t.Errorf("got February market-based %+v", february.MarketBased)
+	}
+}
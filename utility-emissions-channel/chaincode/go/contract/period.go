@@ -0,0 +1,103 @@
+// Billing periods of emissions records in Golang
+
+package contract
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+/* dateLayout is the ISO-8601 calendar date of record periods */
+const dateLayout = "2006-01-02"
+
+// period is the billing period of a record: the calendar days from its from date to its thru date, both included
+type period struct {
+	from time.Time
+	thru time.Time
+}
+
+/* parseISODate parses an ISO-8601 calendar date, or an RFC3339 date and time of which only the date is kept, as midnight UTC */
+func parseISODate(name string, value string) (time.Time, error) {
+	for _, layout := range []string{dateLayout, time.RFC3339} {
+		if t, err := time.Parse(layout, strings.TrimSpace(value)); err == nil {
+			return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%s must be an ISO-8601 date such as 2020-01-31, got %q", name, value)
+}
+
+/* parsePeriod parses the dates of a period and checks it does not end before it starts */
+func parsePeriod(fromDate string, thruDate string) (period, error) {
+	from, err := parseISODate("fromDate", fromDate)
+	if err != nil {
+		return period{}, err
+	}
+	thru, err := parseISODate("thruDate", thruDate)
+	if err != nil {
+		return period{}, err
+	}
+	if thru.Before(from) {
+		return period{}, fmt.Errorf("thruDate %s is before fromDate %s", thru.Format(dateLayout), from.Format(dateLayout))
+	}
+	return period{from: from, thru: thru}, nil
+}
+
+func (p period) String() string {
+	return p.from.Format(dateLayout) + " to " + p.thru.Format(dateLayout)
+}
+
+/* days counts the days of the period */
+func (p period) days() int64 {
+	return int64(p.thru.Sub(p.from).Hours()/24) + 1
+}
+
+/* overlaps tells whether two periods share at least one day */
+func (p period) overlaps(o period) bool {
+	return !p.thru.Before(o.from) && !o.thru.Before(p.from)
+}
+
+/* intersect is the days two overlapping periods share */
+func (p period) intersect(o period) period {
+	shared := p
+	if shared.from.Before(o.from) {
+		shared.from = o.from
+	}
+	if shared.thru.After(o.thru) {
+		shared.thru = o.thru
+	}
+	return shared
+}
+
+/* reportingYear is the year the period is reported and its emissions factor chosen for: the year of its thru date, as in the Node chaincode */
+func (p period) reportingYear() int {
+	return p.thru.Year()
+}
+
+/* months lists the calendar months the period has days in, as YYYY-MM */
+func (p period) months() []string {
+	months := []string{}
+	for month := time.Date(p.from.Year(), p.from.Month(), 1, 0, 0, 0, 0, time.UTC); !month.After(p.thru); month = month.AddDate(0, 1, 0) {
+		months = append(months, month.Format("2006-01"))
+	}
+	return months
+}
+
+/* split divides the period into the calendar months or years it has days in, keyed by YYYY-MM or YYYY */
+func (p period) split(groupBy string) map[string]period {
+	pieces := map[string]period{}
+	for start := p.from; !start.After(p.thru); {
+		var group string
+		var next time.Time
+		if groupBy == groupByMonth {
+			group = start.Format("2006-01")
+			next = time.Date(start.Year(), start.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		} else {
+			group = start.Format("2006")
+			next = time.Date(start.Year()+1, time.January, 1, 0, 0, 0, 0, time.UTC)
+		}
+		pieces[group] = period{from: start, thru: next.AddDate(0, 0, -1)}.intersect(p)
+		start = next
+	}
+	return pieces
+}
@@ -0,0 +1,94 @@
+package contract
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+func TestParsePeriod(t *testing.T) {
+	tests := []struct {
+		name       string
+		fromDate   string
+		thruDate   string
+		wantErr    string
+		wantDays   int64
+		wantYear   int
+		wantMonths string
+	}{
+		{"one month", "2020-01-01", "2020-01-31", "", 31, 2020, "2020-01"},
+		{"one day", "2020-02-29", "2020-02-29", "", 1, 2020, "2020-02"},
+		{"across a year end", "2019-12-15", "2020-01-14", "", 31, 2020, "2019-12,2020-01"},
+		{"RFC3339 date and time", "2020-01-01T00:00:00Z", "2020-03-01T23:59:59-05:00", "", 61, 2020, "2020-01,2020-02,2020-03"},
+		{"month 20", "2020-01-02", "2020-20-01", "thruDate must be an ISO-8601 date", 0, 0, ""},
+		{"day 30 of February", "2020-02-30", "2020-03-01", "fromDate must be an ISO-8601 date", 0, 0, ""},
+		{"slashes", "2020/01/01", "2020-01-31", "fromDate must be an ISO-8601 date", 0, 0, ""},
+		{"bare year", "2020", "2020-01-31", "fromDate must be an ISO-8601 date", 0, 0, ""},
+		{"reversed", "2020-01-31", "2020-01-01", "thruDate 2020-01-01 is before fromDate 2020-01-31", 0, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := parsePeriod(tt.fromDate, tt.thruDate)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.days() != tt.wantDays || p.reportingYear() != tt.wantYear || strings.Join(p.months(), ",") != tt.wantMonths {
+				t.Errorf("got %d days, year %d, months %v", p.days(), p.reportingYear(), p.months())
+			}
+		})
+	}
+}
+
+func TestEmissionsRecordPeriods(t *testing.T) {
+	stub := newTestStub(t)
+	// the seeded records are written with the same checks
+	mustInvoke(t, stub, "initLedger")
+	mustInvoke(t, stub, "importUtilityIdentifier", `{"uuid":"USA_EIA_11208","year":"2019","utility_number":"11208","utility_name":"Los Angeles Department of Water & Power","country":"USA","state_province":"CA"}`)
+	mustInvoke(t, stub, "importUtilityFactor", utilityFactorJSON("USA_2020_STATE_CA", "2020", "STATE", "CA", 50, ""))
+
+	recordArgs := func(partyID string, fromDate string, thruDate string) []string {
+		return []string{calcInputJSON("USA_EIA_11208", partyID, fromDate, thruDate, 1650, "KWH"), "", "", ""}
+	}
+	record := EmissionsRecord{}
+	if err := json.Unmarshal(mustInvoke(t, stub, "recordEmissions", recordArgs("MyCompany", "2019-12-15", "2020-01-14")...), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.ReportingYear != 2020 || strings.Join(record.MonthsCovered, ",") != "2019-12,2020-01" {
+		t.Errorf("got reporting year %d and months %v", record.ReportingYear, record.MonthsCovered)
+	}
+
+	tests := []struct {
+		name     string
+		function string
+		args     []string
+		wantErr  string
+	}{
+		{"reversed period", "recordEmissions", recordArgs("MyCompany", "2020-02-01", "2020-01-01"), "is before fromDate"},
+		{"invalid date", "recordEmissions", recordArgs("MyCompany", "2020-01-01", "2020-20-01"), "thruDate must be an ISO-8601 date"},
+		{"overlap of a record of the utility and party", "recordEmissions", recordArgs("MyCompany", "2020-01-14", "2020-02-13"), "overlaps record"},
+		{"overlap under another key", "createEmissionRecord", []string{calcInputJSON("USA_EIA_11208", "MyCompany", "2020-01-01", "2020-01-31", 1650, "KWH"), "0.6328", "TONS", "430", "1220", "", "", ""}, "overlaps record"},
+		{"same period recorded again", "recordEmissions", recordArgs("MyCompany", "2019-12-15", "2020-01-14"), ""},
+		{"adjacent period", "recordEmissions", recordArgs("MyCompany", "2020-01-15", "2020-02-13"), ""},
+		{"same period of another party", "recordEmissions", recordArgs("OtherCompany", "2019-12-15", "2020-01-14"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := stub.MockInvoke("tx", toByteArgs(tt.function, tt.args...))
+			if tt.wantErr == "" {
+				if response.Status != shim.OK {
+					t.Errorf("got %d %q", response.Status, response.Message)
+				}
+			} else if response.Status == shim.OK || !strings.Contains(response.Message, tt.wantErr) {
+				t.Errorf("got %d %q, want an error containing %q", response.Status, response.Message, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+// Rich queries of emissions records in Golang
+
+package contract
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// QueryResponseMetadata is the pagination info of a page of results, as in the marbles02 pagination example.
+// Bookmark is passed back to get the next page; it is empty when nothing was fetched.
+type QueryResponseMetadata struct {
+	RecordsCount string `json:"RecordsCount"`
+	Bookmark     string `json:"Bookmark"`
+}
+
+// PaginatedQueryResults is the response of a query: one page of results with its pagination info given a page size, or all of them
+type PaginatedQueryResults struct {
+	Results          []EmissionsRecordResult `json:"Results"`
+	ResponseMetadata QueryResponseMetadata   `json:"ResponseMetadata"`
+}
+
+/* emissionsRecordsQuery is a CouchDB query of the emissions records matching the selector; values are JSON encoded, so arguments cannot change the query */
+func emissionsRecordsQuery(selector map[string]interface{}) (string, error) {
+	selector["class"] = map[string]string{"$eq": emissionsRecordClass}
+	queryAsBytes, err := json.Marshal(map[string]interface{}{"selector": selector})
+	if err != nil {
+		return "", err
+	}
+	return string(queryAsBytes), nil
+}
+
+/* queryResultsFromIterator collects the records of a query iterator */
+func queryResultsFromIterator(resultsIterator shim.StateQueryIteratorInterface) ([]EmissionsRecordResult, error) {
+	results := []EmissionsRecordResult{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		record, err := decodeEmissionsRecord(queryResponse.Value)
+		if err != nil {
+			return nil, fmt.Errorf("Emissions record %s: %s", queryResponse.Key, err.Error())
+		}
+		results = append(results, EmissionsRecordResult{Key: queryResponse.Key, Record: record})
+	}
+	return results, nil
+}
+
+/* paginatedQueryResults adds the pagination info of a page to its results */
+func paginatedQueryResults(resultsIterator shim.StateQueryIteratorInterface, responseMetadata *pb.QueryResponseMetadata) (*PaginatedQueryResults, error) {
+	results, err := queryResultsFromIterator(resultsIterator)
+	if err != nil {
+		return nil, err
+	}
+	return &PaginatedQueryResults{
+		Results: results,
+		ResponseMetadata: QueryResponseMetadata{
+			RecordsCount: strconv.Itoa(int(responseMetadata.GetFetchedRecordsCount())),
+			Bookmark:     responseMetadata.GetBookmark(),
+		},
+	}, nil
+}
+
+/* queryEmissionsRecords runs a query on CouchDB: one page of its results if pageSize > 0, or else all of them with an empty bookmark */
+func queryEmissionsRecords(APIstub shim.ChaincodeStubInterface, queryString string, pageSize int, bookmark string) (*PaginatedQueryResults, error) {
+	if pageSize < 0 || pageSize > math.MaxInt32 {
+		return nil, fmt.Errorf("pageSize must be a positive integer, or 0 for all results, got %d", pageSize)
+	}
+	if pageSize == 0 {
+		resultsIterator, err := APIstub.GetQueryResult(queryString)
+		if err != nil {
+			return nil, err
+		}
+		defer resultsIterator.Close()
+
+		results, err := queryResultsFromIterator(resultsIterator)
+		if err != nil {
+			return nil, err
+		}
+		return &PaginatedQueryResults{Results: results, ResponseMetadata: QueryResponseMetadata{RecordsCount: strconv.Itoa(len(results))}}, nil
+	}
+
+	resultsIterator, responseMetadata, err := APIstub.GetQueryResultWithPagination(queryString, int32(pageSize), bookmark)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	return paginatedQueryResults(resultsIterator, responseMetadata)
+}
+
+/* Query the emissions records of a utility and party, as in the Node chaincode */
+
+func (s *EmissionsContract) GetAllEmissionsData(ctx contractapi.TransactionContextInterface, utilityId string, partyId string, pageSize int, bookmark string) (*PaginatedQueryResults, error) {
+	queryString, err := emissionsRecordsQuery(map[string]interface{}{
+		"utilityId": map[string]string{"$eq": utilityId},
+		"partyId":   map[string]string{"$eq": partyId},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return queryEmissionsRecords(ctx.GetStub(), queryString, pageSize, bookmark)
+}
+
+/* Query the emissions records whose period is within a date range, as in the Node chaincode */
+
+func (s *EmissionsContract) GetAllEmissionsDataByDateRange(ctx contractapi.TransactionContextInterface, fromDate string, thruDate string, pageSize int, bookmark string) (*PaginatedQueryResults, error) {
+	queryString, err := emissionsRecordsQuery(map[string]interface{}{
+		"fromDate": map[string]string{"$gte": fromDate},
+		"thruDate": map[string]string{"$lte": thruDate},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return queryEmissionsRecords(ctx.GetStub(), queryString, pageSize, bookmark)
+}
+
+/* Query the emissions records of a party whose period is within a date range, as in the Node chaincode */
+
+func (s *EmissionsContract) GetAllEmissionsDataByDateRangeAndParty(ctx contractapi.TransactionContextInterface, fromDate string, thruDate string, partyId string, pageSize int, bookmark string) (*PaginatedQueryResults, error) {
+	queryString, err := emissionsRecordsQuery(map[string]interface{}{
+		"fromDate": map[string]string{"$gte": fromDate},
+		"thruDate": map[string]string{"$lte": thruDate},
+		"partyId":  map[string]string{"$eq": partyId},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return queryEmissionsRecords(ctx.GetStub(), queryString, pageSize, bookmark)
+}
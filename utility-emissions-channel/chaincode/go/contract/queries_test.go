@@ -0,0 +1,83 @@
+package contract
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// sliceIterator iterates over fixed query results, as the peer returns them
+type sliceIterator struct {
+	results []*queryresult.KV
+}
+
+func (i *sliceIterator) HasNext() bool {
+	return len(i.results) > 0
+}
+
+func (i *sliceIterator) Next() (*queryresult.KV, error) {
+	next := i.results[0]
+	i.results = i.results[1:]
+	return next, nil
+}
+
+func (i *sliceIterator) Close() error {
+	return nil
+}
+
+func TestEmissionsRecordsQuery(t *testing.T) {
+	queryString, err := emissionsRecordsQuery(map[string]interface{}{
+		"partyId":  map[string]string{"$eq": `MyCompany", "class": {"$ne": ""}`},
+		"thruDate": map[string]string{"$lte": "2020-12-31"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"selector":{"class":{"$eq":"org.hyperledger.blockchain-carbon-accounting.emissionsrecord"},` +
+		`"partyId":{"$eq":"MyCompany\", \"class\": {\"$ne\": \"\"}"},"thruDate":{"$lte":"2020-12-31"}}}`
+	if queryString != want {
+		t.Errorf("got query\n%s\nwant\n%s", queryString, want)
+	}
+}
+
+func TestPaginatedQueryResults(t *testing.T) {
+	iterator := &sliceIterator{results: []*queryresult.KV{
+		{Key: "Utility1", Value: []byte(`{"uuid":"Utility1","utilityId":"Utility1"}`)},
+		{Key: "Utility2", Value: []byte(`{"uuid":"Utility2","utilityId":"Utility2"}`)},
+	}}
+	page, err := paginatedQueryResults(iterator, &pb.QueryResponseMetadata{FetchedRecordsCount: 2, Bookmark: "g1AAAAB"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Results) != 2 || page.ResponseMetadata.RecordsCount != "2" || page.ResponseMetadata.Bookmark != "g1AAAAB" {
+		t.Fatalf("got page %+v", page)
+	}
+	for i, result := range page.Results {
+		if result.Key != result.Record.UUID || result.Record.UtilityID != result.Key || result.Record.Class != emissionsRecordClass {
+			t.Errorf("result %d = %s %+v", i, result.Key, result.Record)
+		}
+	}
+
+	// a document of another class among the results fails the query
+	iterator = &sliceIterator{results: []*queryresult.KV{{Key: "USA_EIA_11208", Value: []byte(`{"class":"` + utilityLookupItemClass + `"}`)}}}
+	if _, err := paginatedQueryResults(iterator, &pb.QueryResponseMetadata{}); err == nil || !strings.Contains(err.Error(), "not an emissions record") {
+		t.Errorf("paginatedQueryResults of an identifier returned %v", err)
+	}
+}
+
+func TestQueryPageSize(t *testing.T) {
+	stub := newTestStub(t)
+	for _, pageSize := range []string{"-1", "4294967296"} {
+		response := stub.MockInvoke("tx", toByteArgs("getAllEmissionsData", "Utility1", "MyCompany", pageSize, ""))
+		if response.Status == shim.OK || !strings.Contains(response.Message, "pageSize must be") {
+			t.Errorf("pageSize %s returned %d %q", pageSize, response.Status, response.Message)
+		}
+	}
+	response := stub.MockInvoke("tx", toByteArgs("getAllEmissionsData", "Utility1", "MyCompany", "ten", ""))
+	if response.Status == shim.OK {
+		t.Errorf("pageSize ten returned %d", response.Status)
+	}
+}
@@ -0,0 +1,259 @@
+// Scope 3 value chain emissions in Golang
+
+package contract
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// scope3Categories are the 15 categories of the GHG Protocol Corporate Value Chain (Scope 3) Standard, in the order of their numbers
+var scope3Categories = []string{
+	"PURCHASED_GOODS_AND_SERVICES",
+	"CAPITAL_GOODS",
+	"FUEL_AND_ENERGY_RELATED_ACTIVITIES",
+	"UPSTREAM_TRANSPORTATION_AND_DISTRIBUTION",
+	"WASTE_GENERATED_IN_OPERATIONS",
+	"BUSINESS_TRAVEL",
+	"EMPLOYEE_COMMUTING",
+	"UPSTREAM_LEASED_ASSETS",
+	"DOWNSTREAM_TRANSPORTATION_AND_DISTRIBUTION",
+	"PROCESSING_OF_SOLD_PRODUCTS",
+	"USE_OF_SOLD_PRODUCTS",
+	"END_OF_LIFE_TREATMENT_OF_SOLD_PRODUCTS",
+	"DOWNSTREAM_LEASED_ASSETS",
+	"FRANCHISES",
+	"INVESTMENTS",
+}
+
+// scope3Input is the input of a Scope 3 record: the spend, activity or emissions of a supplier or other source of a party in a category over a period
+type scope3Input struct {
+	SourceID string
+	PartyID  string
+	FromDate string
+	ThruDate string
+	Category string
+}
+
+/* isScope3Category tells whether a normalized category is one of the Scope 3 categories */
+func isScope3Category(category string) bool {
+	for _, known := range scope3Categories {
+		if category == known {
+			return true
+		}
+	}
+	return false
+}
+
+/* scope3CategoryNumber is the number of a Scope 3 category, from 1 to 15, or 0 if it is not one */
+func scope3CategoryNumber(category string) int {
+	for i, known := range scope3Categories {
+		if category == known {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+/* normalizeScope3Category maps a category name, in any case and with spaces or hyphens, or its number from 1 to 15 to its name */
+func normalizeScope3Category(category string) (string, error) {
+	if number, err := strconv.Atoi(strings.TrimSpace(category)); err == nil && number >= 1 && number <= len(scope3Categories) {
+		return scope3Categories[number-1], nil
+	}
+	normalized := normalizeActivityType(category)
+	if !isScope3Category(normalized) {
+		return "", fmt.Errorf("category must be a Scope 3 category from 1 to 15 or its name, such as PURCHASED_GOODS_AND_SERVICES, got %q", category)
+	}
+	return normalized, nil
+}
+
+/* scope3RecordID is the deterministic key of a Scope 3 record: the MD5 of its source and category, party and period, so recording a category of a source again, with any method, replaces its record */
+func scope3RecordID(sourceID string, category string, partyID string, fromDate string, thruDate string) string {
+	return emissionsRecordID(sourceID+"~"+category, partyID, fromDate, thruDate)
+}
+
+/* getScope3Emissions computes the emissions of a spend in the currency of a spend-based factor, or of an activity with an activity-based factor, in exact arithmetic */
+func getScope3Emissions(factor *Scope3EmissionsFactor, amount float64, uom string, gwp *GWPSet) (*CO2Emissions, error) {
+	amountRat, err := ratFromFloat(amount)
+	if err != nil {
+		return nil, err
+	}
+
+	// the mass unit of the factor and the amount in the unit the factor emits it per
+	massUom, basis := factor.EmissionsUom, amountRat
+	if factor.Method == methodSpendBased {
+		if strings.ToUpper(strings.TrimSpace(uom)) != factor.Currency {
+			return nil, fmt.Errorf("Scope 3 emissions factor %s is per %s, got a spend in %s", factor.ID, factor.Currency, uom)
+		}
+	} else {
+		separator := strings.Index(factor.EmissionsUom, "/")
+		massUom = factor.EmissionsUom[:separator]
+		if basis, err = convertRat(amountRat, uom, factor.EmissionsUom[separator+1:]); err != nil {
+			return nil, err
+		}
+	}
+	emitted := func(amount float64) (*big.Rat, error) {
+		amountRat, err := ratFromFloat(amount)
+		if err != nil {
+			return nil, err
+		}
+		return convertRat(amountRat.Mul(amountRat, basis), massUom, emissionsUomTons)
+	}
+
+	co2Emissions := &CO2Emissions{
+		EmissionsUom: emissionsUomTons,
+		Year:         factor.Year,
+	}
+	if err := weighEmissions(co2Emissions, factor.ID, factor.CO2EquivalentEmissions, factor.GasEmissions, gwp, emitted); err != nil {
+		return nil, err
+	}
+	return co2Emissions, nil
+}
+
+/* getSupplierEmissions is the share of the emissions of a supplier allocated to a party, in tons */
+func getSupplierEmissions(supplierEmissions float64, supplierEmissionsUom string, share float64) (*CO2Emissions, error) {
+	emissions, err := ratFromFloat(supplierEmissions)
+	if err != nil {
+		return nil, err
+	}
+	shareRat, err := ratFromFloat(share)
+	if err != nil {
+		return nil, err
+	}
+	emissions, err = convertRat(emissions.Mul(emissions, shareRat), supplierEmissionsUom, emissionsUomTons)
+	if err != nil {
+		return nil, err
+	}
+	co2Emissions := &CO2Emissions{EmissionsUom: emissionsUomTons}
+	co2Emissions.EmissionsAmount, _ = emissions.Float64()
+	return co2Emissions, nil
+}
+
+/* getRecordScope3Emissions computes the emissions of a Scope 3 record again, with the factor of its sector for its reporting year */
+func getRecordScope3Emissions(APIstub shim.ChaincodeStubInterface, record *EmissionsRecord, gwp *GWPSet) (*CO2Emissions, error) {
+	if record.Method == methodSupplierSpecific {
+		return getSupplierEmissions(record.ActivityAmount, record.ActivityUom, record.AllocationShare)
+	}
+	recordPeriod, err := record.period()
+	if err != nil {
+		return nil, err
+	}
+	currency := ""
+	if record.Method == methodSpendBased {
+		currency = strings.ToUpper(strings.TrimSpace(record.ActivityUom))
+	}
+	factor, err := getScope3FactorForYear(APIstub, record.Method, record.Sector, currency, recordPeriod.reportingYear())
+	if err != nil {
+		return nil, err
+	}
+	return getScope3Emissions(factor, record.ActivityAmount, record.ActivityUom, gwp)
+}
+
+/* newScope3Record starts a Scope 3 record of a method; the emissions are filled in by the caller */
+func newScope3Record(input scope3Input, method string, sector string) (*EmissionsRecord, period, error) {
+	category, err := normalizeScope3Category(input.Category)
+	if err != nil {
+		return nil, period{}, err
+	}
+	recordPeriod, err := parsePeriod(input.FromDate, input.ThruDate)
+	if err != nil {
+		return nil, period{}, err
+	}
+	return &EmissionsRecord{
+		Class:     emissionsRecordClass,
+		Version:   emissionsRecordVersion,
+		UUID:      scope3RecordID(input.SourceID, category, input.PartyID, input.FromDate, input.ThruDate),
+		UtilityID: input.SourceID,
+		PartyID:   input.PartyID,
+		FromDate:  input.FromDate,
+		ThruDate:  input.ThruDate,
+		Scope:     emissionsScope3,
+		Category:  category,
+		Method:    method,
+		Sector:    sector,
+	}, recordPeriod, nil
+}
+
+/* recordScope3WithFactor computes a spend-based or activity-based record with the factor of its sector for its reporting year, and writes it */
+func recordScope3WithFactor(APIstub shim.ChaincodeStubInterface, record *EmissionsRecord, recordPeriod period, amount float64, uom string, gwpSetID string, url string, md5 string) (*EmissionsRecord, error) {
+	currency := ""
+	if record.Method == methodSpendBased {
+		currency = strings.ToUpper(strings.TrimSpace(uom))
+	}
+	record.ActivityAmount = amount
+	record.ActivityUom = uom
+
+	factor, err := getScope3FactorForYear(APIstub, record.Method, record.Sector, currency, recordPeriod.reportingYear())
+	if err != nil {
+		return nil, err
+	}
+	gwp, err := selectGWPSet(APIstub, gwpSetID)
+	if err != nil {
+		return nil, err
+	}
+	co2Emissions, err := getScope3Emissions(factor, record.ActivityAmount, record.ActivityUom, gwp)
+	if err != nil {
+		return nil, err
+	}
+	record.EmissionsAmount = co2Emissions.EmissionsAmount
+	record.EmissionsUom = co2Emissions.EmissionsUom
+	record.GasEmissions = co2Emissions.GasEmissions
+	record.GWPSet = co2Emissions.GWPSet
+	record.FactorSource = factor.ID
+	return putCombustionRecord(APIstub, record, url, md5)
+}
+
+/* Record the Scope 3 emissions of the spend of a party with a supplier, with the EEIO factor of the NAICS sector and currency of the spend; an empty gwpSet selects the default set */
+
+func (s *EmissionsContract) RecordSpendEmissions(ctx contractapi.TransactionContextInterface, sourceId string, partyId string, fromDate string, thruDate string,
+	category string, naics string, spendAmount float64, currency string, url string, md5 string, gwpSet string) (*EmissionsRecord, error) {
+	input := scope3Input{SourceID: sourceId, PartyID: partyId, FromDate: fromDate, ThruDate: thruDate, Category: category}
+	record, recordPeriod, err := newScope3Record(input, methodSpendBased, strings.TrimSpace(naics))
+	if err != nil {
+		return nil, err
+	}
+	return recordScope3WithFactor(ctx.GetStub(), record, recordPeriod, spendAmount, currency, gwpSet, url, md5)
+}
+
+/* Record the Scope 3 emissions of an activity of a party, such as freight in tonne-km or travel in passenger-km, with the factor of the activity type; an empty gwpSet selects the default set */
+
+func (s *EmissionsContract) RecordActivityEmissions(ctx contractapi.TransactionContextInterface, sourceId string, partyId string, fromDate string, thruDate string,
+	category string, activityType string, activityAmount float64, activityUom string, url string, md5 string, gwpSet string) (*EmissionsRecord, error) {
+	input := scope3Input{SourceID: sourceId, PartyID: partyId, FromDate: fromDate, ThruDate: thruDate, Category: category}
+	record, recordPeriod, err := newScope3Record(input, methodActivityBased, normalizeActivityType(activityType))
+	if err != nil {
+		return nil, err
+	}
+	return recordScope3WithFactor(ctx.GetStub(), record, recordPeriod, activityAmount, activityUom, gwpSet, url, md5)
+}
+
+/* Record the Scope 3 emissions a supplier reports, allocated to a party by its share of the output of the supplier */
+
+func (s *EmissionsContract) RecordSupplierEmissions(ctx contractapi.TransactionContextInterface, supplierId string, partyId string, fromDate string, thruDate string,
+	category string, supplierEmissions float64, supplierEmissionsUom string, allocationAmount float64, allocationTotal float64, url string, md5 string) (*EmissionsRecord, error) {
+	input := scope3Input{SourceID: supplierId, PartyID: partyId, FromDate: fromDate, ThruDate: thruDate, Category: category}
+	record, _, err := newScope3Record(input, methodSupplierSpecific, "")
+	if err != nil {
+		return nil, err
+	}
+	record.ActivityAmount = supplierEmissions
+	record.ActivityUom = supplierEmissionsUom
+	if allocationTotal <= 0 || allocationAmount < 0 || allocationAmount > allocationTotal {
+		return nil, fmt.Errorf("allocationAmount must be between 0 and allocationTotal, which must be positive")
+	}
+	record.AllocationShare = allocationAmount / allocationTotal
+
+	co2Emissions, err := getSupplierEmissions(record.ActivityAmount, record.ActivityUom, record.AllocationShare)
+	if err != nil {
+		return nil, err
+	}
+	record.EmissionsAmount = co2Emissions.EmissionsAmount
+	record.EmissionsUom = co2Emissions.EmissionsUom
+	record.FactorSource = "supplier " + record.UtilityID
+	return putCombustionRecord(ctx.GetStub(), record, url, md5)
+}
@@ -0,0 +1,116 @@
+package contract
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+func TestScope3Emissions(t *testing.T) {
+	stub := newTestStub(t)
+	mustInvoke(t, stub, "importScope3Factor", `{"id":"EEIO_2020_331110","method":"spend-based","sector":"331110","currency":"usd","year":"2020","CO2EquivalentEmissions":0.9,"emissionsUom":"KG","source":"USEEIO"}`)
+	mustInvoke(t, stub, "importScope3Factor", `{"id":"ROAD_FREIGHT_2020","method":"ACTIVITY_BASED","sector":"road freight","year":"2020","CO2EquivalentEmissions":0.1,"emissionsUom":"KG/TKM"}`)
+	mustInvoke(t, stub, "createEmissionRecord", calcInputJSON("Utility1", "MyCompany", "2020-01-01", "2020-01-31", 3100, "KWH"), "3.1", "tons", "0", "3100", "", "", "")
+
+	record := func(function string, args ...string) EmissionsRecord {
+		record := EmissionsRecord{}
+		if err := json.Unmarshal(mustInvoke(t, stub, function, args...), &record); err != nil {
+			t.Fatal(err)
+		}
+		return record
+	}
+
+	// 10000 USD of steel at 0.9 kg per USD is 9 tons
+	steel := record("recordSpendEmissions", "STEEL-CO", "MyCompany", "2020-01-01", "2020-01-31", "1", "331110", "10000", "usd", "", "", "")
+	if steel.Scope != emissionsScope3 || steel.Category != "PURCHASED_GOODS_AND_SERVICES" || steel.Method != methodSpendBased || steel.Sector != "331110" ||
+		steel.FactorSource != "EEIO_2020_331110" || !closeTo(steel.EmissionsAmount, 9) || steel.EnergyUseAmount != 0 {
+		t.Errorf("got record %+v", steel)
+	}
+
+	// 1000 ton-miles are 1459.97231821056 tonne-km
+	freight := record("recordActivityEmissions", "CARRIER-1", "MyCompany", "2020-01-01", "2020-01-31", "upstream transportation and distribution", "Road Freight", "1000", "TON-MILES", "", "", "")
+	if freight.Category != "UPSTREAM_TRANSPORTATION_AND_DISTRIBUTION" || freight.Sector != "ROAD_FREIGHT" || !closeTo(freight.EmissionsAmount, 1459.97231821056*0.1/1000) {
+		t.Errorf("got record %+v", freight)
+	}
+
+	// the party buys 20 of the 100 machines the supplier made, a fifth of its 500 tons
+	machines := record("recordSupplierEmissions", "MACHINE-CO", "MyCompany", "2020-01-01", "2020-01-31", "CAPITAL_GOODS", "500", "tons", "20", "100", "", "")
+	if machines.Method != methodSupplierSpecific || !closeTo(machines.AllocationShare, 0.2) || !closeTo(machines.EmissionsAmount, 100) || machines.FactorSource != "supplier MACHINE-CO" {
+		t.Errorf("got record %+v", machines)
+	}
+
+	for _, r := range []EmissionsRecord{steel, freight, machines} {
+		co2Emissions := CO2Emissions{}
+		if err := json.Unmarshal(mustInvoke(t, stub, "compEmissionAmount", r.UUID, "kg", ""), &co2Emissions); err != nil {
+			t.Fatal(err)
+		}
+		if !closeTo(co2Emissions.EmissionsAmount, r.EmissionsAmount*1000) {
+			t.Errorf("compEmissionAmount of %s = %+v, want %v kg", r.Category, co2Emissions, r.EmissionsAmount*1000)
+		}
+	}
+
+	groupTests := []struct {
+		groupBy    string
+		wantGroups []EmissionsTotal
+	}{
+		{"scope", []EmissionsTotal{
+			{Group: "2", Records: 1, EmissionsAmount: 3.1},
+			{Group: "3", Records: 3, EmissionsAmount: 9 + freight.EmissionsAmount + 100},
+		}},
+		{"category", []EmissionsTotal{
+			{Group: "PURCHASED_ELECTRICITY", Records: 1, EmissionsAmount: 3.1},
+			{Group: "PURCHASED_GOODS_AND_SERVICES", Records: 1, EmissionsAmount: 9},
+			{Group: "CAPITAL_GOODS", Records: 1, EmissionsAmount: 100},
+			{Group: "UPSTREAM_TRANSPORTATION_AND_DISTRIBUTION", Records: 1, EmissionsAmount: freight.EmissionsAmount},
+		}},
+	}
+	for _, tt := range groupTests {
+		t.Run(tt.groupBy, func(t *testing.T) {
+			totals := EmissionsTotals{}
+			if err := json.Unmarshal(mustInvoke(t, stub, "getEmissionsTotals", "MyCompany", "2020-01-01", "2020-12-31", tt.groupBy), &totals); err != nil {
+				t.Fatal(err)
+			}
+			if len(totals.Groups) != len(tt.wantGroups) {
+				t.Fatalf("got groups %+v, want %+v", totals.Groups, tt.wantGroups)
+			}
+			for i, want := range tt.wantGroups {
+				got := totals.Groups[i]
+				if got.Group != want.Group || got.Records != want.Records || !closeTo(got.EmissionsAmount, want.EmissionsAmount) {
+					t.Errorf("group %d = %+v, want %+v", i, got, want)
+				}
+			}
+		})
+	}
+
+	factors := []Scope3FactorResult{}
+	if err := json.Unmarshal(mustInvoke(t, stub, "getScope3Factors", "SPEND_BASED", "331110", "USD", "0"), &factors); err != nil || len(factors) != 1 {
+		t.Errorf("getScope3Factors returned %d factors, %v", len(factors), err)
+	}
+
+	tests := []struct {
+		name     string
+		function string
+		args     []string
+		wantErr  string
+	}{
+		{"spend in another currency", "recordSpendEmissions", []string{"STEEL-CO", "MyCompany", "2020-02-01", "2020-02-29", "1", "331110", "10000", "EUR", "", "", ""}, "No Scope 3 emissions factor found"},
+		{"unknown category", "recordSpendEmissions", []string{"STEEL-CO", "MyCompany", "2020-02-01", "2020-02-29", "16", "331110", "10000", "USD", "", "", ""}, "category must be"},
+		{"activity in another dimension", "recordActivityEmissions", []string{"CARRIER-1", "MyCompany", "2020-02-01", "2020-02-29", "4", "ROAD_FREIGHT", "1000", "PKM", "", "", ""}, "Cannot convert"},
+		{"no factor for the year", "recordActivityEmissions", []string{"CARRIER-1", "MyCompany", "2030-02-01", "2030-02-28", "4", "ROAD_FREIGHT", "1000", "TKM", "", "", ""}, "No Scope 3 emissions factor found"},
+		{"allocation above the total", "recordSupplierEmissions", []string{"MACHINE-CO", "MyCompany", "2020-02-01", "2020-02-29", "2", "500", "tons", "101", "100", "", ""}, "allocationAmount must be"},
+		{"overlapping the same source and category", "recordSupplierEmissions", []string{"STEEL-CO", "MyCompany", "2020-01-15", "2020-02-14", "1", "500", "tons", "1", "100", "", ""}, "overlaps record"},
+		{"sector not a NAICS code", "importScope3Factor", []string{`{"id":"EEIO_STEEL","method":"SPEND_BASED","sector":"steel","currency":"USD","year":"2020","CO2EquivalentEmissions":0.9,"emissionsUom":"KG"}`}, "NAICS code"},
+		{"spend factor per activity", "importScope3Factor", []string{`{"id":"EEIO_2020_3311","method":"SPEND_BASED","sector":"3311","currency":"USD","year":"2020","CO2EquivalentEmissions":0.9,"emissionsUom":"KG/TKM"}`}, "per unit of currency"},
+		{"existing factor", "importScope3Factor", []string{`{"id":"ROAD_FREIGHT_2020","method":"ACTIVITY_BASED","sector":"ROAD_FREIGHT","year":"2020","CO2EquivalentEmissions":0.1,"emissionsUom":"KG/TKM"}`}, "already exists"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := stub.MockInvoke("tx", toByteArgs(tt.function, tt.args...))
+			if response.Status == shim.OK || !strings.Contains(response.Message, tt.wantErr) {
+				t.Errorf("got %d %q, want an error containing %q", response.Status, response.Message, tt.wantErr)
+			}
+		})
+	}
+}
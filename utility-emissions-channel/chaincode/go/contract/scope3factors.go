@@ -0,0 +1,312 @@
+// Scope 3 spend-based and activity-based emissions factor registry in Golang
+
+package contract
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"emissions/events"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/* class identifier of Scope 3 emissions factors */
+const scope3FactorClass = "org.hyperledger.blockchain-carbon-accounting.scope3emissionsfactor"
+
+/* composite key index of the Scope 3 factors; the method, sector and currency come first so lookups are range scans. Activity-based factors have an empty currency */
+const scope3FactorIndex = "method~sector~currency~year~id"
+
+/* calculation methods of Scope 3 records; only spend-based and activity-based records use a factor */
+const (
+	methodSpendBased       = "SPEND_BASED"
+	methodActivityBased    = "ACTIVITY_BASED"
+	methodSupplierSpecific = "SUPPLIER_SPECIFIC"
+)
+
+var naicsPattern = regexp.MustCompile(`^[0-9]{2,6}$`)
+
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// Scope3EmissionsFactor is the emissions of spending a unit of a currency in a NAICS sector, as in an environmentally-extended
+// input-output (EEIO) model, or the emissions of a unit of an activity such as freight in tonne-km or travel in passenger-km.
+type Scope3EmissionsFactor struct {
+	Class  string `json:"class" metadata:",optional"`
+	ID     string `json:"id"`
+	Method string `json:"method"`
+	// the NAICS code of a spend-based factor, or the activity type of an activity-based factor, e.g. ROAD_FREIGHT
+	Sector string `json:"sector"`
+	// the ISO 4217 code of the currency a spend-based factor is per unit of
+	Currency string `json:"currency,omitempty" metadata:",optional"`
+	Year     string `json:"year"`
+	// emissions per unit of currency of a spend-based factor, in a mass unit, e.g. KG, or per unit of activity of an activity-based factor, e.g. KG/TKM
+	CO2EquivalentEmissions float64 `json:"CO2EquivalentEmissions"`
+	EmissionsUom           string  `json:"emissionsUom"`
+	// emissions of each of CO2, CH4 and N2O in emissionsUom; when present, emissions are weighed with a GWP set instead of taken from CO2EquivalentEmissions
+	GasEmissions map[string]float64 `json:"gasEmissions,omitempty" metadata:",optional"`
+	Source       string             `json:"source,omitempty" metadata:",optional"`
+}
+
+// Scope3FactorResult is one entry of getScope3Factors, in the same shape as the Node chaincode returns
+type Scope3FactorResult struct {
+	Key    string                 `json:"Key"`
+	Record *Scope3EmissionsFactor `json:"Record"`
+}
+
+/* normalizeActivityType maps an activity type to its upper case form, accepting spaces and hyphens for underscores */
+func normalizeActivityType(activityType string) string {
+	return strings.NewReplacer(" ", "_", "-", "_").Replace(strings.ToUpper(strings.TrimSpace(activityType)))
+}
+
+/* Validate normalizes the factor and checks it before it is written to the ledger */
+func (f *Scope3EmissionsFactor) Validate() error {
+	f.Method = normalizeActivityType(f.Method)
+	f.Currency = strings.ToUpper(strings.TrimSpace(f.Currency))
+	f.Sector = strings.TrimSpace(f.Sector)
+	required := []struct{ name, value string }{
+		{"id", f.ID},
+		{"sector", f.Sector},
+		{"year", f.Year},
+		{"emissionsUom", f.EmissionsUom},
+	}
+	for _, field := range required {
+		if strings.TrimSpace(field.value) == "" {
+			return fmt.Errorf("Scope 3 emissions factor %s must be a non-empty string", field.name)
+		}
+	}
+	if strings.Contains(f.ID, "\x00") || strings.Contains(f.Sector, "\x00") {
+		return fmt.Errorf("Scope 3 emissions factor keys must not contain U+0000")
+	}
+	if _, err := strconv.Atoi(f.Year); err != nil || len(f.Year) != 4 {
+		return fmt.Errorf("Scope 3 emissions factor year must be a 4 digit year, got %q", f.Year)
+	}
+	if f.CO2EquivalentEmissions < 0 {
+		return fmt.Errorf("Scope 3 emissions factor CO2EquivalentEmissions must not be negative")
+	}
+	if err := checkGasEmissions("Scope 3 emissions factor gasEmissions", f.GasEmissions); err != nil {
+		return err
+	}
+
+	dimensions, err := uomDimensions(f.EmissionsUom)
+	if err != nil {
+		return err
+	}
+	switch f.Method {
+	case methodSpendBased:
+		if !naicsPattern.MatchString(f.Sector) {
+			return fmt.Errorf("Scope 3 emissions factor sector must be a NAICS code of 2 to 6 digits, got %q", f.Sector)
+		}
+		if !currencyPattern.MatchString(f.Currency) {
+			return fmt.Errorf("Scope 3 emissions factor currency must be an ISO 4217 code such as USD, got %q", f.Currency)
+		}
+		if dimensions != uomDimensionMass {
+			return fmt.Errorf("Scope 3 emissions factor emissionsUom %s must be a mass unit per unit of currency", f.EmissionsUom)
+		}
+	case methodActivityBased:
+		f.Sector = normalizeActivityType(f.Sector)
+		if f.Currency != "" {
+			return fmt.Errorf("Scope 3 emissions factor currency is only for spend-based factors")
+		}
+		if !strings.HasPrefix(dimensions, uomDimensionMass+"/") {
+			return fmt.Errorf("Scope 3 emissions factor emissionsUom %s must be a mass unit per unit of activity", f.EmissionsUom)
+		}
+	default:
+		return fmt.Errorf("Scope 3 emissions factor method must be %s or %s, got %q", methodSpendBased, methodActivityBased, f.Method)
+	}
+	return nil
+}
+
+/* scope3FactorIndexKey is the composite index entry of a factor */
+func scope3FactorIndexKey(APIstub shim.ChaincodeStubInterface, factor *Scope3EmissionsFactor) (string, error) {
+	return APIstub.CreateCompositeKey(scope3FactorIndex, []string{factor.Method, factor.Sector, factor.Currency, factor.Year, factor.ID})
+}
+
+/* getScope3FactorState reads a factor by its id; it returns nil if the factor does not exist */
+func getScope3FactorState(APIstub shim.ChaincodeStubInterface, id string) (*Scope3EmissionsFactor, error) {
+	factorAsBytes, err := APIstub.GetState(id)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get Scope 3 emissions factor %s: %s", id, err.Error())
+	} else if factorAsBytes == nil {
+		return nil, nil
+	}
+	factor := &Scope3EmissionsFactor{}
+	if err := json.Unmarshal(factorAsBytes, factor); err != nil {
+		return nil, fmt.Errorf("Failed to decode Scope 3 emissions factor %s: %s", id, err.Error())
+	} else if factor.Class != scope3FactorClass {
+		return nil, fmt.Errorf("%s is not a Scope 3 emissions factor", id)
+	}
+	return factor, nil
+}
+
+/* putScope3Factor writes the factor under its id and maintains the method index; previous is the stored version, if any */
+func putScope3Factor(APIstub shim.ChaincodeStubInterface, factor *Scope3EmissionsFactor, previous *Scope3EmissionsFactor) ([]byte, error) {
+	factor.Class = scope3FactorClass
+	factorAsBytes, err := json.Marshal(factor)
+	if err != nil {
+		return nil, err
+	}
+	if err := APIstub.PutState(factor.ID, factorAsBytes); err != nil {
+		return nil, err
+	}
+
+	indexKey, err := scope3FactorIndexKey(APIstub, factor)
+	if err != nil {
+		return nil, err
+	}
+	if previous != nil {
+		previousIndexKey, err := scope3FactorIndexKey(APIstub, previous)
+		if err != nil {
+			return nil, err
+		}
+		if previousIndexKey != indexKey {
+			if err := APIstub.DelState(previousIndexKey); err != nil {
+				return nil, err
+			}
+		}
+	}
+	//  Only the key name is needed, passing a 'nil' value would delete the key, therefore we pass null character as value
+	if err := APIstub.PutState(indexKey, []byte{0x00}); err != nil {
+		return nil, err
+	}
+	return factorAsBytes, nil
+}
+
+/* queryScope3Factors range scans the method index by its leading attributes */
+func queryScope3Factors(APIstub shim.ChaincodeStubInterface, attributes []string) ([]Scope3EmissionsFactor, error) {
+	resultsIterator, err := APIstub.GetStateByPartialCompositeKey(scope3FactorIndex, attributes)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	factors := []Scope3EmissionsFactor{}
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, compositeKeyParts, err := APIstub.SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return nil, err
+		}
+		id := compositeKeyParts[4]
+		factor, err := getScope3FactorState(APIstub, id)
+		if err != nil {
+			return nil, err
+		} else if factor == nil {
+			return nil, fmt.Errorf("Scope 3 emissions factor %s is indexed but does not exist", id)
+		}
+		factors = append(factors, *factor)
+	}
+	return factors, nil
+}
+
+/* getScope3FactorForYear picks the factor of a method, sector and currency for a year, or else for one of the preceding years */
+func getScope3FactorForYear(APIstub shim.ChaincodeStubInterface, method string, sector string, currency string, year int) (*Scope3EmissionsFactor, error) {
+	for lookback := 0; lookback <= maximumYearLookback; lookback++ {
+		factors, err := queryScope3Factors(APIstub, []string{method, sector, currency, fmt.Sprintf("%d", year-lookback)})
+		if err != nil {
+			return nil, err
+		}
+		if len(factors) > 0 {
+			return &factors[0], nil
+		}
+	}
+	return nil, fmt.Errorf("No Scope 3 emissions factor found for %s %s %s in %d", method, sector, currency, year)
+}
+
+/* Import a new spend-based or activity-based Scope 3 emissions factor */
+
+func (s *EmissionsContract) ImportScope3Factor(ctx contractapi.TransactionContextInterface, factor Scope3EmissionsFactor) (*Scope3EmissionsFactor, error) {
+	APIstub := ctx.GetStub()
+	if err := factor.Validate(); err != nil {
+		return nil, err
+	}
+
+	existingAsBytes, err := APIstub.GetState(factor.ID)
+	if err != nil {
+		return nil, err
+	} else if existingAsBytes != nil {
+		return nil, fmt.Errorf("This key already exists: %s", factor.ID)
+	}
+
+	if _, err := putScope3Factor(APIstub, &factor, nil); err != nil {
+		return nil, err
+	}
+	err = setFactorImported(APIstub, []events.FactorChange{{Key: factor.ID, Status: batchRowCreated}})
+	if err != nil {
+		return nil, err
+	}
+	return &factor, nil
+}
+
+/* Update an existing Scope 3 emissions factor, re-indexing it if its method, sector, currency or year changed */
+
+func (s *EmissionsContract) UpdateScope3Factor(ctx contractapi.TransactionContextInterface, factor Scope3EmissionsFactor) (*Scope3EmissionsFactor, error) {
+	APIstub := ctx.GetStub()
+	if err := factor.Validate(); err != nil {
+		return nil, err
+	}
+
+	existing, err := getScope3FactorState(APIstub, factor.ID)
+	if err != nil {
+		return nil, err
+	} else if existing == nil {
+		return nil, fmt.Errorf("Scope 3 emissions factor does not exist: %s", factor.ID)
+	}
+
+	if _, err := putScope3Factor(APIstub, &factor, existing); err != nil {
+		return nil, err
+	}
+	err = setFactorImported(APIstub, []events.FactorChange{{Key: factor.ID, Status: batchRowUpdated}})
+	if err != nil {
+		return nil, err
+	}
+	return &factor, nil
+}
+
+/* Query a Scope 3 emissions factor by its id */
+
+func (s *EmissionsContract) GetScope3Factor(ctx contractapi.TransactionContextInterface, id string) (*Scope3EmissionsFactor, error) {
+	factor, err := getScope3FactorState(ctx.GetStub(), id)
+	if err != nil {
+		return nil, err
+	} else if factor == nil {
+		return nil, fmt.Errorf("Scope 3 emissions factor does not exist: %s", id)
+	}
+	return factor, nil
+}
+
+/* Query the Scope 3 emissions factors of a method, only those of a sector, currency and year unless they are empty or 0;
+   an attribute is only matched if it or a later one is set */
+
+func (s *EmissionsContract) GetScope3Factors(ctx contractapi.TransactionContextInterface, method string, sector string, currency string, year int) ([]Scope3FactorResult, error) {
+	values := []string{strings.TrimSpace(sector), strings.ToUpper(strings.TrimSpace(currency)), ""}
+	if year != 0 {
+		values[2] = strconv.Itoa(year)
+	}
+	attributes := []string{normalizeActivityType(method)}
+	if attributes[0] == methodActivityBased {
+		values[0] = normalizeActivityType(values[0])
+	}
+	last := -1
+	for i, value := range values {
+		if value != "" {
+			last = i
+		}
+	}
+	attributes = append(attributes, values[:last+1]...)
+	factors, err := queryScope3Factors(ctx.GetStub(), attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []Scope3FactorResult{}
+	for i := range factors {
+		results = append(results, Scope3FactorResult{Key: factors[i].ID, Record: &factors[i]})
+	}
+	return results, nil
+}
@@ -0,0 +1,166 @@
+// Linkage of emissions records to NetEmissionsTokenNetwork tokens in Golang
+
+package contract
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"emissions/events"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/* composite key index of the tokenized records; the token comes first so the records of a token are a range scan */
+const tokenRecordIndex = "tokenId~recordKey"
+
+/* token ids are the uint256 ids of NetEmissionsTokenNetwork, issuers its Ethereum accounts */
+var (
+	tokenIDPattern = regexp.MustCompile(`^[1-9][0-9]{0,77}$`)
+	addressPattern = regexp.MustCompile(`^0x[0-9a-fA-F]{40}$`)
+)
+
+/* checkTokenizedAmounts refuses a change of the amounts of a tokenized record, as the token was issued for them */
+func checkTokenizedAmounts(existing *EmissionsRecord, record *EmissionsRecord) error {
+	if existing.TokenID == "" {
+		return nil
+	}
+	if existing.EnergyUseAmount != record.EnergyUseAmount || existing.EnergyUseUom != record.EnergyUseUom ||
+		existing.EmissionsAmount != record.EmissionsAmount || existing.EmissionsUom != record.EmissionsUom ||
+		existing.RenewableEnergyUseAmount != record.RenewableEnergyUseAmount ||
+		existing.NonrenewableEnergyUseAmount != record.NonrenewableEnergyUseAmount ||
+		!reflect.DeepEqual(existing.MarketBased, record.MarketBased) ||
+		!reflect.DeepEqual(existing.GasEmissions, record.GasEmissions) || existing.GWPSet != record.GWPSet ||
+		existing.ActivityAmount != record.ActivityAmount || existing.ActivityUom != record.ActivityUom ||
+		existing.AllocationShare != record.AllocationShare {
+		return fmt.Errorf("Emissions record %s is tokenized as token %s, its amounts cannot change", existing.UUID, existing.TokenID)
+	}
+	return nil
+}
+
+/* tokenRecordIndexKey is the composite index entry of a record of a token */
+func tokenRecordIndexKey(APIstub shim.ChaincodeStubInterface, tokenID string, recordKey string) (string, error) {
+	return APIstub.CreateCompositeKey(tokenRecordIndex, []string{tokenID, recordKey})
+}
+
+/* Mark emissions records as tokenized by a NetEmissionsTokenNetwork token and the address that issued it */
+
+func (s *EmissionsContract) TokenizeEmissionsRecords(ctx contractapi.TransactionContextInterface, tokenId string, issuedBy string, recordKeys []string) ([]EmissionsRecordResult, error) {
+	APIstub := ctx.GetStub()
+	tokenID, issuer := strings.TrimSpace(tokenId), strings.TrimSpace(issuedBy)
+	if !tokenIDPattern.MatchString(tokenID) {
+		return nil, fmt.Errorf("tokenId must be a positive integer, got %q", tokenId)
+	}
+	if !addressPattern.MatchString(issuer) {
+		return nil, fmt.Errorf("issuedBy must be an address such as 0x followed by 40 hexadecimal characters, got %q", issuedBy)
+	}
+	if len(recordKeys) == 0 {
+		return nil, fmt.Errorf("recordKeys must name at least one emissions record")
+	}
+
+	// a token is issued once, for all its records
+	linked, err := APIstub.GetStateByPartialCompositeKey(tokenRecordIndex, []string{tokenID})
+	if err != nil {
+		return nil, err
+	}
+	alreadyLinked := linked.HasNext()
+	linked.Close()
+	if alreadyLinked {
+		return nil, fmt.Errorf("Token %s is already linked to emissions records", tokenID)
+	}
+
+	// check every record before writing any, so a rejected call leaves no record tokenized
+	records := []*EmissionsRecord{}
+	seen := map[string]bool{}
+	for _, recordKey := range recordKeys {
+		if seen[recordKey] {
+			return nil, fmt.Errorf("Emissions record %s is listed more than once", recordKey)
+		}
+		seen[recordKey] = true
+
+		recordAsBytes, err := APIstub.GetState(recordKey)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get emissions record: %s", err.Error())
+		} else if recordAsBytes == nil {
+			return nil, fmt.Errorf("Emissions record does not exist: %s", recordKey)
+		}
+		record, err := emissionsRecordFromJSON(recordAsBytes)
+		if err != nil {
+			return nil, fmt.Errorf("Emissions record %s: %s", recordKey, err.Error())
+		} else if record.TokenID != "" {
+			return nil, fmt.Errorf("Emissions record %s is already tokenized as token %s", recordKey, record.TokenID)
+		}
+		records = append(records, record)
+	}
+
+	submittedBy, err := submittingMSP(APIstub)
+	if err != nil {
+		return nil, err
+	}
+	results := []EmissionsRecordResult{}
+	for i, record := range records {
+		record.TokenID = tokenID
+		record.TokenIssuedBy = issuer
+		record.SubmittedBy = submittedBy
+		recordAsBytes, err := record.toJSON()
+		if err != nil {
+			return nil, err
+		}
+		if err := APIstub.PutState(recordKeys[i], recordAsBytes); err != nil {
+			return nil, err
+		}
+		indexKey, err := tokenRecordIndexKey(APIstub, tokenID, recordKeys[i])
+		if err != nil {
+			return nil, err
+		}
+		//  Only the key name is needed, passing a 'nil' value would delete the key, therefore we pass null character as value
+		if err := APIstub.PutState(indexKey, []byte{0x00}); err != nil {
+			return nil, err
+		}
+		results = append(results, EmissionsRecordResult{Key: recordKeys[i], Record: record})
+	}
+
+	err = setEvent(APIstub, events.RecordTokenized, events.RecordTokenizedData{TokenID: tokenID, IssuedBy: issuer, RecordKeys: recordKeys})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+/* Query the emissions records a token was issued for */
+
+func (s *EmissionsContract) GetEmissionsRecordsByToken(ctx contractapi.TransactionContextInterface, tokenId string) ([]EmissionsRecordResult, error) {
+	APIstub := ctx.GetStub()
+	resultsIterator, err := APIstub.GetStateByPartialCompositeKey(tokenRecordIndex, []string{strings.TrimSpace(tokenId)})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	results := []EmissionsRecordResult{}
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, compositeKeyParts, err := APIstub.SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return nil, err
+		}
+		recordKey := compositeKeyParts[1]
+		recordAsBytes, err := APIstub.GetState(recordKey)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get emissions record: %s", err.Error())
+		} else if recordAsBytes == nil {
+			return nil, fmt.Errorf("Emissions record %s is indexed but does not exist", recordKey)
+		}
+		record, err := decodeEmissionsRecord(recordAsBytes)
+		if err != nil {
+			return nil, fmt.Errorf("Emissions record %s: %s", recordKey, err.Error())
+		}
+		results = append(results, EmissionsRecordResult{Key: recordKey, Record: record})
+	}
+	return results, nil
+}
@@ -0,0 +1,174 @@
+package contract
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"emissions/events"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+const testIssuer = "0x2F5ee4b3d8E7C1A6d5F4c3B2a1908F7e6D5c4B3a"
+
+func TestTokenizeEmissionsRecords(t *testing.T) {
+	stub := newTestStub(t)
+	recordArgs := func(utilityID string, emissionsAmount string) []string {
+		return []string{calcInputJSON(utilityID, "MyCompany", "2020-01-01", "2020-01-31", 1650, "KWH"), emissionsAmount, "TONS", "430", "1220", "", "", ""}
+	}
+	mustInvoke(t, stub, "createEmissionRecord", recordArgs("Utility1", "0.6328")...)
+	mustInvoke(t, stub, "createEmissionRecord", recordArgs("Utility2", "0.6711")...)
+	mustInvoke(t, stub, "createEmissionRecord", recordArgs("Utility3", "0.5944")...)
+	key1 := emissionsRecordID("Utility1", "MyCompany", "2020-01-01", "2020-01-31")
+	key2 := emissionsRecordID("Utility2", "MyCompany", "2020-01-01", "2020-01-31")
+	key3 := emissionsRecordID("Utility3", "MyCompany", "2020-01-01", "2020-01-31")
+	keys := func(keys ...string) string {
+		keysAsBytes, _ := json.Marshal(keys)
+		return string(keysAsBytes)
+	}
+
+	mustInvoke(t, stub, "tokenizeEmissionsRecords", "12", testIssuer, keys(key1, key2))
+	data, err := lastEvent(t, stub).RecordTokenizedData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.TokenID != "12" || data.IssuedBy != testIssuer || strings.Join(data.RecordKeys, ",") != key1+","+key2 {
+		t.Errorf("unexpected event data %+v", data)
+	}
+
+	tests := []struct {
+		name     string
+		function string
+		args     []string
+		wantErr  string
+	}{
+		{"token ids are integers", "tokenizeEmissionsRecords", []string{"token-1", testIssuer, keys(key3)}, "tokenId must be a positive integer"},
+		{"issuers are addresses", "tokenizeEmissionsRecords", []string{"13", "issuer", keys(key3)}, "issuedBy must be an address"},
+		{"records exist", "tokenizeEmissionsRecords", []string{"13", testIssuer, `["Utility9"]`}, "does not exist: Utility9"},
+		{"records are listed once", "tokenizeEmissionsRecords", []string{"13", testIssuer, keys(key3, key3)}, "listed more than once"},
+		{"records are tokenized once", "tokenizeEmissionsRecords", []string{"13", testIssuer, keys(key3, key2)}, "already tokenized as token 12"},
+		{"tokens are issued once", "tokenizeEmissionsRecords", []string{"12", testIssuer, keys(key3)}, "already linked"},
+		{"amounts of tokenized records cannot change", "createEmissionRecord", recordArgs("Utility1", "0.7"), "amounts cannot change"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := stub.MockInvoke("tx", toByteArgs(tt.function, tt.args...))
+			if response.Status == shim.OK || !strings.Contains(response.Message, tt.wantErr) {
+				t.Errorf("%s returned %d %q, want an error containing %q", tt.function, response.Status, response.Message, tt.wantErr)
+			}
+		})
+	}
+
+	// other fields of a tokenized record may still be corrected, and it keeps its token
+	args := recordArgs("Utility1", "0.6328")
+	args[6] = "https://example.com/bill.pdf"
+	record := EmissionsRecord{}
+	if err := json.Unmarshal(mustInvoke(t, stub, "createEmissionRecord", args...), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.URL != args[6] || record.TokenID != "12" || record.TokenIssuedBy != testIssuer {
+		t.Errorf("unexpected updated record %+v", record)
+	}
+
+	results := []EmissionsRecordResult{}
+	if err := json.Unmarshal(mustInvoke(t, stub, "getEmissionsRecordsByToken", "12"), &results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Key+results[1].Key != key1+key2 && results[0].Key+results[1].Key != key2+key1 {
+		t.Fatalf("unexpected records of token 12 %+v", results)
+	}
+	if err := json.Unmarshal(mustInvoke(t, stub, "getEmissionsRecordsByToken", "13"), &results); err != nil || len(results) != 0 {
+		t.Errorf("token 13 has records %+v, %v", results, err)
+	}
+	if stub.Event != nil && stub.Event.EventName == string(events.RecordTokenized) {
+		t.Errorf("a query set the event %s", stub.Event.EventName)
+	}
+}
+
+func TestCheckTokenizedAmounts(t *testing.T) {
+	tokenized := func() *EmissionsRecord {
+		return &EmissionsRecord{UUID: "key", TokenID: "12", EnergyUseAmount: 1650, EnergyUseUom: "KWH", EmissionsAmount: 0.825, EmissionsUom: "tons",
+			RenewableEnergyUseAmount: 500, NonrenewableEnergyUseAmount: 1150, URL: "https://example.com/bill.pdf",
+			MarketBased: &MarketBasedEmissions{EmissionsAmount: 0.74, EmissionsUom: "tons", InstrumentsEnergyUseAmount: 500, ResidualEnergyUseAmount: 1150,
+				Instruments: []AppliedInstrument{{InstrumentID: "PPA-2", InstrumentType: "PPA", EnergyUseAmount: 500, EmissionsAmount: 0.05}}},
+			GasEmissions: map[string]float64{"CO2": 0.8, "CH4": 0.0005, "N2O": 0.00008}, GWPSet: "AR5_100",
+			ActivityAmount: 1650, ActivityUom: "KWH", AllocationShare: 0.25}
+	}
+	tests := []struct {
+		name   string
+		change func(record *EmissionsRecord)
+		wantOK bool
+	}{
+		{"unchanged", func(record *EmissionsRecord) {}, true},
+		{"url", func(record *EmissionsRecord) { record.URL = "" }, true},
+		{"energy use", func(record *EmissionsRecord) { record.EnergyUseAmount = 1.65; record.EnergyUseUom = "MWH" }, false},
+		{"emissions", func(record *EmissionsRecord) { record.EmissionsAmount = 0.9 }, false},
+		{"renewable energy use", func(record *EmissionsRecord) { record.RenewableEnergyUseAmount = 0 }, false},
+		{"market-based emissions", func(record *EmissionsRecord) { record.MarketBased.EmissionsAmount = 0.14 }, false},
+		{"instruments applied", func(record *EmissionsRecord) { record.MarketBased.Instruments = nil }, false},
+		{"no market-based emissions", func(record *EmissionsRecord) { record.MarketBased = nil }, false},
+		{"emissions of a gas", func(record *EmissionsRecord) { record.GasEmissions["CH4"] = 0.0006 }, false},
+		{"no gas emissions", func(record *EmissionsRecord) { record.GasEmissions = nil }, false},
+		{"gwp set", func(record *EmissionsRecord) { record.GWPSet = "AR4_100" }, false},
+		{"activity", func(record *EmissionsRecord) { record.ActivityAmount = 1700 }, false},
+		{"activity unit", func(record *EmissionsRecord) { record.ActivityUom = "MWH" }, false},
+		{"allocation share", func(record *EmissionsRecord) { record.AllocationShare = 0.5 }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := tokenized()
+			tt.change(record)
+			if err := checkTokenizedAmounts(tokenized(), record); (err == nil) != tt.wantOK {
+				t.Errorf("got %v, want ok %v", err, tt.wantOK)
+			}
+		})
+	}
+
+	existing := tokenized()
+	existing.TokenID = ""
+	if err := checkTokenizedAmounts(existing, &EmissionsRecord{}); err != nil {
+		t.Errorf("a record that is not tokenized cannot change: %v", err)
+	}
+}
+
+func TestInitLedgerKeepsTokenizedRecords(t *testing.T) {
+	stub := newTestStub(t)
+	mustInvoke(t, stub, "initLedger")
+	key := emissionsRecordID("Utility1", "MyCOmpany1", "2020-01-02", "2020-01-20")
+	mustInvoke(t, stub, "tokenizeEmissionsRecords", "12", testIssuer, `["`+key+`"]`)
+
+	mustInvoke(t, stub, "initLedger")
+	record := EmissionsRecord{}
+	if err := json.Unmarshal(mustInvoke(t, stub, "getEmissionRecord", key), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.TokenID != "12" || record.TokenIssuedBy != testIssuer {
+		t.Errorf("the seeded record lost its token: %+v", record)
+	}
+}
+
+func TestTokenizingRecordsTheSubmitter(t *testing.T) {
+	stub := newTestStub(t)
+	mustInvoke(t, stub, "initLedger")
+	key := emissionsRecordID("Utility1", "MyCOmpany1", "2020-01-02", "2020-01-20")
+	submittedBy := func() string {
+		record := EmissionsRecord{}
+		if err := json.Unmarshal(mustInvoke(t, stub, "getEmissionRecord", key), &record); err != nil {
+			t.Fatal(err)
+		}
+		return record.SubmittedBy
+	}
+	if got := submittedBy(); got != "Org1MSP" {
+		t.Errorf("the seeded record was submitted by %q, want Org1MSP", got)
+	}
+
+	// the history of the record names the MSP of each write, so tokenizing it records the MSP of the auditor that tokenized it
+	if err := stub.SetIdentity("Org2MSP", map[string]string{"role": "auditor"}); err != nil {
+		t.Fatal(err)
+	}
+	mustInvoke(t, stub, "tokenizeEmissionsRecords", "12", testIssuer, `["`+key+`"]`)
+	if got := submittedBy(); got != "Org2MSP" {
+		t.Errorf("the tokenized record was submitted by %q, want Org2MSP", got)
+	}
+}
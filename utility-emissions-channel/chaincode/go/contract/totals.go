@@ -0,0 +1,243 @@
+// Aggregation of emissions records in Golang
+
+package contract
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/* groupings of getEmissionsTotals */
+const (
+	groupByUtility  = "utility"
+	groupByMonth    = "month"
+	groupByYear     = "year"
+	groupByScope    = "scope"
+	groupByCategory = "category"
+)
+
+/* energy totals are reported in kWh, the unit of utility bills */
+const energyUomKwh = "KWH"
+
+// EmissionsTotal sums the records of a group, each pro-rated to the days of its period in the group.
+// The energy use amounts are those of the electricity of Scope 2 records.
+// Records is the number of records with days in the group. The market-based emissions of a record without them are its emissions.
+type EmissionsTotal struct {
+	Group                       string  `json:"group"`
+	Records                     int     `json:"records"`
+	EmissionsAmount             float64 `json:"emissionsAmount"`
+	MarketBasedEmissionsAmount  float64 `json:"marketBasedEmissionsAmount"`
+	EnergyUseAmount             float64 `json:"energyUseAmount"`
+	RenewableEnergyUseAmount    float64 `json:"renewableEnergyUseAmount"`
+	NonrenewableEnergyUseAmount float64 `json:"nonrenewableEnergyUseAmount"`
+}
+
+// EmissionsTotals is the response of getEmissionsTotals; emissions are in tons and energy in kWh
+type EmissionsTotals struct {
+	PartyID      string           `json:"partyId"`
+	FromDate     string           `json:"fromDate"`
+	ThruDate     string           `json:"thruDate"`
+	GroupBy      string           `json:"groupBy"`
+	EmissionsUom string           `json:"emissionsUom"`
+	EnergyUom    string           `json:"energyUom"`
+	Total        EmissionsTotal   `json:"total"`
+	Groups       []EmissionsTotal `json:"groups"`
+}
+
+/* recordAmounts are the amounts of a record in tons and kWh, summed exactly */
+type recordAmounts struct {
+	records      int
+	emissions    *big.Rat
+	marketBased  *big.Rat
+	energy       *big.Rat
+	renewable    *big.Rat
+	nonrenewable *big.Rat
+}
+
+func newRecordAmounts() *recordAmounts {
+	return &recordAmounts{emissions: new(big.Rat), marketBased: new(big.Rat), energy: new(big.Rat), renewable: new(big.Rat), nonrenewable: new(big.Rat)}
+}
+
+/* add adds the share of the amounts of a record */
+func (a *recordAmounts) add(amounts *recordAmounts, share *big.Rat) {
+	a.records++
+	a.emissions.Add(a.emissions, new(big.Rat).Mul(amounts.emissions, share))
+	a.marketBased.Add(a.marketBased, new(big.Rat).Mul(amounts.marketBased, share))
+	a.energy.Add(a.energy, new(big.Rat).Mul(amounts.energy, share))
+	a.renewable.Add(a.renewable, new(big.Rat).Mul(amounts.renewable, share))
+	a.nonrenewable.Add(a.nonrenewable, new(big.Rat).Mul(amounts.nonrenewable, share))
+}
+
+func (a *recordAmounts) total(group string) EmissionsTotal {
+	emissions, _ := a.emissions.Float64()
+	marketBased, _ := a.marketBased.Float64()
+	energy, _ := a.energy.Float64()
+	renewable, _ := a.renewable.Float64()
+	nonrenewable, _ := a.nonrenewable.Float64()
+	return EmissionsTotal{Group: group, Records: a.records, EmissionsAmount: emissions, MarketBasedEmissionsAmount: marketBased, EnergyUseAmount: energy,
+		RenewableEnergyUseAmount: renewable, NonrenewableEnergyUseAmount: nonrenewable}
+}
+
+/* amountsOfRecord converts the amounts of a record to tons and kWh; only Scope 2 records count as energy use, since Scope 1 records carry the heat content of their fuel */
+func amountsOfRecord(record *EmissionsRecord) (*recordAmounts, error) {
+	amounts := newRecordAmounts()
+	marketBasedAmount, marketBasedUom := record.EmissionsAmount, record.EmissionsUom
+	if record.MarketBased != nil {
+		marketBasedAmount, marketBasedUom = record.MarketBased.EmissionsAmount, record.MarketBased.EmissionsUom
+	}
+	energyUseAmount, renewableEnergyUseAmount, nonrenewableEnergyUseAmount := 0.0, 0.0, 0.0
+	if record.Scope == emissionsScope2 {
+		energyUseAmount, renewableEnergyUseAmount, nonrenewableEnergyUseAmount = record.EnergyUseAmount, record.RenewableEnergyUseAmount, record.NonrenewableEnergyUseAmount
+	}
+	converted := []struct {
+		value float64
+		uom   string
+		toUom string
+		into  *big.Rat
+	}{
+		{record.EmissionsAmount, record.EmissionsUom, emissionsUomTons, amounts.emissions},
+		{marketBasedAmount, marketBasedUom, emissionsUomTons, amounts.marketBased},
+		{energyUseAmount, record.EnergyUseUom, energyUomKwh, amounts.energy},
+		{renewableEnergyUseAmount, record.EnergyUseUom, energyUomKwh, amounts.renewable},
+		{nonrenewableEnergyUseAmount, record.EnergyUseUom, energyUomKwh, amounts.nonrenewable},
+	}
+	for _, amount := range converted {
+		// an emissions amount of 0 may have no unit
+		if amount.value == 0 {
+			continue
+		}
+		value, err := ratFromFloat(amount.value)
+		if err != nil {
+			return nil, err
+		}
+		value, err = convertRat(value, amount.uom, amount.toUom)
+		if err != nil {
+			return nil, err
+		}
+		amount.into.Set(value)
+	}
+	return amounts, nil
+}
+
+/* categoryRank orders category groups: the Scope 1 categories, purchased electricity, then the Scope 3 categories by number */
+func categoryRank(category string) int {
+	switch category {
+	case categoryStationaryCombustion:
+		return 0
+	case categoryMobileCombustion:
+		return 1
+	case categoryPurchasedElectricity:
+		return 2
+	}
+	if number := scope3CategoryNumber(category); number != 0 {
+		return 2 + number
+	}
+	return 3 + len(scope3Categories)
+}
+
+/* Sum the emissions and energy use of a party over a period, grouped by utility, month, year, scope or category */
+
+func (s *EmissionsContract) GetEmissionsTotals(ctx contractapi.TransactionContextInterface, partyId string, fromDate string, thruDate string, groupBy string) (*EmissionsTotals, error) {
+	APIstub := ctx.GetStub()
+	partyID, grouping := partyId, strings.ToLower(strings.TrimSpace(groupBy))
+	requested, err := parsePeriod(fromDate, thruDate)
+	if err != nil {
+		return nil, err
+	}
+	switch grouping {
+	case groupByUtility, groupByMonth, groupByYear, groupByScope, groupByCategory:
+	default:
+		return nil, fmt.Errorf("groupBy must be utility, month, year, scope or category, got %q", groupBy)
+	}
+
+	resultsIterator, err := APIstub.GetStateByPartialCompositeKey(emissionsRecordPartyIndex, []string{partyID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	total := newRecordAmounts()
+	groups := map[string]*recordAmounts{}
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, compositeKeyParts, err := APIstub.SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return nil, err
+		}
+		recordKey := compositeKeyParts[3]
+		recordPeriod, err := parsePeriod(compositeKeyParts[1], compositeKeyParts[2])
+		if err != nil {
+			return nil, fmt.Errorf("Emissions record %s: %s", recordKey, err.Error())
+		}
+		if !recordPeriod.overlaps(requested) {
+			continue
+		}
+
+		recordAsBytes, err := APIstub.GetState(recordKey)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get emissions record: %s", err.Error())
+		} else if recordAsBytes == nil {
+			return nil, fmt.Errorf("Emissions record %s is indexed but does not exist", recordKey)
+		}
+		record, err := decodeEmissionsRecord(recordAsBytes)
+		if err != nil {
+			return nil, fmt.Errorf("Emissions record %s: %s", recordKey, err.Error())
+		}
+		amounts, err := amountsOfRecord(record)
+		if err != nil {
+			return nil, fmt.Errorf("Emissions record %s: %s", recordKey, err.Error())
+		}
+
+		// pro-rate the record to the days of its period within the requested period, and within each group
+		overlap := recordPeriod.intersect(requested)
+		var pieces map[string]period
+		switch grouping {
+		case groupByUtility:
+			pieces = map[string]period{record.UtilityID: overlap}
+		case groupByScope:
+			pieces = map[string]period{strconv.Itoa(record.Scope): overlap}
+		case groupByCategory:
+			pieces = map[string]period{record.category(): overlap}
+		default:
+			pieces = overlap.split(grouping)
+		}
+		total.add(amounts, big.NewRat(overlap.days(), recordPeriod.days()))
+		for group, piece := range pieces {
+			if groups[group] == nil {
+				groups[group] = newRecordAmounts()
+			}
+			groups[group].add(amounts, big.NewRat(piece.days(), recordPeriod.days()))
+		}
+	}
+
+	names := []string{}
+	for group := range groups {
+		names = append(names, group)
+	}
+	sort.Strings(names)
+	if grouping == groupByCategory {
+		sort.SliceStable(names, func(i, j int) bool { return categoryRank(names[i]) < categoryRank(names[j]) })
+	}
+	totals := &EmissionsTotals{
+		PartyID:      partyID,
+		FromDate:     requested.from.Format(dateLayout),
+		ThruDate:     requested.thru.Format(dateLayout),
+		GroupBy:      grouping,
+		EmissionsUom: emissionsUomTons,
+		EnergyUom:    energyUomKwh,
+		Total:        total.total(""),
+		Groups:       []EmissionsTotal{},
+	}
+	for _, group := range names {
+		totals.Groups = append(totals.Groups, groups[group].total(group))
+	}
+	return totals, nil
+}
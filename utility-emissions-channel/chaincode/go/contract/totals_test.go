@@ -0,0 +1,81 @@
+package contract
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+func TestGetEmissionsTotals(t *testing.T) {
+	stub := newTestStub(t)
+	//                                 utilityId, partyId, fromDate, thruDate, energyUseAmount, energyUseUom, emissionsAmount, emissionsUom, renewable, nonrenewable
+	mustInvoke(t, stub, "createEmissionRecord", calcInputJSON("Utility1", "MyCompany", "2020-01-15", "2020-02-14", 3100, "KWH"), "3.1", "tons", "1000", "2100", "", "", "")
+	mustInvoke(t, stub, "createEmissionRecord", calcInputJSON("Utility2", "MyCompany", "2019-12-01", "2020-01-31", 6.2, "MWH"), "6200", "kg", "0", "6.2", "", "", "")
+	mustInvoke(t, stub, "createEmissionRecord", calcInputJSON("Utility3", "OtherCompany", "2020-03-01", "2020-03-31", 1000, "KWH"), "1", "tons", "0", "1000", "", "", "")
+	mustInvoke(t, stub, "createEmissionRecord", calcInputJSON("Utility4", "MyCompany", "2021-01-01", "2021-01-31", 1000, "KWH"), "1", "tons", "0", "1000", "", "", "")
+
+	tests := []struct {
+		groupBy    string
+		wantGroups []EmissionsTotal
+	}{
+		{"month", []EmissionsTotal{
+			{Group: "2020-01", Records: 2, EmissionsAmount: 4.8, EnergyUseAmount: 4800, RenewableEnergyUseAmount: 17.0 / 31 * 1000, NonrenewableEnergyUseAmount: 17.0/31*2100 + 3100},
+			{Group: "2020-02", Records: 1, EmissionsAmount: 1.4, EnergyUseAmount: 1400, RenewableEnergyUseAmount: 14.0 / 31 * 1000, NonrenewableEnergyUseAmount: 14.0 / 31 * 2100},
+		}},
+		{"utility", []EmissionsTotal{
+			{Group: "Utility1", Records: 1, EmissionsAmount: 3.1, EnergyUseAmount: 3100, RenewableEnergyUseAmount: 1000, NonrenewableEnergyUseAmount: 2100},
+			{Group: "Utility2", Records: 1, EmissionsAmount: 3.1, EnergyUseAmount: 3100, NonrenewableEnergyUseAmount: 3100},
+		}},
+		{"Year", []EmissionsTotal{
+			{Group: "2020", Records: 2, EmissionsAmount: 6.2, EnergyUseAmount: 6200, RenewableEnergyUseAmount: 1000, NonrenewableEnergyUseAmount: 5200},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.groupBy, func(t *testing.T) {
+			totals := EmissionsTotals{}
+			if err := json.Unmarshal(mustInvoke(t, stub, "getEmissionsTotals", "MyCompany", "2020-01-01", "2020-12-31", tt.groupBy), &totals); err != nil {
+				t.Fatal(err)
+			}
+			if totals.EmissionsUom != emissionsUomTons || totals.EnergyUom != energyUomKwh || totals.Total.Records != 2 || !closeTo(totals.Total.EmissionsAmount, 6.2) {
+				t.Errorf("unexpected totals %+v", totals)
+			}
+			if len(totals.Groups) != len(tt.wantGroups) {
+				t.Fatalf("got groups %+v, want %+v", totals.Groups, tt.wantGroups)
+			}
+			for i, want := range tt.wantGroups {
+				got := totals.Groups[i]
+				if got.Group != want.Group || got.Records != want.Records || !closeTo(got.EmissionsAmount, want.EmissionsAmount) ||
+					!closeTo(got.EnergyUseAmount, want.EnergyUseAmount) || !closeTo(got.RenewableEnergyUseAmount, want.RenewableEnergyUseAmount) ||
+					!closeTo(got.NonrenewableEnergyUseAmount, want.NonrenewableEnergyUseAmount) {
+					t.Errorf("group %d = %+v, want %+v", i, got, want)
+				}
+			}
+		})
+	}
+
+	// creating a record again replaces it in the totals
+	mustInvoke(t, stub, "createEmissionRecord", calcInputJSON("Utility1", "MyCompany", "2020-01-15", "2020-02-14", 3100, "KWH"), "4.1", "tons", "1000", "2100", "", "", "")
+	totals := EmissionsTotals{}
+	if err := json.Unmarshal(mustInvoke(t, stub, "getEmissionsTotals", "MyCompany", "2020-01-01", "2020-12-31", "year"), &totals); err != nil {
+		t.Fatal(err)
+	}
+	if totals.Total.Records != 2 || !closeTo(totals.Total.EmissionsAmount, 7.2) {
+		t.Errorf("unexpected totals after the update %+v", totals.Total)
+	}
+
+	for _, args := range [][]string{
+		{"MyCompany", "2020-12-31", "2020-01-01", "year"},
+		{"MyCompany", "2020-01-01", "2020-13-01", "year"},
+		{"MyCompany", "2020-01-01", "2020-12-31", "week"},
+	} {
+		if response := stub.MockInvoke("tx", toByteArgs("getEmissionsTotals", args...)); response.Status == shim.OK {
+			t.Errorf("getEmissionsTotals %v did not fail", args)
+		}
+	}
+}
+
+func closeTo(got float64, want float64) bool {
+	return math.Abs(got-want) < 1e-9*math.Max(1, math.Abs(want))
+}
@@ -0,0 +1,194 @@
+// Unit of measure conversion in Golang
+
+package contract
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+/* every unit belongs to one dimension; only units of the same dimension convert into each other */
+const (
+	uomDimensionEnergy   = "energy"
+	uomDimensionMass     = "mass"
+	uomDimensionVolume   = "volume"
+	uomDimensionDistance = "distance"
+	uomDimensionFreight  = "freight"
+	uomDimensionTravel   = "travel"
+)
+
+// unitOfMeasure is a unit and the exact factor converting it to the base unit of its dimension (Wh for energy, kg for mass, l for volume, m for distance,
+// tonne-km for freight and passenger-km for travel)
+type unitOfMeasure struct {
+	dimension string
+	factor    *big.Rat
+}
+
+/* newUnit builds a unit from an exact decimal or fraction string, e.g. "0.45359237" or "105505585262/360000" */
+func newUnit(dimension string, factor string) unitOfMeasure {
+	r, ok := new(big.Rat).SetString(factor)
+	if !ok {
+		panic("invalid unit of measure factor " + factor)
+	}
+	return unitOfMeasure{dimension: dimension, factor: r}
+}
+
+/* unitsOfMeasure is keyed by lower case unit name; the mass units keep the Node chaincode meaning of ton, tons and mt */
+var unitsOfMeasure = map[string]unitOfMeasure{
+	// energy, base unit Wh; 1 Btu (IT) = 1055.05585262 J and 1 Wh = 3600 J
+	"wh":     newUnit(uomDimensionEnergy, "1"),
+	"kwh":    newUnit(uomDimensionEnergy, "1000"),
+	"mwh":    newUnit(uomDimensionEnergy, "1000000"),
+	"gwh":    newUnit(uomDimensionEnergy, "1000000000"),
+	"twh":    newUnit(uomDimensionEnergy, "1000000000000"),
+	"btu":    newUnit(uomDimensionEnergy, "105505585262/360000000000"),
+	"mmbtu":  newUnit(uomDimensionEnergy, "105505585262/360000"),
+	"therm":  newUnit(uomDimensionEnergy, "105505585262/3600000"),
+	"therms": newUnit(uomDimensionEnergy, "105505585262/3600000"),
+	"mj":     newUnit(uomDimensionEnergy, "1000000/3600"),
+	"gj":     newUnit(uomDimensionEnergy, "1000000000/3600"),
+
+	// mass, base unit kg
+	"g":          newUnit(uomDimensionMass, "0.001"),
+	"kg":         newUnit(uomDimensionMass, "1"),
+	"t":          newUnit(uomDimensionMass, "1000"),
+	"ton":        newUnit(uomDimensionMass, "1000"),
+	"tons":       newUnit(uomDimensionMass, "1000"),
+	"tonne":      newUnit(uomDimensionMass, "1000"),
+	"tonnes":     newUnit(uomDimensionMass, "1000"),
+	"short ton":  newUnit(uomDimensionMass, "907.18474"),
+	"short tons": newUnit(uomDimensionMass, "907.18474"),
+	"short_ton":  newUnit(uomDimensionMass, "907.18474"),
+	"short_tons": newUnit(uomDimensionMass, "907.18474"),
+	"lb":         newUnit(uomDimensionMass, "0.45359237"),
+	"lbs":        newUnit(uomDimensionMass, "0.45359237"),
+	"kt":         newUnit(uomDimensionMass, "1000000"),
+	"mt":         newUnit(uomDimensionMass, "1000000000"),
+	"pg":         newUnit(uomDimensionMass, "1000000000"),
+	"gt":         newUnit(uomDimensionMass, "1000000000000"),
+
+	// volume, base unit l; 1 US gallon = 3.785411784 l, 1 cubic foot = 28.316846592 l and 1 barrel = 42 US gallons
+	"l":       newUnit(uomDimensionVolume, "1"),
+	"liter":   newUnit(uomDimensionVolume, "1"),
+	"liters":  newUnit(uomDimensionVolume, "1"),
+	"litre":   newUnit(uomDimensionVolume, "1"),
+	"litres":  newUnit(uomDimensionVolume, "1"),
+	"m3":      newUnit(uomDimensionVolume, "1000"),
+	"gal":     newUnit(uomDimensionVolume, "3.785411784"),
+	"gallon":  newUnit(uomDimensionVolume, "3.785411784"),
+	"gallons": newUnit(uomDimensionVolume, "3.785411784"),
+	"bbl":     newUnit(uomDimensionVolume, "158.987294928"),
+	"scf":     newUnit(uomDimensionVolume, "28.316846592"),
+	"ft3":     newUnit(uomDimensionVolume, "28.316846592"),
+	"ccf":     newUnit(uomDimensionVolume, "2831.6846592"),
+	"mcf":     newUnit(uomDimensionVolume, "28316.846592"),
+
+	// distance, base unit m
+	"m":     newUnit(uomDimensionDistance, "1"),
+	"km":    newUnit(uomDimensionDistance, "1000"),
+	"mi":    newUnit(uomDimensionDistance, "1609.344"),
+	"mile":  newUnit(uomDimensionDistance, "1609.344"),
+	"miles": newUnit(uomDimensionDistance, "1609.344"),
+
+	// freight, base unit tonne-km; a ton-mile is a short ton carried a mile
+	"tkm":       newUnit(uomDimensionFreight, "1"),
+	"t-km":      newUnit(uomDimensionFreight, "1"),
+	"tonne-km":  newUnit(uomDimensionFreight, "1"),
+	"ton-mile":  newUnit(uomDimensionFreight, "1.45997231821056"),
+	"ton-miles": newUnit(uomDimensionFreight, "1.45997231821056"),
+
+	// travel, base unit passenger-km
+	"pkm":             newUnit(uomDimensionTravel, "1"),
+	"passenger-km":    newUnit(uomDimensionTravel, "1"),
+	"passenger-mile":  newUnit(uomDimensionTravel, "1.609344"),
+	"passenger-miles": newUnit(uomDimensionTravel, "1.609344"),
+}
+
+/* lookupUom finds a single unit, ignoring case and surrounding spaces */
+func lookupUom(uom string) (unitOfMeasure, error) {
+	unit, ok := unitsOfMeasure[strings.ToLower(strings.TrimSpace(uom))]
+	if !ok {
+		return unitOfMeasure{}, fmt.Errorf("Unknown UOM [%s]", uom)
+	}
+	return unit, nil
+}
+
+/* compoundFactor returns the base unit factor and dimensions of a unit or ratio such as lb/MWh */
+func compoundFactor(uom string) (*big.Rat, []string, error) {
+	parts := strings.Split(uom, "/")
+	if len(parts) > 2 {
+		return nil, nil, fmt.Errorf("Unsupported UOM [%s]: only one ratio is allowed", uom)
+	}
+	numerator, err := lookupUom(parts[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(parts) == 1 {
+		return new(big.Rat).Set(numerator.factor), []string{numerator.dimension}, nil
+	}
+	denominator, err := lookupUom(parts[1])
+	if err != nil {
+		return nil, nil, err
+	}
+	factor := new(big.Rat).Quo(numerator.factor, denominator.factor)
+	return factor, []string{numerator.dimension, denominator.dimension}, nil
+}
+
+/* uomDimensions names the dimensions of a unit or ratio, e.g. mass/energy for kg/MMBtu */
+func uomDimensions(uom string) (string, error) {
+	_, dimensions, err := compoundFactor(uom)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(dimensions, "/"), nil
+}
+
+/* uomConversionFactor returns the exact factor converting a value in fromUom to toUom */
+func uomConversionFactor(fromUom string, toUom string) (*big.Rat, error) {
+	fromFactor, fromDimensions, err := compoundFactor(fromUom)
+	if err != nil {
+		return nil, err
+	}
+	toFactor, toDimensions, err := compoundFactor(toUom)
+	if err != nil {
+		return nil, err
+	}
+	if strings.Join(fromDimensions, "/") != strings.Join(toDimensions, "/") {
+		return nil, fmt.Errorf("Cannot convert %s (%s) to %s (%s)", fromUom, strings.Join(fromDimensions, "/"), toUom, strings.Join(toDimensions, "/"))
+	}
+	return new(big.Rat).Quo(fromFactor, toFactor), nil
+}
+
+/* convertRat converts an exact value from fromUom to toUom */
+func convertRat(value *big.Rat, fromUom string, toUom string) (*big.Rat, error) {
+	factor, err := uomConversionFactor(fromUom, toUom)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Rat).Mul(value, factor), nil
+}
+
+/* ratFromFloat takes the shortest decimal that round trips value, so 0.1 is 1/10 rather than its binary approximation */
+func ratFromFloat(value float64) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(strconv.FormatFloat(value, 'g', -1, 64))
+	if !ok {
+		return nil, fmt.Errorf("Cannot convert %v", value)
+	}
+	return r, nil
+}
+
+/* convertValues converts value from fromUom to toUom, e.g. 1650 KWH to 1.65 MWH or 1000 lb/MWh to 0.45359237 t/MWh */
+func convertValues(value float64, fromUom string, toUom string) (float64, error) {
+	exact, err := ratFromFloat(value)
+	if err != nil {
+		return 0, err
+	}
+	converted, err := convertRat(exact, fromUom, toUom)
+	if err != nil {
+		return 0, err
+	}
+	result, _ := converted.Float64()
+	return result, nil
+}
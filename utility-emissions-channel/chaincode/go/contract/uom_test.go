@@ -0,0 +1,156 @@
+package contract
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestUomConversionFactor(t *testing.T) {
+	tests := []struct {
+		from string
+		to   string
+		want string
+	}{
+		{"KWH", "MWH", "1/1000"},
+		{"MWH", "KWH", "1000"},
+		{" kwh ", "Wh", "1000"},
+		{"MMBTU", "THERMS", "10"},
+		{"MMBTU", "KWH", "105505585262/360000000"},
+		{"GJ", "MWH", "5/18"},
+		{"SHORT TONS", "LB", "2000"},
+		{"TONS", "KG", "1000"},
+		{"MT", "KT", "1000"},
+		{"GAL", "L", "3.785411784"},
+		{"BBL", "GAL", "42"},
+		{"MCF", "CCF", "10"},
+		{"MI", "KM", "1.609344"},
+		{"TON-MILES", "TKM", "1.45997231821056"},
+		{"PASSENGER-MILES", "PKM", "1.609344"},
+		{"LB/MWH", "TONS/MWH", "0.00045359237"},
+		{"KG/MMBTU", "TONS/MWH", "360000000/105505585262"},
+		{"KG/GAL", "KG/L", "1000000000/3785411784"},
+		{"MMBTU/GAL", "KWH/L", "17127530075/221225364"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from+" to "+tt.to, func(t *testing.T) {
+			want, ok := new(big.Rat).SetString(tt.want)
+			if !ok {
+				t.Fatalf("invalid want %s", tt.want)
+			}
+			got, err := uomConversionFactor(tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Cmp(want) != 0 {
+				t.Errorf("got %s, want %s", got.RatString(), want.RatString())
+			}
+
+			// converting back is the exact inverse
+			back, err := uomConversionFactor(tt.to, tt.from)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if product := new(big.Rat).Mul(got, back); product.Cmp(big.NewRat(1, 1)) != 0 {
+				t.Errorf("round trip factor is %s", product.RatString())
+			}
+		})
+	}
+}
+
+func TestUnitsOfMeasureRoundTrip(t *testing.T) {
+	bases := map[string]string{
+		uomDimensionEnergy:   "wh",
+		uomDimensionMass:     "kg",
+		uomDimensionVolume:   "l",
+		uomDimensionDistance: "m",
+		uomDimensionFreight:  "tkm",
+		uomDimensionTravel:   "pkm",
+	}
+	for name, unit := range unitsOfMeasure {
+		base, ok := bases[unit.dimension]
+		if !ok {
+			t.Errorf("%s has the unknown dimension %s", name, unit.dimension)
+			continue
+		}
+		value, _ := new(big.Rat).SetString("1234.5678")
+		there, err := convertRat(value, strings.ToUpper(name), base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		back, err := convertRat(there, base, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if back.Cmp(value) != 0 || there.Cmp(new(big.Rat).Mul(value, unit.factor)) != 0 {
+			t.Errorf("%s: 1234.5678 converts to %s %s and back to %s", name, there.RatString(), base, back.RatString())
+		}
+	}
+}
+
+func TestConvertValues(t *testing.T) {
+	tests := []struct {
+		value float64
+		from  string
+		to    string
+		want  float64
+	}{
+		{1650, "KWH", "MWH", 1.65},
+		{0.1, "MWH", "KWH", 100},
+		{1000, "LB/MWH", "TONS/MWH", 0.45359237},
+		{100, "THERMS", "MMBTU", 10},
+		{74.21, "KG/MMBTU", "KG/MMBTU", 74.21},
+	}
+	for _, tt := range tests {
+		got, err := convertValues(tt.value, tt.from, tt.to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%v %s = %v %s, want %v", tt.value, tt.from, got, tt.to, tt.want)
+		}
+	}
+}
+
+func TestUomDimensions(t *testing.T) {
+	tests := map[string]string{
+		"kWh":       "energy",
+		"short ton": "mass",
+		"kg/MMBtu":  "mass/energy",
+		"MMBTU/GAL": "energy/volume",
+		"KG/MI":     "mass/distance",
+		"KG/TKM":    "mass/freight",
+		"pkm":       "travel",
+	}
+	for uom, want := range tests {
+		if got, err := uomDimensions(uom); err != nil || got != want {
+			t.Errorf("uomDimensions(%q) = %q, %v, want %q", uom, got, err, want)
+		}
+	}
+}
+
+func TestUomConversionErrors(t *testing.T) {
+	tests := []struct {
+		from    string
+		to      string
+		wantErr string
+	}{
+		{"KWH", "KG", "Cannot convert KWH (energy) to KG (mass)"},
+		{"KG/MMBTU", "TONS", "Cannot convert KG/MMBTU (mass/energy) to TONS (mass)"},
+		{"KG/MMBTU", "MMBTU/KG", "Cannot convert"},
+		{"GAL", "KM", "Cannot convert"},
+		{"TKM", "PKM", "Cannot convert"},
+		{"FOO", "KWH", "Unknown UOM [FOO]"},
+		{"KWH", "", "Unknown UOM []"},
+		{"KG/FOO", "KG/KWH", "Unknown UOM [FOO]"},
+		{"KG/MWH/H", "KG/MWH", "only one ratio is allowed"},
+	}
+	for _, tt := range tests {
+		if _, err := uomConversionFactor(tt.from, tt.to); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("converting %s to %s returned %v, want an error containing %q", tt.from, tt.to, err, tt.wantErr)
+		}
+	}
+	if _, err := convertValues(1, "FOO", "KWH"); err == nil {
+		t.Error("convertValues of an unknown UOM did not fail")
+	}
+}
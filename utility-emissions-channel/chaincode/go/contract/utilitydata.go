@@ -0,0 +1,256 @@
+// Utility lookup data in Golang
+
+package contract
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/* class identifier shared with the Node chaincode */
+const utilityLookupItemClass = "org.hyperledger.blockchain-carbon-accounting.utilitylookupitem"
+
+/* division types used to select an emissions factor */
+const (
+	divisionTypeState      = "STATE"
+	divisionTypeNercRegion = "NERC_REGION"
+	divisionTypeCountry    = "COUNTRY"
+)
+
+/* composite key index listing every utility lookup item without a CouchDB query */
+const utilityLookupIndex = "utilityLookupItem~uuid"
+
+// Divisions is the grid division a utility belongs to
+type Divisions struct {
+	DivisionType string `json:"division_type"`
+	DivisionId   string `json:"division_id"`
+}
+
+// UtilityLookupItem identifies a utility and the divisions it reports under.
+// The json tags follow the Node utility lookup item, and divisions are stored as the JSON string Node parses.
+type UtilityLookupItem struct {
+	Class         string    `json:"class" metadata:",optional"`
+	UUID          string    `json:"uuid"`
+	Year          string    `json:"year" metadata:",optional"`
+	UtilityNumber string    `json:"utility_number" metadata:",optional"`
+	UtilityName   string    `json:"utility_name" metadata:",optional"`
+	Country       string    `json:"country" metadata:",optional"`
+	StateProvince string    `json:"state_province" metadata:",optional"`
+	Divisions     Divisions `json:"divisions" metadata:",optional"`
+}
+
+// UtilityIdentifierResult is one entry of getAllUtilityIdentifiers, in the same shape as the Node chaincode returns
+type UtilityIdentifierResult struct {
+	Key    string             `json:"Key"`
+	Record *UtilityLookupItem `json:"Record"`
+}
+
+/* UnmarshalJSON also accepts divisions serialized as a JSON string, as written by the Node chaincode */
+func (d *Divisions) UnmarshalJSON(data []byte) error {
+	type divisions Divisions
+	var encoded string
+	if err := json.Unmarshal(data, &encoded); err == nil {
+		if encoded == "" {
+			return nil
+		}
+		data = []byte(encoded)
+	}
+	return json.Unmarshal(data, (*divisions)(d))
+}
+
+/* MarshalJSON writes divisions as a JSON string, as the Node chaincode parses it; no divisions are an empty string */
+func (d Divisions) MarshalJSON() ([]byte, error) {
+	if d == (Divisions{}) {
+		return json.Marshal("")
+	}
+	type divisions Divisions
+	divisionsAsBytes, err := json.Marshal(divisions(d))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(string(divisionsAsBytes))
+}
+
+/* Validate checks the utility lookup item before it is written to the ledger */
+func (item *UtilityLookupItem) Validate() error {
+	if strings.TrimSpace(item.UUID) == "" {
+		return fmt.Errorf("utility uuid must be a non-empty string")
+	}
+	if strings.Contains(item.UUID, "\x00") {
+		return fmt.Errorf("utility uuid must not contain U+0000")
+	}
+	if item.StateProvince == "" && item.Divisions.DivisionType == "" {
+		return fmt.Errorf("utility %s needs a state_province or divisions", item.UUID)
+	}
+	if item.Divisions.DivisionType != "" && item.Divisions.DivisionId == "" {
+		return fmt.Errorf("utility %s divisions has a division_type but no division_id", item.UUID)
+	}
+	return nil
+}
+
+/* resolveDivision picks the division whose factor applies to the utility: its state, else its NERC region, else its country, else USA */
+func resolveDivision(item *UtilityLookupItem) (string, string, error) {
+	var divisionType, divisionId string
+	fetchedType := normalizeDivisionType(item.Divisions.DivisionType)
+	if strings.TrimSpace(item.StateProvince) != "" {
+		divisionType, divisionId = divisionTypeState, strings.TrimSpace(item.StateProvince)
+	} else if fetchedType == divisionTypeNercRegion {
+		divisionType, divisionId = divisionTypeNercRegion, item.Divisions.DivisionId
+	} else if fetchedType == divisionTypeCountry && strings.ToLower(item.Divisions.DivisionId) != "usa" {
+		divisionType, divisionId = divisionTypeCountry, item.Divisions.DivisionId
+	} else {
+		divisionType, divisionId = divisionTypeCountry, "USA"
+	}
+	if divisionId == "" {
+		return "", "", fmt.Errorf("Utility [%s] does not have a Division ID", item.UUID)
+	}
+	return divisionType, divisionId, nil
+}
+
+/* getUtilityLookupItem reads a utility lookup item from the ledger; a key holding anything else is an error */
+func getUtilityLookupItem(APIstub shim.ChaincodeStubInterface, utilityID string) (*UtilityLookupItem, error) {
+	itemAsBytes, err := APIstub.GetState(utilityID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get utility %s: %s", utilityID, err.Error())
+	} else if itemAsBytes == nil {
+		return nil, fmt.Errorf("Utility does not exist: %s", utilityID)
+	}
+	item := &UtilityLookupItem{}
+	if err := json.Unmarshal(itemAsBytes, item); err != nil {
+		return nil, fmt.Errorf("Failed to decode utility %s: %s", utilityID, err.Error())
+	} else if item.Class != utilityLookupItemClass {
+		return nil, fmt.Errorf("%s is not a utility identifier", utilityID)
+	}
+	return item, nil
+}
+
+/* getEmissionsFactorForUtility picks the grid average factor of the utility's division for the reporting year of a record */
+func getEmissionsFactorForUtility(APIstub shim.ChaincodeStubInterface, utilityID string, year int) (*UtilityEmissionsFactors, error) {
+	item, err := getUtilityLookupItem(APIstub, utilityID)
+	if err != nil {
+		return nil, err
+	}
+	factor, err := getEmissionsFactorForItem(APIstub, item, year, factorTypeGridAverage)
+	if err != nil {
+		return nil, err
+	} else if factor == nil {
+		divisionType, divisionId, _ := resolveDivision(item)
+		return nil, fmt.Errorf("No utility emissions factor found for %s %s in %d", divisionType, divisionId, year)
+	}
+	return factor, nil
+}
+
+/* getEmissionsFactorForItem picks the factor of a type of the utility's division for a year; it returns nil if there is none, rather than a factor of another year */
+func getEmissionsFactorForItem(APIstub shim.ChaincodeStubInterface, item *UtilityLookupItem, year int, factorType string) (*UtilityEmissionsFactors, error) {
+	divisionType, divisionId, err := resolveDivision(item)
+	if err != nil {
+		return nil, err
+	}
+
+	factors, err := queryUtilityFactorsByDivision(APIstub, divisionType, divisionId, fmt.Sprintf("%d", year))
+	if err != nil {
+		return nil, err
+	}
+	for i := range factors {
+		if factors[i].factorType() == factorType {
+			return &factors[i], nil
+		}
+	}
+	return nil, nil
+}
+
+/* putUtilityLookupItem writes the item under its uuid and indexes it for getAllUtilityIdentifiers */
+func putUtilityLookupItem(APIstub shim.ChaincodeStubInterface, item *UtilityLookupItem) error {
+	itemAsBytes, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	if err := APIstub.PutState(item.UUID, itemAsBytes); err != nil {
+		return err
+	}
+	indexKey, err := APIstub.CreateCompositeKey(utilityLookupIndex, []string{item.UUID})
+	if err != nil {
+		return err
+	}
+	return APIstub.PutState(indexKey, []byte{0x00})
+}
+
+/* Import a new utility identifier */
+
+func (s *EmissionsContract) ImportUtilityIdentifier(ctx contractapi.TransactionContextInterface, item UtilityLookupItem) (*UtilityLookupItem, error) {
+	APIstub := ctx.GetStub()
+	item.Class = utilityLookupItemClass
+	if err := item.Validate(); err != nil {
+		return nil, err
+	}
+
+	existingAsBytes, err := APIstub.GetState(item.UUID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get utility: %s", err.Error())
+	} else if existingAsBytes != nil {
+		return nil, fmt.Errorf("This utility already exists: %s", item.UUID)
+	}
+
+	if err := putUtilityLookupItem(APIstub, &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+/* Update an existing utility identifier */
+
+func (s *EmissionsContract) UpdateUtilityIdentifier(ctx contractapi.TransactionContextInterface, item UtilityLookupItem) (*UtilityLookupItem, error) {
+	APIstub := ctx.GetStub()
+	item.Class = utilityLookupItemClass
+	if err := item.Validate(); err != nil {
+		return nil, err
+	}
+
+	if _, err := getUtilityLookupItem(APIstub, item.UUID); err != nil {
+		return nil, err
+	}
+
+	if err := putUtilityLookupItem(APIstub, &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+/* Query a utility identifier by its uuid */
+
+func (s *EmissionsContract) GetUtilityIdentifier(ctx contractapi.TransactionContextInterface, uuid string) (*UtilityLookupItem, error) {
+	return getUtilityLookupItem(ctx.GetStub(), uuid)
+}
+
+/* Query every utility identifier */
+
+func (s *EmissionsContract) GetAllUtilityIdentifiers(ctx contractapi.TransactionContextInterface) ([]UtilityIdentifierResult, error) {
+	APIstub := ctx.GetStub()
+	resultsIterator, err := APIstub.GetStateByPartialCompositeKey(utilityLookupIndex, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	results := []UtilityIdentifierResult{}
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, compositeKeyParts, err := APIstub.SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return nil, err
+		}
+		item, err := getUtilityLookupItem(APIstub, compositeKeyParts[0])
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, UtilityIdentifierResult{Key: item.UUID, Record: item})
+	}
+	return results, nil
+}
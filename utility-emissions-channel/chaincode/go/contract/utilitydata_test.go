@@ -0,0 +1,265 @@
+package contract
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"chaincode-common/mockidentity"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+func toByteArgs(function string, args ...string) [][]byte {
+	byteArgs := [][]byte{[]byte(function)}
+	for _, arg := range args {
+		byteArgs = append(byteArgs, []byte(arg))
+	}
+	return byteArgs
+}
+
+/* newTestStub runs the contract as a client holding every role */
+func newTestStub(t *testing.T) *mockidentity.Stub {
+	t.Helper()
+	chaincode, err := NewChaincode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub, err := mockidentity.NewStub("emissions", chaincode, "Org1MSP", map[string]string{"role": "admin,auditor,factor_admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stub
+}
+
+/* utilityFactorJSON is the JSON of a factor of 100 MWH emitting co2Emissions TONS, with extra fields such as `"factorType":"RESIDUAL_MIX"` */
+func utilityFactorJSON(utilityID string, year string, divisionType string, divisionId string, co2Emissions float64, extra string) string {
+	factorAsBytes, _ := json.Marshal(UtilityEmissionsFactors{UtilityID: utilityID, Year: year, DivisionType: divisionType, DivisionId: divisionId,
+		NetGeneration: 100, NetGenerationUOM: "MWH", CO2EquivalentEmissions: co2Emissions, EmissionsUOM: "TONS"})
+	factor := string(factorAsBytes)
+	if extra != "" {
+		factor = strings.TrimSuffix(factor, "}") + "," + extra + "}"
+	}
+	return factor
+}
+
+func mustInvoke(t *testing.T, stub *mockidentity.Stub, function string, args ...string) []byte {
+	t.Helper()
+	response := stub.MockInvoke("tx-"+function, toByteArgs(function, args...))
+	if response.Status != shim.OK {
+		t.Fatalf("%s failed: %s", function, response.Message)
+	}
+	return response.Payload
+}
+
+func TestResolveDivision(t *testing.T) {
+	tests := []struct {
+		name         string
+		item         UtilityLookupItem
+		divisionType string
+		divisionId   string
+		wantErr      bool
+	}{
+		{
+			name:         "state takes precedence over divisions",
+			item:         UtilityLookupItem{UUID: "u1", StateProvince: "CA", Divisions: Divisions{DivisionType: "NERC_REGION", DivisionId: "WECC"}},
+			divisionType: divisionTypeState,
+			divisionId:   "CA",
+		},
+		{
+			name:         "nerc region without state",
+			item:         UtilityLookupItem{UUID: "u2", Divisions: Divisions{DivisionType: "nerc_region", DivisionId: "WECC"}},
+			divisionType: divisionTypeNercRegion,
+			divisionId:   "WECC",
+		},
+		{
+			name:         "non US country",
+			item:         UtilityLookupItem{UUID: "u3", Divisions: Divisions{DivisionType: "Country", DivisionId: "Germany"}},
+			divisionType: divisionTypeCountry,
+			divisionId:   "Germany",
+		},
+		{
+			name:         "US country falls back to USA",
+			item:         UtilityLookupItem{UUID: "u4", Divisions: Divisions{DivisionType: "COUNTRY", DivisionId: "usa"}},
+			divisionType: divisionTypeCountry,
+			divisionId:   "USA",
+		},
+		{
+			name:         "no divisions falls back to USA",
+			item:         UtilityLookupItem{UUID: "u5"},
+			divisionType: divisionTypeCountry,
+			divisionId:   "USA",
+		},
+		{
+			name:    "nerc region without id",
+			item:    UtilityLookupItem{UUID: "u6", Divisions: Divisions{DivisionType: "NERC_REGION"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			divisionType, divisionId, err := resolveDivision(&tt.item)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %s %s", divisionType, divisionId)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if divisionType != tt.divisionType || divisionId != tt.divisionId {
+				t.Errorf("got %s %s, want %s %s", divisionType, divisionId, tt.divisionType, tt.divisionId)
+			}
+		})
+	}
+}
+
+func TestDivisionsUnmarshalNodeFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want Divisions
+	}{
+		{"object", `{"divisions":{"division_type":"NERC_REGION","division_id":"WECC"}}`, Divisions{"NERC_REGION", "WECC"}},
+		{"string", `{"divisions":"{\"division_type\":\"NERC_REGION\",\"division_id\":\"WECC\"}"}`, Divisions{"NERC_REGION", "WECC"}},
+		{"empty string", `{"divisions":""}`, Divisions{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := UtilityLookupItem{}
+			if err := json.Unmarshal([]byte(tt.data), &item); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if item.Divisions != tt.want {
+				t.Errorf("got %+v, want %+v", item.Divisions, tt.want)
+			}
+		})
+	}
+}
+
+func TestDivisionsStoredInNodeFormat(t *testing.T) {
+	stub := newTestStub(t)
+	mustInvoke(t, stub, "importUtilityIdentifier", `{"uuid":"OBJECT","divisions":{"division_type":"NERC_REGION","division_id":"WECC"}}`)
+	mustInvoke(t, stub, "importUtilityIdentifier", `{"uuid":"STRING","divisions":"{\"division_type\":\"NERC_REGION\",\"division_id\":\"WECC\"}"}`)
+	mustInvoke(t, stub, "importUtilityIdentifier", `{"uuid":"NONE","state_province":"CA"}`)
+
+	tests := []struct {
+		uuid string
+		want string
+	}{
+		{"OBJECT", `{"division_type":"NERC_REGION","division_id":"WECC"}`},
+		{"STRING", `{"division_type":"NERC_REGION","division_id":"WECC"}`},
+		{"NONE", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.uuid, func(t *testing.T) {
+			// the Node chaincode reads divisions with JSON.parse(item.divisions)
+			stored := struct {
+				Divisions string `json:"divisions"`
+			}{}
+			if err := json.Unmarshal(stub.State[tt.uuid], &stored); err != nil {
+				t.Fatalf("divisions are not stored as a string: %s", err)
+			}
+			if stored.Divisions != tt.want {
+				t.Errorf("got divisions %q, want %q", stored.Divisions, tt.want)
+			}
+		})
+	}
+}
+
+func TestUtilityIdentifierFunctions(t *testing.T) {
+	stub := newTestStub(t)
+
+	mustInvoke(t, stub, "importUtilityIdentifier", `{"uuid":"USA_EIA_11208","year":"2019","utility_number":"11208","utility_name":"Los Angeles Department of Water & Power","country":"USA","state_province":"CA","divisions":{"division_type":"NERC_REGION","division_id":"WECC"}}`)
+	mustInvoke(t, stub, "importUtilityIdentifier", `{"uuid":"USA_EIA_252","year":"2019","utility_number":"252","utility_name":"Alaska Power Co","country":"USA","divisions":{"division_type":"NERC_REGION","division_id":"ASCC"}}`)
+
+	tests := []struct {
+		name     string
+		function string
+		args     []string
+		wantErr  bool
+	}{
+		{"import duplicate", "importUtilityIdentifier", []string{`{"uuid":"USA_EIA_252","year":"2019","divisions":{"division_type":"NERC_REGION","division_id":"ASCC"}}`}, true},
+		{"import without division", "importUtilityIdentifier", []string{`{"uuid":"X","year":"2019","country":"USA"}`}, true},
+		{"import bad divisions", "importUtilityIdentifier", []string{`{"uuid":"X","year":"2019","divisions":"{"}`}, true},
+		{"import without uuid", "importUtilityIdentifier", []string{`{"year":"2019","state_province":"CA"}`}, true},
+		{"import wrong arg count", "importUtilityIdentifier", []string{}, true},
+		{"update missing", "updateUtilityIdentifier", []string{`{"uuid":"missing","year":"2019","state_province":"CA"}`}, true},
+		{"update existing", "updateUtilityIdentifier", []string{`{"uuid":"USA_EIA_252","year":"2020","utility_number":"252","utility_name":"Alaska Power Co","country":"USA","state_province":"AK","divisions":{"division_type":"NERC_REGION","division_id":"ASCC"}}`}, false},
+		{"get existing", "getUtilityIdentifier", []string{"USA_EIA_252"}, false},
+		{"get missing", "getUtilityIdentifier", []string{"missing"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := stub.MockInvoke("tx", toByteArgs(tt.function, tt.args...))
+			if gotErr := response.Status != shim.OK; gotErr != tt.wantErr {
+				t.Fatalf("status %d (%s), wantErr %v", response.Status, response.Message, tt.wantErr)
+			}
+		})
+	}
+
+	item := UtilityLookupItem{}
+	if err := json.Unmarshal(mustInvoke(t, stub, "getUtilityIdentifier", "USA_EIA_252"), &item); err != nil {
+		t.Fatal(err)
+	}
+	if item.Year != "2020" || item.StateProvince != "AK" || item.Class != utilityLookupItemClass {
+		t.Errorf("update was not stored: %+v", item)
+	}
+
+	results := []UtilityIdentifierResult{}
+	if err := json.Unmarshal(mustInvoke(t, stub, "getAllUtilityIdentifiers"), &results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Record == nil || results[0].Key != results[0].Record.UUID {
+		t.Fatalf("got utility identifiers %+v, want 2", results)
+	}
+}
+
+func TestGetEmissionsFactorForUtility(t *testing.T) {
+	stub := newTestStub(t)
+
+	mustInvoke(t, stub, "importUtilityIdentifier", `{"uuid":"STATE_UTILITY","state_province":"CA","divisions":{"division_type":"NERC_REGION","division_id":"WECC"}}`)
+	mustInvoke(t, stub, "importUtilityIdentifier", `{"uuid":"NERC_UTILITY","divisions":{"division_type":"NERC_REGION","division_id":"WECC"}}`)
+	mustInvoke(t, stub, "importUtilityIdentifier", `{"uuid":"EU_UTILITY","country":"Germany","divisions":{"division_type":"Country","division_id":"Germany"}}`)
+	mustInvoke(t, stub, "importUtilityIdentifier", `{"uuid":"US_UTILITY","divisions":{"division_type":"Country","division_id":"USA"}}`)
+
+	mustInvoke(t, stub, "importUtilityFactor", utilityFactorJSON("F_CA_2018", "2018", "STATE", "CA", 50, ""))
+	mustInvoke(t, stub, "importUtilityFactor", utilityFactorJSON("F_WECC_2019", "2019", "NERC_REGION", "WECC", 30, ""))
+	mustInvoke(t, stub, "importUtilityFactor", utilityFactorJSON("F_DE_2019", "2019", "COUNTRY", "Germany", 40, ""))
+	mustInvoke(t, stub, "importUtilityFactor", utilityFactorJSON("F_USA_2012", "2012", "COUNTRY", "USA", 60, ""))
+
+	tests := []struct {
+		name      string
+		utilityID string
+		year      int
+		factorID  string
+		wantErr   bool
+	}{
+		{"state factor", "STATE_UTILITY", 2018, "F_CA_2018", false},
+		{"state factor of an earlier year is not used", "STATE_UTILITY", 2019, "", true},
+		{"nerc region factor", "NERC_UTILITY", 2019, "F_WECC_2019", false},
+		{"nerc region factor not yet published", "NERC_UTILITY", 2018, "", true},
+		{"non US country factor", "EU_UTILITY", 2019, "F_DE_2019", false},
+		{"US factor", "US_UTILITY", 2012, "F_USA_2012", false},
+		{"US factor of an earlier year is not used", "US_UTILITY", 2017, "", true},
+		{"unknown utility", "MISSING", 2019, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			factor, err := getEmissionsFactorForUtility(stub, tt.utilityID, tt.year)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got factor %s", factor.UtilityID)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if factor.UtilityID != tt.factorID {
+				t.Errorf("got factor %s, want %s", factor.UtilityID, tt.factorID)
+			}
+		})
+	}
+}
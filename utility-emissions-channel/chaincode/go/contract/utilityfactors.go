@@ -0,0 +1,290 @@
+// Utility emissions factor registry in Golang
+
+package contract
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"emissions/events"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/* class identifier of the Node utility emissions factor item; the fields are camelCase, so Node does not read these factors */
+const utilityFactorClass = "org.hyperledger.blockchain-carbon-accounting.utilityemissionsfactoritem"
+
+/* composite key index of the factors; the division and year come first so lookups are range scans */
+const utilityFactorIndex = "divisionType~divisionId~year~utilityID"
+
+/* factor types; a factor without one is a grid average factor */
+const (
+	factorTypeGridAverage = "GRID_AVERAGE"
+	factorTypeResidualMix = "RESIDUAL_MIX"
+)
+
+// UtilityFactorResult is one entry of getUtilityFactorsByDivision, in the same shape as the Node chaincode returns
+type UtilityFactorResult struct {
+	Key    string                   `json:"Key"`
+	Record *UtilityEmissionsFactors `json:"Record"`
+}
+
+/* normalizeDivisionType maps the division type spellings used by eGRID and the Node chaincode to one form */
+func normalizeDivisionType(divisionType string) string {
+	switch strings.ToUpper(strings.TrimSpace(divisionType)) {
+	case "STATE":
+		return divisionTypeState
+	case "NERC", "NERC_REGION":
+		return divisionTypeNercRegion
+	case "COUNTRY":
+		return divisionTypeCountry
+	}
+	return strings.TrimSpace(divisionType)
+}
+
+/* Validate normalizes the factor and checks it before it is written to the ledger */
+func (f *UtilityEmissionsFactors) Validate() error {
+	f.DivisionType = normalizeDivisionType(f.DivisionType)
+	f.FactorType = strings.ToUpper(strings.TrimSpace(f.FactorType))
+	required := []struct{ name, value string }{
+		{"utilityID", f.UtilityID},
+		{"year", f.Year},
+		{"divisionType", f.DivisionType},
+		{"divisionId", f.DivisionId},
+		{"netGenerationUOM", f.NetGenerationUOM},
+		{"emissionsUOM", f.EmissionsUOM},
+	}
+	for _, field := range required {
+		if strings.TrimSpace(field.value) == "" {
+			return fmt.Errorf("emissions factor %s must be a non-empty string", field.name)
+		}
+	}
+	if strings.Contains(f.UtilityID, "\x00") || strings.Contains(f.DivisionId, "\x00") {
+		return fmt.Errorf("emissions factor keys must not contain U+0000")
+	}
+	if _, err := strconv.Atoi(f.Year); err != nil || len(f.Year) != 4 {
+		return fmt.Errorf("emissions factor year must be a 4 digit year, got %q", f.Year)
+	}
+	switch f.DivisionType {
+	case divisionTypeState, divisionTypeNercRegion, divisionTypeCountry:
+	default:
+		return fmt.Errorf("emissions factor divisionType must be STATE, NERC_REGION or COUNTRY, got %q", f.DivisionType)
+	}
+	if f.NetGeneration <= 0 {
+		return fmt.Errorf("emissions factor netGeneration must be positive")
+	}
+	if f.CO2EquivalentEmissions < 0 {
+		return fmt.Errorf("emissions factor CO2EquivalentEmissions must not be negative")
+	}
+	if f.NonRenewables < 0 || f.Renewables < 0 {
+		return fmt.Errorf("emissions factor nonRenewables and renewables must not be negative")
+	}
+	if f.PercentOfRenewables < 0 || f.PercentOfRenewables > 100 {
+		return fmt.Errorf("emissions factor percentOfRenewables must be between 0 and 100")
+	}
+	if err := checkGasEmissions("emissions factor gasEmissions", f.GasEmissions); err != nil {
+		return err
+	}
+	switch f.FactorType {
+	case "", factorTypeGridAverage, factorTypeResidualMix:
+	default:
+		return fmt.Errorf("emissions factor factorType must be GRID_AVERAGE or RESIDUAL_MIX, got %q", f.FactorType)
+	}
+	if unit, err := lookupUom(f.NetGenerationUOM); err != nil {
+		return err
+	} else if unit.dimension != uomDimensionEnergy {
+		return fmt.Errorf("emissions factor netGenerationUOM %s is not an energy unit", f.NetGenerationUOM)
+	}
+	if unit, err := lookupUom(f.EmissionsUOM); err != nil {
+		return err
+	} else if unit.dimension != uomDimensionMass {
+		return fmt.Errorf("emissions factor emissionsUOM %s is not a mass unit", f.EmissionsUOM)
+	}
+	return nil
+}
+
+/* factorType is the type of the factor, GRID_AVERAGE if it has none */
+func (f *UtilityEmissionsFactors) factorType() string {
+	if f.FactorType == "" {
+		return factorTypeGridAverage
+	}
+	return f.FactorType
+}
+
+/* utilityFactorIndexKey is the composite index entry of a factor */
+func utilityFactorIndexKey(APIstub shim.ChaincodeStubInterface, factor *UtilityEmissionsFactors) (string, error) {
+	return APIstub.CreateCompositeKey(utilityFactorIndex, []string{factor.DivisionType, factor.DivisionId, factor.Year, factor.UtilityID})
+}
+
+/* getUtilityFactorState reads a factor by its id; it returns nil if the factor does not exist, and an error if the key holds anything else */
+func getUtilityFactorState(APIstub shim.ChaincodeStubInterface, utilityID string) (*UtilityEmissionsFactors, error) {
+	factorAsBytes, err := APIstub.GetState(utilityID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get emissions factor %s: %s", utilityID, err.Error())
+	} else if factorAsBytes == nil {
+		return nil, nil
+	}
+	return decodeUtilityFactor(utilityID, factorAsBytes)
+}
+
+/* decodeUtilityFactor decodes the state of a key, which must be a factor */
+func decodeUtilityFactor(utilityID string, factorAsBytes []byte) (*UtilityEmissionsFactors, error) {
+	factor := &UtilityEmissionsFactors{}
+	if err := json.Unmarshal(factorAsBytes, factor); err != nil {
+		return nil, fmt.Errorf("Failed to decode emissions factor %s: %s", utilityID, err.Error())
+	} else if factor.Class != utilityFactorClass {
+		return nil, fmt.Errorf("%s is not a utility emissions factor", utilityID)
+	}
+	return factor, nil
+}
+
+/* putUtilityFactor writes the factor under its id and maintains the division index; previous is the stored version, if any */
+func putUtilityFactor(APIstub shim.ChaincodeStubInterface, factor *UtilityEmissionsFactors, previous *UtilityEmissionsFactors) ([]byte, error) {
+	factor.Class = utilityFactorClass
+	factorAsBytes, err := json.Marshal(factor)
+	if err != nil {
+		return nil, err
+	}
+	if err := APIstub.PutState(factor.UtilityID, factorAsBytes); err != nil {
+		return nil, err
+	}
+
+	indexKey, err := utilityFactorIndexKey(APIstub, factor)
+	if err != nil {
+		return nil, err
+	}
+	if previous != nil {
+		previousIndexKey, err := utilityFactorIndexKey(APIstub, previous)
+		if err != nil {
+			return nil, err
+		}
+		if previousIndexKey != indexKey {
+			if err := APIstub.DelState(previousIndexKey); err != nil {
+				return nil, err
+			}
+		}
+	}
+	//  Only the key name is needed, passing a 'nil' value would delete the key, therefore we pass null character as value
+	if err := APIstub.PutState(indexKey, []byte{0x00}); err != nil {
+		return nil, err
+	}
+	return factorAsBytes, nil
+}
+
+/* Import a new utility emissions factor */
+
+func (s *EmissionsContract) ImportUtilityFactor(ctx contractapi.TransactionContextInterface, factor UtilityEmissionsFactors) (*UtilityEmissionsFactors, error) {
+	APIstub := ctx.GetStub()
+	if err := factor.Validate(); err != nil {
+		return nil, err
+	}
+
+	existing, err := getUtilityFactorState(APIstub, factor.UtilityID)
+	if err != nil {
+		return nil, err
+	} else if existing != nil {
+		return nil, fmt.Errorf("This emissions factor already exists: %s", factor.UtilityID)
+	}
+
+	if _, err := putUtilityFactor(APIstub, &factor, nil); err != nil {
+		return nil, err
+	}
+	err = setFactorImported(APIstub, []events.FactorChange{{Key: factor.UtilityID, Status: batchRowCreated}})
+	if err != nil {
+		return nil, err
+	}
+	return &factor, nil
+}
+
+/* Update an existing utility emissions factor, re-indexing it if its division or year changed */
+
+func (s *EmissionsContract) UpdateUtilityFactor(ctx contractapi.TransactionContextInterface, factor UtilityEmissionsFactors) (*UtilityEmissionsFactors, error) {
+	APIstub := ctx.GetStub()
+	if err := factor.Validate(); err != nil {
+		return nil, err
+	}
+
+	existing, err := getUtilityFactorState(APIstub, factor.UtilityID)
+	if err != nil {
+		return nil, err
+	} else if existing == nil {
+		return nil, fmt.Errorf("Emissions factor does not exist: %s", factor.UtilityID)
+	}
+
+	if _, err := putUtilityFactor(APIstub, &factor, existing); err != nil {
+		return nil, err
+	}
+	err = setFactorImported(APIstub, []events.FactorChange{{Key: factor.UtilityID, Status: batchRowUpdated}})
+	if err != nil {
+		return nil, err
+	}
+	return &factor, nil
+}
+
+/* Query a utility emissions factor by its id */
+
+func (s *EmissionsContract) GetUtilityFactor(ctx contractapi.TransactionContextInterface, utilityID string) (*UtilityEmissionsFactors, error) {
+	factor, err := getUtilityFactorState(ctx.GetStub(), utilityID)
+	if err != nil {
+		return nil, err
+	} else if factor == nil {
+		return nil, fmt.Errorf("Emissions factor does not exist: %s", utilityID)
+	}
+	return factor, nil
+}
+
+/* Query the utility emissions factors of a division, only those of one year unless year is 0 */
+
+func (s *EmissionsContract) GetUtilityFactorsByDivision(ctx contractapi.TransactionContextInterface, divisionType string, divisionId string, year int) ([]UtilityFactorResult, error) {
+	yearAttribute := ""
+	if year != 0 {
+		yearAttribute = strconv.Itoa(year)
+	}
+	factors, err := queryUtilityFactorsByDivision(ctx.GetStub(), divisionType, divisionId, yearAttribute)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []UtilityFactorResult{}
+	for i := range factors {
+		results = append(results, UtilityFactorResult{Key: factors[i].UtilityID, Record: &factors[i]})
+	}
+	return results, nil
+}
+
+/* queryUtilityFactorsByDivision range scans the division index; an empty year returns the factors of every year */
+func queryUtilityFactorsByDivision(APIstub shim.ChaincodeStubInterface, divisionType string, divisionId string, year string) ([]UtilityEmissionsFactors, error) {
+	attributes := []string{normalizeDivisionType(divisionType), divisionId}
+	if year != "" {
+		attributes = append(attributes, year)
+	}
+
+	resultsIterator, err := APIstub.GetStateByPartialCompositeKey(utilityFactorIndex, attributes)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	factors := []UtilityEmissionsFactors{}
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, compositeKeyParts, err := APIstub.SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return nil, err
+		}
+		utilityID := compositeKeyParts[3]
+		factor, err := getUtilityFactorState(APIstub, utilityID)
+		if err != nil {
+			return nil, err
+		} else if factor == nil {
+			return nil, fmt.Errorf("Emissions factor %s is indexed but does not exist", utilityID)
+		}
+		factors = append(factors, *factor)
+	}
+	return factors, nil
+}
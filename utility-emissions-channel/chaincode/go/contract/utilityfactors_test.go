@@ -0,0 +1,115 @@
+package contract
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+func TestUtilityFactors(t *testing.T) {
+	stub := newTestStub(t)
+	mustInvoke(t, stub, "importUtilityFactor", `{"utilityID":"USA_2018_STATE_CA","year":"2018","country":"USA","divisionType":"State","divisionId":"CA","divisionName":"California","netGeneration":195212860,"netGenerationUOM":"MWH","CO2EquivalentEmissions":49628215,"emissionsUOM":"short tons"}`)
+	mustInvoke(t, stub, "importUtilityFactor", `{"utilityID":"USA_2019_STATE_CA","year":"2019","country":"USA","divisionType":"STATE","divisionId":"CA","divisionName":"California","netGeneration":200000000,"netGenerationUOM":"MWH","CO2EquivalentEmissions":48000000,"emissionsUOM":"short tons","factorType":"residual_mix"}`)
+	mustInvoke(t, stub, "importUtilityFactor", `{"utilityID":"USA_2019_NERC_WECC","year":"2019","country":"USA","divisionType":"NERC","divisionId":"WECC","divisionName":"WECC","netGeneration":700000000,"netGenerationUOM":"MWH","CO2EquivalentEmissions":280000000,"emissionsUOM":"short tons"}`)
+
+	factor := func(utilityID string) UtilityEmissionsFactors {
+		factor := UtilityEmissionsFactors{}
+		if err := json.Unmarshal(mustInvoke(t, stub, "getUtilityFactor", utilityID), &factor); err != nil {
+			t.Fatal(err)
+		}
+		return factor
+	}
+	byDivision := func(args ...string) string {
+		results := []UtilityFactorResult{}
+		if err := json.Unmarshal(mustInvoke(t, stub, "getUtilityFactorsByDivision", args...), &results); err != nil {
+			t.Fatal(err)
+		}
+		keys := []string{}
+		for _, result := range results {
+			keys = append(keys, result.Key)
+		}
+		return strings.Join(keys, ",")
+	}
+
+	// factors are stored normalized and with their class
+	if got := factor("USA_2018_STATE_CA"); got.Class != utilityFactorClass || got.DivisionType != divisionTypeState || got.CO2EquivalentEmissions != 49628215 || got.factorType() != factorTypeGridAverage {
+		t.Errorf("got factor %+v", got)
+	}
+	if got := factor("USA_2019_NERC_WECC"); got.DivisionType != divisionTypeNercRegion {
+		t.Errorf("got factor %+v", got)
+	}
+	if got := factor("USA_2019_STATE_CA"); got.FactorType != factorTypeResidualMix {
+		t.Errorf("got factor %+v", got)
+	}
+
+	// the division query returns every year in order, or one year
+	if got := byDivision("STATE", "CA", "0"); got != "USA_2018_STATE_CA,USA_2019_STATE_CA" {
+		t.Errorf("factors of STATE CA are %s", got)
+	}
+	if got := byDivision("state", "CA", "2019"); got != "USA_2019_STATE_CA" {
+		t.Errorf("factors of STATE CA in 2019 are %s", got)
+	}
+	if got := byDivision("NERC_REGION", "WECC", "0"); got != "USA_2019_NERC_WECC" {
+		t.Errorf("factors of NERC_REGION WECC are %s", got)
+	}
+	if got := byDivision("STATE", "NY", "0"); got != "" {
+		t.Errorf("factors of STATE NY are %s", got)
+	}
+
+	// updating the year or division of a factor moves it in the index
+	mustInvoke(t, stub, "updateUtilityFactor", `{"utilityID":"USA_2018_STATE_CA","year":"2017","country":"USA","divisionType":"STATE","divisionId":"NV","divisionName":"Nevada","netGeneration":40000000,"netGenerationUOM":"MWH","CO2EquivalentEmissions":16000000,"emissionsUOM":"short tons"}`)
+	if got := factor("USA_2018_STATE_CA"); got.Year != "2017" || got.DivisionId != "NV" || got.NetGeneration != 40000000 {
+		t.Errorf("got updated factor %+v", got)
+	}
+	if got := byDivision("STATE", "CA", "0"); got != "USA_2019_STATE_CA" {
+		t.Errorf("factors of STATE CA after the update are %s", got)
+	}
+	if got := byDivision("STATE", "NV", "2017"); got != "USA_2018_STATE_CA" {
+		t.Errorf("factors of STATE NV after the update are %s", got)
+	}
+
+	// keys holding other documents are neither read nor written as factors
+	mustInvoke(t, stub, "importUtilityIdentifier", `{"uuid":"USA_EIA_11208","year":"2019","utility_number":"11208","utility_name":"Los Angeles Department of Water & Power","country":"USA","state_province":"CA"}`)
+	mustInvoke(t, stub, "createEmissionRecord", calcInputJSON("Utility1", "MyCompany", "2020-01-01", "2020-01-31", 1650, "KWH"), "0.6328", "TONS", "430", "1220", "", "", "")
+	recordKey := emissionsRecordID("Utility1", "MyCompany", "2020-01-01", "2020-01-31")
+
+	factorArgs := func(utilityID string) []string {
+		return []string{`{"utilityID":"` + utilityID + `","year":"2019","country":"USA","divisionType":"STATE","divisionId":"CA","divisionName":"California","netGeneration":200000000,"netGenerationUOM":"MWH","CO2EquivalentEmissions":48000000,"emissionsUOM":"short tons"}`}
+	}
+	tests := []struct {
+		name     string
+		function string
+		args     []string
+		wantErr  string
+	}{
+		{"factors are imported once", "importUtilityFactor", factorArgs("USA_2019_STATE_CA"), "already exists: USA_2019_STATE_CA"},
+		{"only existing factors are updated", "updateUtilityFactor", factorArgs("USA_2020_STATE_CA"), "does not exist: USA_2020_STATE_CA"},
+		{"unknown factor", "getUtilityFactor", []string{"USA_2020_STATE_CA"}, "does not exist: USA_2020_STATE_CA"},
+		{"division types are checked", "importUtilityFactor", []string{`{"utilityID":"USA_2019_CITY_LA","year":"2019","country":"USA","divisionType":"CITY","divisionId":"LA","divisionName":"Los Angeles","netGeneration":1,"netGenerationUOM":"MWH","CO2EquivalentEmissions":1,"emissionsUOM":"TONS"}`}, "must be STATE, NERC_REGION or COUNTRY"},
+		{"years are checked", "importUtilityFactor", []string{`{"utilityID":"USA_19_STATE_CA","year":"19","country":"USA","divisionType":"STATE","divisionId":"CA","divisionName":"California","netGeneration":1,"netGenerationUOM":"MWH","CO2EquivalentEmissions":1,"emissionsUOM":"TONS"}`}, "must be a 4 digit year"},
+		{"import over an identifier", "importUtilityFactor", factorArgs("USA_EIA_11208"), "USA_EIA_11208 is not a utility emissions factor"},
+		{"update over an identifier", "updateUtilityFactor", factorArgs("USA_EIA_11208"), "USA_EIA_11208 is not a utility emissions factor"},
+		{"update over a record", "updateUtilityFactor", factorArgs(recordKey), recordKey + " is not a utility emissions factor"},
+		{"get of a record", "getUtilityFactor", []string{recordKey}, recordKey + " is not a utility emissions factor"},
+		{"identifier update over a factor", "updateUtilityIdentifier", []string{`{"uuid":"USA_2019_STATE_CA","year":"2019","utility_number":"1","utility_name":"Utility","country":"USA","state_province":"CA"}`}, "USA_2019_STATE_CA is not a utility identifier"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := stub.MockInvoke("tx", toByteArgs(tt.function, tt.args...))
+			if response.Status == shim.OK || !strings.Contains(response.Message, tt.wantErr) {
+				t.Errorf("%s returned %d %q, want an error containing %q", tt.function, response.Status, response.Message, tt.wantErr)
+			}
+		})
+	}
+
+	item := UtilityLookupItem{}
+	if err := json.Unmarshal(mustInvoke(t, stub, "getUtilityIdentifier", "USA_EIA_11208"), &item); err != nil || item.Class != utilityLookupItemClass {
+		t.Errorf("got identifier %+v, %v", item, err)
+	}
+	record := EmissionsRecord{}
+	if err := json.Unmarshal(mustInvoke(t, stub, "getEmissionRecord", recordKey), &record); err != nil || record.EmissionsAmount != 0.6328 {
+		t.Errorf("got record %+v, %v", record, err)
+	}
+}
@@ -0,0 +1,103 @@
+// Batch import of utility emissions factors in Golang
+
+package contract
+
+import (
+	"fmt"
+
+	"emissions/events"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/* statuses of a row in a batch import report */
+const (
+	batchRowCreated = "created"
+	batchRowUpdated = "updated"
+	batchRowInvalid = "invalid"
+)
+
+// BatchRowResult reports what happened to one row of a batch; Index is its position in the submitted array
+type BatchRowResult struct {
+	Index  int    `json:"index"`
+	Key    string `json:"key"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty" metadata:",optional"`
+}
+
+// BatchReport is the response of importUtilityFactorsBatch
+type BatchReport struct {
+	Written int              `json:"written"`
+	Failed  int              `json:"failed"`
+	Rows    []BatchRowResult `json:"rows"`
+}
+
+/* Import an array of utility emissions factors in one transaction; a row that does not match the factor schema rejects the whole batch.
+   Valid rows are created or updated, invalid rows are skipped and reported with their index so they can be fixed and resubmitted. */
+
+func (s *EmissionsContract) ImportUtilityFactorsBatch(ctx contractapi.TransactionContextInterface, factors []UtilityEmissionsFactors) (*BatchReport, error) {
+	APIstub := ctx.GetStub()
+	report := &BatchReport{Rows: []BatchRowResult{}}
+	seen := map[string]int{}
+	for i, factor := range factors {
+		result, err := importBatchRow(APIstub, i, factor, seen)
+		if err != nil {
+			// a failed write aborts the whole transaction, so the valid rows are written all or nothing
+			return nil, err
+		}
+		if result.Status == batchRowInvalid {
+			report.Failed++
+		} else {
+			report.Written++
+		}
+		report.Rows = append(report.Rows, result)
+	}
+
+	changes := []events.FactorChange{}
+	for _, row := range report.Rows {
+		if row.Status != batchRowInvalid {
+			changes = append(changes, events.FactorChange{Key: row.Key, Status: row.Status})
+		}
+	}
+	if err := setFactorImported(APIstub, changes); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+/* importBatchRow validates and writes one row; the error is only set when the ledger cannot be read or written */
+func importBatchRow(APIstub shim.ChaincodeStubInterface, index int, factor UtilityEmissionsFactors, seen map[string]int) (BatchRowResult, error) {
+	result := BatchRowResult{Index: index, Status: batchRowInvalid}
+	result.Key = factor.UtilityID
+	if err := factor.Validate(); err != nil {
+		result.Error = err.Error()
+		return result, nil
+	}
+	// writes are only visible after commit, so a second write of a key in the same transaction would be indexed against stale state
+	if first, ok := seen[factor.UtilityID]; ok {
+		result.Error = fmt.Sprintf("duplicate of row %d", first)
+		return result, nil
+	}
+	seen[factor.UtilityID] = index
+
+	existingAsBytes, err := APIstub.GetState(factor.UtilityID)
+	if err != nil {
+		return result, fmt.Errorf("Failed to get emissions factor %s: %s", factor.UtilityID, err.Error())
+	}
+	var existing *UtilityEmissionsFactors
+	if existingAsBytes != nil {
+		// a key holding a record, an identifier or any other document is not overwritten
+		if existing, err = decodeUtilityFactor(factor.UtilityID, existingAsBytes); err != nil {
+			result.Error = err.Error()
+			return result, nil
+		}
+	}
+	if _, err := putUtilityFactor(APIstub, &factor, existing); err != nil {
+		return result, fmt.Errorf("Failed to write row %d %s: %s", index, factor.UtilityID, err.Error())
+	}
+	result.Status = batchRowCreated
+	if existing != nil {
+		result.Status = batchRowUpdated
+	}
+	return result, nil
+}
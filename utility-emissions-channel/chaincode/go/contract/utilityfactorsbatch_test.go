@@ -0,0 +1,81 @@
+package contract
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+func TestImportUtilityFactorsBatch(t *testing.T) {
+	stub := newTestStub(t)
+	mustInvoke(t, stub, "importUtilityFactor", `{"utilityID":"USA_2018_STATE_CA","year":"2018","country":"USA","divisionType":"STATE","divisionId":"CA","divisionName":"California","netGeneration":195212860,"netGenerationUOM":"MWH","CO2EquivalentEmissions":49628215,"emissionsUOM":"short tons"}`)
+	mustInvoke(t, stub, "importUtilityIdentifier", `{"uuid":"USA_EIA_11208","year":"2019","utility_number":"11208","utility_name":"Los Angeles Department of Water & Power","country":"USA","state_province":"CA"}`)
+	mustInvoke(t, stub, "createEmissionRecord", calcInputJSON("Utility1", "MyCompany", "2020-01-01", "2020-01-31", 1650, "KWH"), "0.6328", "TONS", "430", "1220", "", "", "")
+	recordKey := emissionsRecordID("Utility1", "MyCompany", "2020-01-01", "2020-01-31")
+	mustInvoke(t, stub, "tokenizeEmissionsRecords", "12", testIssuer, `["`+recordKey+`"]`)
+
+	row := func(utilityID string, divisionId string, emissions float64) string {
+		return fmt.Sprintf(`{"utilityID": %q, "year": "2018", "country": "USA", "divisionType": "STATE", "divisionId": %q, "netGeneration": 100, "netGenerationUOM": "MWH", "CO2EquivalentEmissions": %v, "emissionsUOM": "TONS"}`,
+			utilityID, divisionId, emissions)
+	}
+	batch := "[" + strings.Join([]string{
+		row("USA_2018_STATE_CA", "CA", 25),
+		row("USA_2018_STATE_NY", "NY", 20),
+		row("USA_2018_STATE_NV", "NV", -1),
+		row("USA_2018_STATE_NY", "NY", 21),
+		row(recordKey, "TX", 40),
+		row("USA_EIA_11208", "CA", 50),
+	}, ",") + "]"
+
+	report := BatchReport{}
+	if err := json.Unmarshal(mustInvoke(t, stub, "importUtilityFactorsBatch", batch), &report); err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		key     string
+		status  string
+		wantErr string
+	}{
+		{"USA_2018_STATE_CA", batchRowUpdated, ""},
+		{"USA_2018_STATE_NY", batchRowCreated, ""},
+		{"USA_2018_STATE_NV", batchRowInvalid, "CO2EquivalentEmissions must not be negative"},
+		{"USA_2018_STATE_NY", batchRowInvalid, "duplicate of row 1"},
+		{recordKey, batchRowInvalid, recordKey + " is not a utility emissions factor"},
+		{"USA_EIA_11208", batchRowInvalid, "USA_EIA_11208 is not a utility emissions factor"},
+	}
+	if report.Written != 2 || report.Failed != 4 || len(report.Rows) != len(want) {
+		t.Fatalf("got report %+v", report)
+	}
+	for i, w := range want {
+		got := report.Rows[i]
+		if got.Index != i || got.Key != w.key || got.Status != w.status || !strings.Contains(got.Error, w.wantErr) || (w.wantErr == "") != (got.Error == "") {
+			t.Errorf("row %d = %+v, want %+v", i, got, w)
+		}
+	}
+
+	// a row that does not match the factor schema fails the whole batch
+	response := stub.MockInvoke("tx", toByteArgs("importUtilityFactorsBatch", "["+row("USA_2018_STATE_TX", "TX", 30)+`,{"utilityID": 2018}]`))
+	if response.Status == shim.OK {
+		t.Errorf("a batch with a malformed row returned %s", response.Payload)
+	}
+
+	// the valid rows are written, and the documents under the rejected keys are untouched
+	factor := UtilityEmissionsFactors{}
+	if err := json.Unmarshal(mustInvoke(t, stub, "getUtilityFactor", "USA_2018_STATE_CA"), &factor); err != nil || factor.CO2EquivalentEmissions != 25 {
+		t.Errorf("got factor %+v, %v", factor, err)
+	}
+	if err := json.Unmarshal(mustInvoke(t, stub, "getUtilityFactor", "USA_2018_STATE_NY"), &factor); err != nil || factor.CO2EquivalentEmissions != 20 {
+		t.Errorf("got factor %+v, %v", factor, err)
+	}
+	record := EmissionsRecord{}
+	if err := json.Unmarshal(mustInvoke(t, stub, "getEmissionRecord", recordKey), &record); err != nil || record.TokenID != "12" || record.EmissionsAmount != 0.6328 {
+		t.Errorf("got record %+v, %v", record, err)
+	}
+	item := UtilityLookupItem{}
+	if err := json.Unmarshal(mustInvoke(t, stub, "getUtilityIdentifier", "USA_EIA_11208"), &item); err != nil || item.UtilityName != "Los Angeles Department of Water & Power" {
+		t.Errorf("got identifier %+v, %v", item, err)
+	}
+}
@@ -0,0 +1,296 @@
+// Invoke payloads and the in-memory ledger for the eGRID loader in Golang
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"chaincode-common/mockidentity"
+	"emissions/contract"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// invokePayload is one chaincode invocation, in the shape taken by peer chaincode invoke -c
+type invokePayload struct {
+	Function string   `json:"function"`
+	Args     []string `json:"Args"`
+}
+
+// record is a factor or utility identifier as its fields, compared with the ledger, and the JSON its import function takes
+type record struct {
+	key        string
+	kind       string
+	fields     []string
+	arg        string
+	importFunc string
+	updateFunc string
+	getFunc    string
+	// the factor or utility identifier itself
+	value interface{}
+}
+
+/* field names, in the order of the fields of a record */
+var (
+	factorFieldNames     = []string{"utilityID", "utilityName", "year", "country", "divisionType", "divisionId", "divisionName", "netGeneration", "netGenerationUOM", "CO2EquivalentEmissions", "emissionsUOM", "nonRenewables", "renewables", "percentOfRenewables", "factorType", "gasEmissions"}
+	identifierFieldNames = []string{"uuid", "year", "utility_number", "utility_name", "country", "state_province", "divisions"}
+)
+
+func formatAmount(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func factorRecord(f contract.UtilityEmissionsFactors) record {
+	gasEmissions := ""
+	if len(f.GasEmissions) > 0 {
+		gasEmissionsAsBytes, _ := json.Marshal(f.GasEmissions)
+		gasEmissions = string(gasEmissionsAsBytes)
+	}
+	factorAsBytes, _ := json.Marshal(f)
+	return record{
+		key:  f.UtilityID,
+		kind: "factor",
+		fields: []string{f.UtilityID, f.UtilityName, f.Year, f.Country, f.DivisionType, f.DivisionId, f.DivisionName,
+			formatAmount(f.NetGeneration), f.NetGenerationUOM, formatAmount(f.CO2EquivalentEmissions), f.EmissionsUOM,
+			formatAmount(f.NonRenewables), formatAmount(f.Renewables), formatAmount(f.PercentOfRenewables), f.FactorType, gasEmissions},
+		arg:        string(factorAsBytes),
+		importFunc: "importUtilityFactor",
+		updateFunc: "updateUtilityFactor",
+		getFunc:    "getUtilityFactor",
+		value:      f,
+	}
+}
+
+func identifierRecord(item contract.UtilityLookupItem) record {
+	// divisions marshal to the JSON string the Node chaincode parses, so the field is that string unquoted
+	divisions := ""
+	divisionsAsBytes, _ := json.Marshal(item.Divisions)
+	json.Unmarshal(divisionsAsBytes, &divisions)
+	itemAsBytes, _ := json.Marshal(item)
+	return record{
+		key:        item.UUID,
+		kind:       "utility",
+		fields:     []string{item.UUID, item.Year, item.UtilityNumber, item.UtilityName, item.Country, item.StateProvince, divisions},
+		arg:        string(itemAsBytes),
+		importFunc: "importUtilityIdentifier",
+		updateFunc: "updateUtilityIdentifier",
+		getFunc:    "getUtilityIdentifier",
+		value:      item,
+	}
+}
+
+/* recordFromState turns a ledger value back into a record, telling factors and utility identifiers apart by their fields */
+func recordFromState(value []byte) (record, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(value, &fields); err != nil {
+		return record{}, err
+	}
+	if _, ok := fields["divisionType"]; ok {
+		var factor contract.UtilityEmissionsFactors
+		if err := json.Unmarshal(value, &factor); err != nil {
+			return record{}, err
+		}
+		return factorRecord(factor), nil
+	}
+	if _, ok := fields["utility_number"]; ok {
+		var item contract.UtilityLookupItem
+		if err := json.Unmarshal(value, &item); err != nil {
+			return record{}, err
+		}
+		return identifierRecord(item), nil
+	}
+	return record{}, fmt.Errorf("not an emissions factor or utility identifier")
+}
+
+// ledger is the emissions chaincode running on a shim.MockStub, invoked as a factor admin
+type ledger struct {
+	stub *mockidentity.Stub
+	txID int
+}
+
+func newLedger() (*ledger, error) {
+	chaincode, err := contract.NewChaincode()
+	if err != nil {
+		return nil, err
+	}
+	stub, err := mockidentity.NewStub("emissions", chaincode, "LoaderMSP", map[string]string{"role": "factor_admin"})
+	if err != nil {
+		return nil, err
+	}
+	return &ledger{stub: stub}, nil
+}
+
+func (l *ledger) invoke(function string, args []string) ([]byte, error) {
+	l.txID++
+	invokeArgs := [][]byte{[]byte(function)}
+	for _, arg := range args {
+		invokeArgs = append(invokeArgs, []byte(arg))
+	}
+	response := l.stub.MockInvoke("loader-tx-"+strconv.Itoa(l.txID), invokeArgs)
+	if response.Status != shim.OK {
+		return nil, fmt.Errorf("%s: %s", function, response.Message)
+	}
+	return response.Payload, nil
+}
+
+/* get returns the on-ledger fields of a record, or nil if it is not on the ledger */
+func (l *ledger) get(r record) ([]string, error) {
+	value, err := l.invoke(r.getFunc, []string{r.key})
+	if err != nil || len(value) == 0 {
+		// the get functions fail on missing keys, so treat any error as not found
+		return nil, nil
+	}
+	existing, err := recordFromState(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %s", r.kind, r.key, err.Error())
+	}
+	return existing.fields, nil
+}
+
+/* put imports a new record or updates an existing one */
+func (l *ledger) put(r record, exists bool) error {
+	function := r.importFunc
+	if exists {
+		function = r.updateFunc
+	}
+	_, err := l.invoke(function, []string{r.arg})
+	return err
+}
+
+// snapshotEntry is one ledger entry, in the Key/Record shape returned by the query functions
+type snapshotEntry struct {
+	Key    string          `json:"Key"`
+	Record json.RawMessage `json:"Record"`
+}
+
+/* loadSnapshot imports the factors and utility identifiers of a snapshot file through the chaincode, so indexes are rebuilt */
+func (l *ledger) loadSnapshot(fileName string) error {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	var entries []snapshotEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("%s is not a JSON array of {Key, Record}: %s", fileName, err.Error())
+	}
+	for _, entry := range entries {
+		r, err := recordFromState(entry.Record)
+		if err != nil {
+			return fmt.Errorf("%s: %s", entry.Key, err.Error())
+		}
+		if err := l.put(r, false); err != nil {
+			return fmt.Errorf("%s: %s", entry.Key, err.Error())
+		}
+	}
+	return nil
+}
+
+/* saveSnapshot writes every ledger entry except composite key index entries, sorted by key */
+func (l *ledger) saveSnapshot(fileName string) error {
+	keys := []string{}
+	for key := range l.stub.State {
+		if !strings.HasPrefix(key, "\x00") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	entries := []snapshotEntry{}
+	for _, key := range keys {
+		entries = append(entries, snapshotEntry{Key: key, Record: json.RawMessage(l.stub.State[key])})
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fileName, data, 0644)
+}
+
+// change is a record that differs from the ledger; previous is nil for a new record
+type change struct {
+	record   record
+	previous []string
+}
+
+/* diff compares records to the ledger, returning the changes and the number of unchanged records */
+func (l *ledger) diff(records []record) ([]change, int, error) {
+	changes := []change{}
+	unchanged := 0
+	for _, r := range records {
+		previous, err := l.get(r)
+		if err != nil {
+			return nil, 0, err
+		}
+		if previous != nil && strings.Join(previous, "\x00") == strings.Join(r.fields, "\x00") {
+			unchanged++
+			continue
+		}
+		changes = append(changes, change{record: r, previous: previous})
+	}
+	return changes, unchanged, nil
+}
+
+/* describe prints a change as "+ key" for new records, or "~ key" followed by the changed fields */
+func (c change) describe() string {
+	if c.previous == nil {
+		return "+ " + c.record.kind + " " + c.record.key
+	}
+	names := factorFieldNames
+	if c.record.kind == "utility" {
+		names = identifierFieldNames
+	}
+	lines := []string{"~ " + c.record.kind + " " + c.record.key}
+	for i, field := range c.record.fields {
+		if i < len(c.previous) && c.previous[i] != field {
+			lines = append(lines, fmt.Sprintf("    %s: %q -> %q", names[i], c.previous[i], field))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+/* payload is the invocation that applies the change to the ledger */
+func (c change) payload() invokePayload {
+	function := c.record.importFunc
+	if c.previous != nil {
+		function = c.record.updateFunc
+	}
+	return invokePayload{Function: function, Args: []string{c.record.arg}}
+}
+
+/* batchPayloads groups the factor changes into importUtilityFactorsBatch invocations of at most size rows; other changes are invoked one by one */
+func batchPayloads(changes []change, size int) ([]invokePayload, error) {
+	payloads := []invokePayload{}
+	factors := []interface{}{}
+	flush := func() error {
+		if len(factors) == 0 {
+			return nil
+		}
+		factorsAsBytes, err := json.Marshal(factors)
+		if err != nil {
+			return err
+		}
+		payloads = append(payloads, invokePayload{Function: "importUtilityFactorsBatch", Args: []string{string(factorsAsBytes)}})
+		factors = []interface{}{}
+		return nil
+	}
+	for _, c := range changes {
+		if c.record.kind != "factor" {
+			payloads = append(payloads, c.payload())
+			continue
+		}
+		factors = append(factors, c.record.value)
+		if len(factors) == size {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return payloads, nil
+}
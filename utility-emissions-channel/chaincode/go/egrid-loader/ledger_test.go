@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"emissions/contract"
+)
+
+/* stateRecords maps the ST19 fixture sheet to records, as loadRecords does */
+func stateRecords(t *testing.T) []record {
+	records, err := loadRecords("testdata/egrid2019.xlsx", "ST19", kindState)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestFactorRecordFields(t *testing.T) {
+	records := stateRecords(t)
+	if len(records) != 2 {
+		t.Fatalf("got records %+v", records)
+	}
+	want := []string{"USA_2019_STATE_CA", "", "2019", "USA", "STATE", "CA", "California", "200000000", "MWH", "50000000", "short tons",
+		"120000000", "80000000", "0", "", `{"CH4":2000,"CO2":49000000,"N2O":300}`}
+	if got := records[0].fields; strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("got fields\n%q, want\n%q", got, want)
+	}
+	if len(records[0].fields) != len(factorFieldNames) || records[0].key != "USA_2019_STATE_CA" || records[0].importFunc != "importUtilityFactor" {
+		t.Errorf("got record %+v", records[0])
+	}
+	factor := contract.UtilityEmissionsFactors{}
+	if err := json.Unmarshal([]byte(records[0].arg), &factor); err != nil || factor.UtilityID != "USA_2019_STATE_CA" || factor.GasEmissions["CH4"] != 2000 {
+		t.Errorf("got arg %s, %v", records[0].arg, err)
+	}
+	if got := records[1].fields[15]; got != "" {
+		t.Errorf("a factor without gases has gasEmissions %q", got)
+	}
+
+	items, _ := utilityIdentifiersFromEIA(mustReadRows(t, "eia861.csv", "", 2))
+	r := identifierRecord(items[0])
+	want = []string{"USA_EIA_11208", "2019", "11208", "Los Angeles Department of Water & Power", "USA", "CA", `{"division_type":"NERC_REGION","division_id":"WECC"}`}
+	if strings.Join(r.fields, "|") != strings.Join(want, "|") || len(r.fields) != len(identifierFieldNames) {
+		t.Errorf("got fields\n%q, want\n%q", r.fields, want)
+	}
+	if r := identifierRecord(items[1]); r.fields[6] != "" {
+		t.Errorf("an identifier without a division has divisions %q", r.fields[6])
+	}
+}
+
+func TestLedgerDiff(t *testing.T) {
+	l, err := newLedger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := stateRecords(t)
+
+	// the records are accepted by the import functions and read back unchanged
+	changes, unchanged, err := l.diff(records)
+	if err != nil || len(changes) != 2 || unchanged != 0 || changes[0].previous != nil {
+		t.Fatalf("got %d changes, %d unchanged, %v", len(changes), unchanged, err)
+	}
+	if got := changes[0].describe(); got != "+ factor USA_2019_STATE_CA" {
+		t.Errorf("got %q", got)
+	}
+	for _, c := range changes {
+		if err := l.put(c.record, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if changes, unchanged, err = l.diff(records); err != nil || len(changes) != 0 || unchanged != 2 {
+		t.Fatalf("after the import got %d changes, %d unchanged, %v", len(changes), unchanged, err)
+	}
+
+	// a changed amount is an update of that field
+	factor := records[1].value.(contract.UtilityEmissionsFactors)
+	factor.CO2EquivalentEmissions = 27000000
+	records[1] = factorRecord(factor)
+	changes, unchanged, err = l.diff(records)
+	if err != nil || len(changes) != 1 || unchanged != 1 {
+		t.Fatalf("got %d changes, %d unchanged, %v", len(changes), unchanged, err)
+	}
+	if got := changes[0].describe(); got != "~ factor USA_2019_STATE_NY\n    CO2EquivalentEmissions: \"26000000\" -> \"27000000\"" {
+		t.Errorf("got %q", got)
+	}
+	if payload := changes[0].payload(); payload.Function != "updateUtilityFactor" || len(payload.Args) != 1 || !strings.Contains(payload.Args[0], `"CO2EquivalentEmissions":27000000`) {
+		t.Errorf("got payload %+v", payload)
+	}
+
+	// a snapshot restores the same ledger
+	dir, err := ioutil.TempDir("", "egrid-loader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "snapshot.json")
+	if err := l.saveSnapshot(fileName); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := newLedger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := restored.loadSnapshot(fileName); err != nil {
+		t.Fatal(err)
+	}
+	if changes, unchanged, err = restored.diff(stateRecords(t)); err != nil || len(changes) != 0 || unchanged != 2 {
+		t.Errorf("against the snapshot got %d changes, %d unchanged, %v", len(changes), unchanged, err)
+	}
+}
+
+func TestBatchPayloads(t *testing.T) {
+	factors, _ := factorsFromEgrid(kindState, mustReadRows(t, "egrid2019.xlsx", "ST19", 1))
+	regions, _ := factorsFromEgrid(kindNercRegion, mustReadRows(t, "egrid2019.xlsx", "NRL19", 1))
+	items, _ := utilityIdentifiersFromEIA(mustReadRows(t, "eia861.csv", "", 2))
+	changes := []change{
+		{record: factorRecord(factors[0])},
+		{record: identifierRecord(items[0]), previous: []string{}},
+		{record: factorRecord(factors[1])},
+		{record: factorRecord(regions[0])},
+	}
+
+	payloads, err := batchPayloads(changes, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	functions := []string{}
+	for _, payload := range payloads {
+		functions = append(functions, payload.Function)
+	}
+	if got := strings.Join(functions, ","); got != "updateUtilityIdentifier,importUtilityFactorsBatch,importUtilityFactorsBatch" {
+		t.Fatalf("got payloads %s", got)
+	}
+	keys := func(payload invokePayload) string {
+		rows := []struct {
+			UtilityID string `json:"utilityID"`
+		}{}
+		if err := json.Unmarshal([]byte(payload.Args[0]), &rows); err != nil {
+			t.Fatal(err)
+		}
+		ids := []string{}
+		for _, r := range rows {
+			ids = append(ids, r.UtilityID)
+		}
+		return strings.Join(ids, ",")
+	}
+	if got := keys(payloads[1]); got != "USA_2019_STATE_CA,USA_2019_STATE_NY" {
+		t.Errorf("first batch has %s", got)
+	}
+	if got := keys(payloads[2]); got != "USA_2019_NERC_REGION_WECC" {
+		t.Errorf("second batch has %s", got)
+	}
+}
@@ -0,0 +1,174 @@
+// Offline loader of eGRID, EIA and EEA emissions data for the emissions chaincode in Golang
+//
+// It reads a spreadsheet, maps its rows to emissions factors or utility identifiers and
+// either writes them as invoke payloads or applies them to an in-memory ledger.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"chaincode-common/cclog"
+)
+
+func main() {
+	fileName := flag.String("file", "", "eGRID or EIA .xlsx file, or EEA .csv file")
+	sheetName := flag.String("sheet", "", "sheet to read from an .xlsx file, e.g. NRL18, ST18, US18 or Table 1")
+	kind := flag.String("kind", "", "NRL, ST, US, EIA or EU; inferred from -sheet for eGRID sheets")
+	snapshot := flag.String("snapshot", "", "JSON [{Key, Record}] of what is already on-ledger, to diff against")
+	out := flag.String("out", "-", "file for the invoke payloads, one JSON object per line; - for stdout")
+	batchSize := flag.Int("batch-size", 0, "write factors as importUtilityFactorsBatch payloads of this many rows; 0 for one payload per row")
+	useLedger := flag.Bool("ledger", false, "apply the records to an in-memory ledger instead of writing payloads")
+	saveSnapshot := flag.String("save-snapshot", "", "with -ledger, write the resulting ledger to this file")
+	dryRun := flag.Bool("dry-run", false, "print the differences from the ledger without writing anything")
+	flag.Parse()
+
+	// the chaincode run by -ledger logs to stderr, as the payloads and differences may go to stdout
+	cclog.SetOutput(os.Stderr)
+
+	if *fileName == "" {
+		fmt.Fprintln(os.Stderr, "-file is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *kind == "" {
+		*kind = kindFromSheetName(*sheetName)
+	}
+	*kind = strings.ToUpper(*kind)
+
+	records, err := loadRecords(*fileName, *sheetName, *kind)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading %s: %s\n", *fileName, err.Error())
+		os.Exit(1)
+	}
+
+	l, err := newLedger()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error starting the in-memory ledger: %s\n", err.Error())
+		os.Exit(1)
+	}
+	if *snapshot != "" {
+		if err := l.loadSnapshot(*snapshot); err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading snapshot %s: %s\n", *snapshot, err.Error())
+			os.Exit(1)
+		}
+	}
+	changes, unchanged, err := l.diff(records)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error comparing with the ledger: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if *dryRun {
+		for _, c := range changes {
+			fmt.Println(c.describe())
+		}
+		fmt.Printf("%d records: %d new or changed, %d unchanged\n", len(records), len(changes), unchanged)
+		return
+	}
+
+	if *useLedger {
+		failed := 0
+		for _, c := range changes {
+			if err := l.put(c.record, c.previous != nil); err != nil {
+				fmt.Fprintf(os.Stderr, "%s %s: %s\n", c.record.kind, c.record.key, err.Error())
+				failed++
+			}
+		}
+		fmt.Printf("%d records applied, %d failed, %d unchanged\n", len(changes)-failed, failed, unchanged)
+		if *saveSnapshot != "" {
+			if err := l.saveSnapshot(*saveSnapshot); err != nil {
+				fmt.Fprintf(os.Stderr, "Error saving snapshot %s: %s\n", *saveSnapshot, err.Error())
+				os.Exit(1)
+			}
+		}
+		if failed > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := writePayloads(*out, changes, *batchSize); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing payloads: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
+
+/* loadRecords reads the sheet and maps it by kind, reporting rows that could not be mapped on stderr */
+func loadRecords(fileName string, sheetName string, kind string) ([]record, error) {
+	// the EIA utility sheet has a title row above its header
+	headerRow := 1
+	if kind == kindUtility {
+		headerRow = 2
+	}
+	rows, err := readRows(fileName, sheetName, headerRow)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []record{}
+	var errs []rowError
+	switch kind {
+	case kindNercRegion, kindState, kindCountry:
+		factors, factorErrs := factorsFromEgrid(kind, rows)
+		for _, f := range factors {
+			records = append(records, factorRecord(f))
+		}
+		errs = factorErrs
+	case kindEU:
+		factors, factorErrs := factorsFromEEA(rows)
+		for _, f := range factors {
+			records = append(records, factorRecord(f))
+		}
+		errs = factorErrs
+	case kindUtility:
+		items, itemErrs := utilityIdentifiersFromEIA(rows)
+		for _, item := range items {
+			records = append(records, identifierRecord(item))
+		}
+		errs = itemErrs
+	default:
+		return nil, fmt.Errorf("unknown kind %q, expected NRL, ST, US, EIA or EU", kind)
+	}
+
+	for _, e := range errs {
+		fmt.Fprintf(os.Stderr, "Skipping %s\n", e.Error())
+	}
+	return records, nil
+}
+
+func writePayloads(fileName string, changes []change, batchSize int) error {
+	payloads := []invokePayload{}
+	if batchSize > 0 {
+		var err error
+		if payloads, err = batchPayloads(changes, batchSize); err != nil {
+			return err
+		}
+	} else {
+		for _, c := range changes {
+			payloads = append(payloads, c.payload())
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if fileName != "-" {
+		file, err := os.Create(fileName)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	encoder := json.NewEncoder(w)
+	for _, payload := range payloads {
+		if err := encoder.Encode(payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,294 @@
+// Mapping of eGRID, EIA and EEA rows to ledger records in Golang
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"emissions/contract"
+)
+
+/* the kinds of sheet the loader understands */
+const (
+	kindNercRegion = "NRL"
+	kindState      = "ST"
+	kindCountry    = "US"
+	kindUtility    = "EIA"
+	kindEU         = "EU"
+)
+
+/* eGRID reports annual emissions in short tons, except CH4 and N2O in lb, and net generation in MWh */
+const (
+	egridEmissionsUOM     = "short tons"
+	egridNetGenerationUOM = "MWH"
+	poundsPerShortTon     = 2000
+)
+
+// egridColumns names the columns of one eGRID aggregation level
+type egridColumns struct {
+	divisionType  string
+	divisionID    string
+	divisionName  string
+	netGeneration string
+	co2Emissions  string
+	nonRenewables string
+	renewables    string
+	co2           string
+	ch4           string
+	n2o           string
+}
+
+var egridLevels = map[string]egridColumns{
+	kindNercRegion: {
+		divisionType:  "NERC_REGION",
+		divisionID:    "NERC region acronym",
+		divisionName:  "NERC region name",
+		netGeneration: "NERC region annual net generation (MWh)",
+		co2Emissions:  "NERC region annual CO2 equivalent emissions (tons)",
+		nonRenewables: "NERC region annual total nonrenewables net generation (MWh)",
+		renewables:    "NERC region annual total renewables net generation (MWh)",
+		co2:           "NERC region annual CO2 emissions (tons)",
+		ch4:           "NERC region annual CH4 emissions (lbs)",
+		n2o:           "NERC region annual N2O emissions (lbs)",
+	},
+	kindState: {
+		divisionType:  "STATE",
+		divisionID:    "State abbreviation",
+		netGeneration: "State annual net generation (MWh)",
+		co2Emissions:  "State annual CO2 equivalent emissions (tons)",
+		nonRenewables: "State annual total nonrenewables net generation (MWh)",
+		renewables:    "State annual total renewables net generation (MWh)",
+		co2:           "State annual CO2 emissions (tons)",
+		ch4:           "State annual CH4 emissions (lbs)",
+		n2o:           "State annual N2O emissions (lbs)",
+	},
+	kindCountry: {
+		divisionType:  "COUNTRY",
+		netGeneration: "U.S. annual net generation (MWh)",
+		co2Emissions:  "U.S. annual CO2 equivalent emissions (tons)",
+		nonRenewables: "U.S. annual total nonrenewables net generation (MWh)",
+		renewables:    "U.S. annual total renewables net generation (MWh)",
+		co2:           "U.S. annual CO2 emissions (tons)",
+		ch4:           "U.S. annual CH4 emissions (lbs)",
+		n2o:           "U.S. annual N2O emissions (lbs)",
+	},
+}
+
+// rowError is a row that could not be mapped; the loader reports it and carries on
+type rowError struct {
+	row int
+	err error
+}
+
+func (e rowError) Error() string {
+	return fmt.Sprintf("row %d: %s", e.row, e.err.Error())
+}
+
+/* kindFromSheetName infers the kind from eGRID sheet names such as NRL18, ST19 or US19 */
+func kindFromSheetName(sheetName string) string {
+	name := strings.ToUpper(sheetName)
+	for _, kind := range []string{kindNercRegion, kindState, kindCountry} {
+		if strings.HasPrefix(name, kind) {
+			return kind
+		}
+	}
+	return ""
+}
+
+/* parseNumber reads a spreadsheet number, which may carry thousands separators */
+func parseNumber(column string, value string) (float64, error) {
+	number, err := strconv.ParseFloat(strings.Replace(strings.TrimSpace(value), ",", "", -1), 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s is not a number: %q", column, value)
+	}
+	return number, nil
+}
+
+/* factorsFromEgrid maps the rows of an eGRID NRL, ST or US sheet to emissions factors */
+func factorsFromEgrid(kind string, rows []row) ([]contract.UtilityEmissionsFactors, []rowError) {
+	columns := egridLevels[kind]
+	factors := []contract.UtilityEmissionsFactors{}
+	errs := []rowError{}
+	for _, r := range rows {
+		year := r.get("Data Year")
+		// the second header row of eGRID sheets holds the column codes
+		if year == "" || year == "YEAR" {
+			continue
+		}
+
+		factor := contract.UtilityEmissionsFactors{
+			Year:             year,
+			Country:          "USA",
+			DivisionType:     columns.divisionType,
+			NetGenerationUOM: egridNetGenerationUOM,
+			EmissionsUOM:     egridEmissionsUOM,
+		}
+		switch kind {
+		case kindNercRegion:
+			factor.DivisionId = r.get(columns.divisionID)
+			factor.DivisionName = r.get(columns.divisionName)
+			factor.UtilityID = "USA_" + year + "_NERC_REGION_" + factor.DivisionId
+		case kindState:
+			factor.DivisionId = r.get(columns.divisionID)
+			factor.DivisionName = stateNames[factor.DivisionId]
+			factor.UtilityID = "USA_" + year + "_STATE_" + factor.DivisionId
+		case kindCountry:
+			factor.DivisionId = "USA"
+			factor.DivisionName = "United States of America"
+			factor.UtilityID = "COUNTRY_USA_" + year
+		}
+
+		var err error
+		if factor.NetGeneration, err = parseNumber(columns.netGeneration, r.get(columns.netGeneration)); err != nil {
+			errs = append(errs, rowError{r.number, err})
+			continue
+		}
+		if factor.CO2EquivalentEmissions, err = parseNumber(columns.co2Emissions, r.get(columns.co2Emissions)); err != nil {
+			errs = append(errs, rowError{r.number, err})
+			continue
+		}
+		// the generation mix is missing from older sheets; the factor is then loaded without it
+		if r.get(columns.renewables) != "" {
+			if factor.NonRenewables, err = parseNumber(columns.nonRenewables, r.get(columns.nonRenewables)); err != nil {
+				errs = append(errs, rowError{r.number, err})
+				continue
+			}
+			if factor.Renewables, err = parseNumber(columns.renewables, r.get(columns.renewables)); err != nil {
+				errs = append(errs, rowError{r.number, err})
+				continue
+			}
+		}
+		// the emissions of each gas are also missing from older sheets
+		if r.get(columns.co2) != "" {
+			gasEmissions, err := gasEmissionsFromEgrid(columns, r)
+			if err != nil {
+				errs = append(errs, rowError{r.number, err})
+				continue
+			}
+			factor.GasEmissions = gasEmissions
+		}
+		if err := factor.Validate(); err != nil {
+			errs = append(errs, rowError{r.number, err})
+			continue
+		}
+		factors = append(factors, factor)
+	}
+	return factors, errs
+}
+
+/* gasEmissionsFromEgrid reads the CO2, CH4 and N2O emissions of an eGRID row, in short tons */
+func gasEmissionsFromEgrid(columns egridColumns, r row) (map[string]float64, error) {
+	co2, err := parseNumber(columns.co2, r.get(columns.co2))
+	if err != nil {
+		return nil, err
+	}
+	ch4, err := parseNumber(columns.ch4, r.get(columns.ch4))
+	if err != nil {
+		return nil, err
+	}
+	n2o, err := parseNumber(columns.n2o, r.get(columns.n2o))
+	if err != nil {
+		return nil, err
+	}
+	return map[string]float64{"CO2": co2, "CH4": ch4 / poundsPerShortTon, "N2O": n2o / poundsPerShortTon}, nil
+}
+
+/* factorsFromEEA maps the EEA CO2 emission intensity sheet (g CO2 per kWh by member state) to country factors */
+func factorsFromEEA(rows []row) ([]contract.UtilityEmissionsFactors, []rowError) {
+	factors := []contract.UtilityEmissionsFactors{}
+	errs := []rowError{}
+	for _, r := range rows {
+		year := r.get("Date:year")
+		memberState := r.get("Member State:text")
+		if year == "" || strings.HasPrefix(memberState, "European Union") {
+			continue
+		}
+		country := strings.Replace(memberState, " ", "_", -1)
+		code, ok := countryCodes[country]
+		if !ok {
+			errs = append(errs, rowError{r.number, fmt.Errorf("unknown member state %q", memberState)})
+			continue
+		}
+		intensity, err := parseNumber("index:number", r.get("index:number"))
+		if err != nil {
+			errs = append(errs, rowError{r.number, err})
+			continue
+		}
+
+		// an intensity of X g/kWh is stored as X g emitted per 1 kWh generated
+		factor := contract.UtilityEmissionsFactors{
+			UtilityID:              "COUNTRY_" + code + "_" + year,
+			Year:                   year,
+			Country:                country,
+			DivisionType:           "COUNTRY",
+			DivisionId:             country,
+			DivisionName:           country,
+			NetGeneration:          1,
+			NetGenerationUOM:       "KWH",
+			CO2EquivalentEmissions: intensity,
+			EmissionsUOM:           "g",
+		}
+		if err := factor.Validate(); err != nil {
+			errs = append(errs, rowError{r.number, err})
+			continue
+		}
+		factors = append(factors, factor)
+	}
+	return factors, errs
+}
+
+/* utilityIdentifiersFromEIA maps the EIA-861 utility data sheet to utility identifiers */
+func utilityIdentifiersFromEIA(rows []row) ([]contract.UtilityLookupItem, []rowError) {
+	items := []contract.UtilityLookupItem{}
+	errs := []rowError{}
+	for _, r := range rows {
+		year := r.get("Data Year")
+		number := r.get("Utility Number")
+		if year == "" || number == "" {
+			continue
+		}
+		item := contract.UtilityLookupItem{
+			UUID:          "USA_EIA_" + number,
+			Year:          year,
+			UtilityNumber: number,
+			UtilityName:   r.get("Utility Name"),
+			Country:       "USA",
+			StateProvince: r.get("State"),
+		}
+		if region := r.get("NERC Region"); region != "" {
+			item.Divisions = contract.Divisions{DivisionType: "NERC_REGION", DivisionId: strings.Replace(region, " ", "_", -1)}
+		}
+		if err := item.Validate(); err != nil {
+			errs = append(errs, rowError{r.number, err})
+			continue
+		}
+		items = append(items, item)
+	}
+	return items, errs
+}
+
+var stateNames = map[string]string{
+	"AL": "Alabama", "AK": "Alaska", "AS": "American_Samoa", "AZ": "Arizona", "AR": "Arkansas",
+	"CA": "California", "CO": "Colorado", "CT": "Connecticut", "DE": "Delaware", "DC": "District_Of_Columbia",
+	"FM": "Federated_States_Of_Micronesia", "FL": "Florida", "GA": "Georgia", "GU": "Guam", "HI": "Hawaii",
+	"ID": "Idaho", "IL": "Illinois", "IN": "Indiana", "IA": "Iowa", "KS": "Kansas",
+	"KY": "Kentucky", "LA": "Louisiana", "ME": "Maine", "MH": "Marshall_Islands", "MD": "Maryland",
+	"MA": "Massachusetts", "MI": "Michigan", "MN": "Minnesota", "MS": "Mississippi", "MO": "Missouri",
+	"MT": "Montana", "NE": "Nebraska", "NV": "Nevada", "NH": "New_Hampshire", "NJ": "New_Jersey",
+	"NM": "New_Mexico", "NY": "New_York", "NC": "North_Carolina", "ND": "North_Dakota", "MP": "Northern_Mariana_Islands",
+	"OH": "Ohio", "OK": "Oklahoma", "OR": "Oregon", "PW": "Palau", "PA": "Pennsylvania",
+	"PR": "Puerto_Rico", "RI": "Rhode_Island", "SC": "South_Carolina", "SD": "South_Dakota", "TN": "Tennessee",
+	"TX": "Texas", "UT": "Utah", "VT": "Vermont", "VI": "Virgin_Islands", "VA": "Virginia",
+	"WA": "Washington", "WV": "West_Virginia", "WI": "Wisconsin", "WY": "Wyoming",
+}
+
+var countryCodes = map[string]string{
+	"Belgium": "BE", "Bulgaria": "BG", "Czechia": "CZ", "Denmark": "DK", "Germany": "DE",
+	"Estonia": "EE", "Ireland": "IE", "Greece": "EL", "Spain": "ES", "France": "FR",
+	"Croatia": "HR", "Italy": "IT", "Cyprus": "CY", "Latvia": "LV", "Lithuania": "LT",
+	"Luxembourg": "LU", "Hungary": "HU", "Malta": "MT", "Netherlands": "NL", "Austria": "AT",
+	"Poland": "PL", "Portugal": "PT", "Romania": "RO", "Slovenia": "SI", "Slovakia": "SK",
+	"Finland": "FI", "Sweden": "SE", "United_Kingdom": "UK",
+}
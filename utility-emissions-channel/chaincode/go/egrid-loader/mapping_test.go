@@ -0,0 +1,143 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+/* mustReadRows reads a fixture sheet from testdata */
+func mustReadRows(t *testing.T, fileName string, sheetName string, headerRow int) []row {
+	rows, err := readRows("testdata/"+fileName, sheetName, headerRow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+/* errorRows lists the row numbers of mapping errors */
+func errorRows(errs []rowError) []int {
+	numbers := []int{}
+	for _, e := range errs {
+		numbers = append(numbers, e.row)
+	}
+	return numbers
+}
+
+func TestKindFromSheetName(t *testing.T) {
+	tests := map[string]string{"NRL18": kindNercRegion, "st19": kindState, "US19": kindCountry, "Table 1": "", "": ""}
+	for sheetName, want := range tests {
+		if got := kindFromSheetName(sheetName); got != want {
+			t.Errorf("kindFromSheetName(%q) = %q, want %q", sheetName, got, want)
+		}
+	}
+}
+
+func TestReadRows(t *testing.T) {
+	rows := mustReadRows(t, "egrid2019.xlsx", "ST19", 1)
+	// the blank row is skipped, and rows keep their sheet row numbers
+	numbers := []int{}
+	for _, r := range rows {
+		numbers = append(numbers, r.number)
+	}
+	if len(rows) != 5 || numbers[0] != 2 || numbers[4] != 7 {
+		t.Fatalf("got rows %v", numbers)
+	}
+	if got := rows[1].get("State abbreviation"); got != "CA" {
+		t.Errorf("got state %q", got)
+	}
+	if got := rows[1].get("no such column"); got != "" {
+		t.Errorf("got %q for a missing column", got)
+	}
+
+	if _, err := readRows("testdata/egrid2019.xlsx", "ST18", 1); err == nil || !strings.Contains(err.Error(), "found ST19, NRL19, US19") {
+		t.Errorf("a missing sheet returned %v", err)
+	}
+	if _, err := readRows("testdata/eia861.csv", "", 9); err == nil || !strings.Contains(err.Error(), "no header row 9") {
+		t.Errorf("a missing header row returned %v", err)
+	}
+	if _, err := readRows("testdata/eea.txt", "", 1); err == nil || !strings.Contains(err.Error(), "unsupported file type") {
+		t.Errorf("a .txt file returned %v", err)
+	}
+}
+
+func TestFactorsFromEgridState(t *testing.T) {
+	factors, errs := factorsFromEgrid(kindState, mustReadRows(t, "egrid2019.xlsx", "ST19", 1))
+	if got := errorRows(errs); len(got) != 2 || got[0] != 5 || got[1] != 7 {
+		t.Errorf("got errors in rows %v: %v", got, errs)
+	}
+	if len(errs) == 2 && (!strings.Contains(errs[0].Error(), "row 5: State annual net generation (MWh) is not a number") || !strings.Contains(errs[1].Error(), "must not be negative")) {
+		t.Errorf("got errors %v", errs)
+	}
+	if len(factors) != 2 {
+		t.Fatalf("got factors %+v", factors)
+	}
+
+	ca := factors[0]
+	if ca.UtilityID != "USA_2019_STATE_CA" || ca.Year != "2019" || ca.Country != "USA" || ca.DivisionType != "STATE" || ca.DivisionId != "CA" || ca.DivisionName != "California" {
+		t.Errorf("got division of %+v", ca)
+	}
+	if ca.NetGeneration != 200000000 || ca.NetGenerationUOM != "MWH" || ca.CO2EquivalentEmissions != 50000000 || ca.EmissionsUOM != "short tons" {
+		t.Errorf("got amounts of %+v", ca)
+	}
+	if ca.NonRenewables != 120000000 || ca.Renewables != 80000000 {
+		t.Errorf("got generation mix of %+v", ca)
+	}
+	// CH4 and N2O are reported in lb and converted to short tons
+	if ca.GasEmissions["CO2"] != 49000000 || ca.GasEmissions["CH4"] != 2000 || ca.GasEmissions["N2O"] != 300 {
+		t.Errorf("got gas emissions %v", ca.GasEmissions)
+	}
+
+	// thousands separators are read, and older rows without a generation mix or gases still load
+	ny := factors[1]
+	if ny.UtilityID != "USA_2019_STATE_NY" || ny.DivisionName != "New_York" || ny.NetGeneration != 130000000 || ny.Renewables != 0 || ny.GasEmissions != nil {
+		t.Errorf("got factor %+v", ny)
+	}
+}
+
+func TestFactorsFromEgridRegionAndCountry(t *testing.T) {
+	factors, errs := factorsFromEgrid(kindNercRegion, mustReadRows(t, "egrid2019.xlsx", "NRL19", 1))
+	if len(errs) != 0 || len(factors) != 1 {
+		t.Fatalf("got factors %+v, errors %v", factors, errs)
+	}
+	if f := factors[0]; f.UtilityID != "USA_2019_NERC_REGION_WECC" || f.DivisionType != "NERC_REGION" || f.DivisionId != "WECC" ||
+		f.DivisionName != "Western Electricity Coordinating Council" || f.CO2EquivalentEmissions != 280000000 || f.GasEmissions["CH4"] != 10000 {
+		t.Errorf("got factor %+v", f)
+	}
+
+	factors, errs = factorsFromEgrid(kindCountry, mustReadRows(t, "egrid2019.xlsx", "US19", 1))
+	if len(errs) != 0 || len(factors) != 1 {
+		t.Fatalf("got factors %+v, errors %v", factors, errs)
+	}
+	if f := factors[0]; f.UtilityID != "COUNTRY_USA_2019" || f.DivisionType != "COUNTRY" || f.DivisionId != "USA" ||
+		f.DivisionName != "United States of America" || f.NetGeneration != 4100000000 || f.GasEmissions["N2O"] != 15000 {
+		t.Errorf("got factor %+v", f)
+	}
+}
+
+func TestFactorsFromEEA(t *testing.T) {
+	factors, errs := factorsFromEEA(mustReadRows(t, "eea.csv", "", 1))
+	if got := errorRows(errs); len(got) != 2 || got[0] != 4 || got[1] != 5 {
+		t.Errorf("got errors in rows %v: %v", got, errs)
+	}
+	if len(factors) != 1 {
+		t.Fatalf("got factors %+v", factors)
+	}
+	if f := factors[0]; f.UtilityID != "COUNTRY_DE_2019" || f.Country != "Germany" || f.DivisionType != "COUNTRY" || f.DivisionId != "Germany" ||
+		f.NetGeneration != 1 || f.NetGenerationUOM != "KWH" || f.CO2EquivalentEmissions != 338 || f.EmissionsUOM != "g" {
+		t.Errorf("got factor %+v", f)
+	}
+}
+
+func TestUtilityIdentifiersFromEIA(t *testing.T) {
+	items, errs := utilityIdentifiersFromEIA(mustReadRows(t, "eia861.csv", "", 2))
+	if len(errs) != 0 || len(items) != 2 {
+		t.Fatalf("got identifiers %+v, errors %v", items, errs)
+	}
+	if item := items[0]; item.UUID != "USA_EIA_11208" || item.Year != "2019" || item.UtilityNumber != "11208" || item.UtilityName != "Los Angeles Department of Water & Power" ||
+		item.Country != "USA" || item.StateProvince != "CA" || item.Divisions.DivisionType != "NERC_REGION" || item.Divisions.DivisionId != "WECC" {
+		t.Errorf("got identifier %+v", item)
+	}
+	if item := items[1]; item.UUID != "USA_EIA_252" || item.Divisions.DivisionType != "" {
+		t.Errorf("got identifier %+v", item)
+	}
+}
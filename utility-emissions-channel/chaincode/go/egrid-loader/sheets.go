@@ -0,0 +1,105 @@
+// Worksheet reading for the eGRID loader in Golang
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tealeg/xlsx"
+)
+
+// row is one worksheet row, keyed by the trimmed column header
+type row struct {
+	number int
+	values map[string]string
+}
+
+/* get returns the trimmed value of a column, or "" if the row has no such column */
+func (r row) get(column string) string {
+	return strings.TrimSpace(r.values[column])
+}
+
+/* readRows reads a CSV file or a sheet of an XLSX file; headerRow is the 1-based row holding the column names */
+func readRows(fileName string, sheetName string, headerRow int) ([]row, error) {
+	var records [][]string
+	var err error
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".csv":
+		records, err = readCSV(fileName)
+	case ".xlsx":
+		records, err = readXLSX(fileName, sheetName)
+	default:
+		return nil, fmt.Errorf("unsupported file type %s, expected .xlsx or .csv", fileName)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(records) < headerRow {
+		return nil, fmt.Errorf("%s has no header row %d", fileName, headerRow)
+	}
+
+	headers := records[headerRow-1]
+	rows := []row{}
+	for i := headerRow; i < len(records); i++ {
+		values := map[string]string{}
+		empty := true
+		for j, value := range records[i] {
+			if j >= len(headers) || strings.TrimSpace(headers[j]) == "" {
+				continue
+			}
+			values[strings.TrimSpace(headers[j])] = value
+			if strings.TrimSpace(value) != "" {
+				empty = false
+			}
+		}
+		if !empty {
+			rows = append(rows, row{number: i + 1, values: values})
+		}
+	}
+	return rows, nil
+}
+
+func readCSV(fileName string) ([][]string, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	return reader.ReadAll()
+}
+
+func readXLSX(fileName string, sheetName string) ([][]string, error) {
+	file, err := xlsx.OpenFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	sheet, ok := file.Sheet[sheetName]
+	if !ok {
+		names := []string{}
+		for _, s := range file.Sheets {
+			names = append(names, s.Name)
+		}
+		return nil, fmt.Errorf("%s has no sheet %q, found %s", fileName, sheetName, strings.Join(names, ", "))
+	}
+
+	records := [][]string{}
+	for _, sheetRow := range sheet.Rows {
+		record := []string{}
+		if sheetRow != nil {
+			for _, cell := range sheetRow.Cells {
+				// the raw value, so numbers are not formatted with thousands separators
+				record = append(record, cell.Value)
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
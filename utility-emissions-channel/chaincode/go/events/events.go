@@ -0,0 +1,170 @@
+// Package events defines the chaincode events of the emissions chaincode and decodes them from blocks.
+//
+// Every event payload is a JSON envelope naming its type and the version of the schema of its data:
+//
+//	{"type": "EmissionsRecordCreated", "version": 1, "txId": "...", "timestamp": "2020-01-31T10:00:00Z", "data": {...}}
+//
+// A new version is only needed for changes that break existing readers, such as removing or renaming a
+// field; Decode rejects versions newer than this package knows, so a listener never misreads them.
+// Fabric keeps one event per transaction, so a transaction writing several items names them all in one event.
+//
+// This package only depends on fabric-protos-go and the golang/protobuf decoder of its messages, not on the
+// chaincode shim, so off-chain listeners can use it with any client that delivers blocks.
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Type is the name of a chaincode event
+type Type string
+
+const (
+	// EmissionsRecordCreated is set when an emissions record is written under a new key; its data is RecordData
+	EmissionsRecordCreated Type = "EmissionsRecordCreated"
+	// EmissionsRecordUpdated is set when an emissions record is written over an existing one; its data is RecordData
+	EmissionsRecordUpdated Type = "EmissionsRecordUpdated"
+	// FactorImported is set when utility emissions factors are imported or updated; its data is FactorImportedData
+	FactorImported Type = "FactorImported"
+	// RecordTokenized is set when emissions records are linked to a token; its data is RecordTokenizedData
+	RecordTokenized Type = "RecordTokenized"
+	// InstrumentRegistered is set when a contractual instrument is registered; its data is InstrumentData
+	InstrumentRegistered Type = "InstrumentRegistered"
+	// InstrumentRetired is set when a contractual instrument is retired; its data is InstrumentData
+	InstrumentRetired Type = "InstrumentRetired"
+)
+
+// versions are the current schema versions of the data of each event type
+var versions = map[Type]int{
+	EmissionsRecordCreated: 1,
+	EmissionsRecordUpdated: 1,
+	FactorImported:         1,
+	RecordTokenized:        1,
+	InstrumentRegistered:   1,
+	InstrumentRetired:      1,
+}
+
+// Version returns the current schema version of the data of an event type, 0 for unknown types
+func Version(t Type) int {
+	return versions[t]
+}
+
+// Event is a decoded chaincode event. BlockNumber and ChaincodeID are only set by FromBlock.
+type Event struct {
+	Type      Type            `json:"type"`
+	Version   int             `json:"version"`
+	TxID      string          `json:"txId"`
+	Timestamp string          `json:"timestamp"`
+	Data      json.RawMessage `json:"data"`
+
+	BlockNumber uint64 `json:"-"`
+	ChaincodeID string `json:"-"`
+}
+
+// RecordData is the data of EmissionsRecordCreated and EmissionsRecordUpdated; Record is the emissions record as stored
+type RecordData struct {
+	Key    string          `json:"key"`
+	Record json.RawMessage `json:"record"`
+}
+
+// FactorChange is one factor written by a transaction; Status is created or updated
+type FactorChange struct {
+	Key    string `json:"key"`
+	Status string `json:"status"`
+}
+
+// FactorImportedData is the data of FactorImported
+type FactorImportedData struct {
+	Factors []FactorChange `json:"factors"`
+}
+
+// RecordTokenizedData is the data of RecordTokenized; IssuedBy is the address of the token issuer
+type RecordTokenizedData struct {
+	TokenID    string   `json:"tokenId"`
+	IssuedBy   string   `json:"issuedBy"`
+	RecordKeys []string `json:"recordKeys"`
+}
+
+// InstrumentData is the data of InstrumentRegistered and InstrumentRetired; Instrument is the contractual instrument as stored
+type InstrumentData struct {
+	Key        string          `json:"key"`
+	Instrument json.RawMessage `json:"instrument"`
+}
+
+// Marshal builds the payload of an event of the current version of its type
+func Marshal(t Type, txID string, timestamp string, data interface{}) ([]byte, error) {
+	version, ok := versions[t]
+	if !ok {
+		return nil, fmt.Errorf("unknown event type %q", t)
+	}
+	dataAsBytes, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(&Event{Type: t, Version: version, TxID: txID, Timestamp: timestamp, Data: dataAsBytes})
+}
+
+// Decode reads the payload of a chaincode event of the given name
+func Decode(name string, payload []byte) (*Event, error) {
+	event := &Event{}
+	if err := json.Unmarshal(payload, event); err != nil {
+		return nil, fmt.Errorf("event %s is not a JSON event envelope: %s", name, err.Error())
+	}
+	if string(event.Type) != name {
+		return nil, fmt.Errorf("event %s has type %q", name, event.Type)
+	}
+	version, ok := versions[event.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown event type %q", event.Type)
+	}
+	if event.Version < 1 || event.Version > version {
+		return nil, fmt.Errorf("event %s has version %d, this listener reads versions 1 to %d", name, event.Version, version)
+	}
+	return event, nil
+}
+
+func (e *Event) unmarshalData(v interface{}, types ...Type) error {
+	for _, t := range types {
+		if e.Type == t {
+			return json.Unmarshal(e.Data, v)
+		}
+	}
+	return fmt.Errorf("event %s does not have %T", e.Type, v)
+}
+
+// RecordData decodes the data of EmissionsRecordCreated and EmissionsRecordUpdated
+func (e *Event) RecordData() (*RecordData, error) {
+	data := &RecordData{}
+	if err := e.unmarshalData(data, EmissionsRecordCreated, EmissionsRecordUpdated); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// FactorImportedData decodes the data of FactorImported
+func (e *Event) FactorImportedData() (*FactorImportedData, error) {
+	data := &FactorImportedData{}
+	if err := e.unmarshalData(data, FactorImported); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// RecordTokenizedData decodes the data of RecordTokenized
+func (e *Event) RecordTokenizedData() (*RecordTokenizedData, error) {
+	data := &RecordTokenizedData{}
+	if err := e.unmarshalData(data, RecordTokenized); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// InstrumentData decodes the data of InstrumentRegistered and InstrumentRetired
+func (e *Event) InstrumentData() (*InstrumentData, error) {
+	data := &InstrumentData{}
+	if err := e.unmarshalData(data, InstrumentRegistered, InstrumentRetired); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,129 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+/* envelope builds an endorser transaction whose chaincode action carries an event */
+func envelope(t *testing.T, event *peer.ChaincodeEvent) []byte {
+	eventAsBytes := mustMarshal(t, event)
+	chaincodeAction := mustMarshal(t, &peer.ChaincodeAction{Events: eventAsBytes})
+	responsePayload := mustMarshal(t, &peer.ProposalResponsePayload{Extension: chaincodeAction})
+	actionPayload := mustMarshal(t, &peer.ChaincodeActionPayload{
+		Action: &peer.ChaincodeEndorsedAction{ProposalResponsePayload: responsePayload},
+	})
+	transaction := mustMarshal(t, &peer.Transaction{Actions: []*peer.TransactionAction{{Payload: actionPayload}}})
+	channelHeader := mustMarshal(t, &common.ChannelHeader{Type: int32(common.HeaderType_ENDORSER_TRANSACTION), TxId: event.TxId})
+	payload := mustMarshal(t, &common.Payload{Header: &common.Header{ChannelHeader: channelHeader}, Data: transaction})
+	return mustMarshal(t, &common.Envelope{Payload: payload})
+}
+
+func mustMarshal(t *testing.T, message proto.Message) []byte {
+	messageAsBytes, err := proto.Marshal(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return messageAsBytes
+}
+
+func chaincodeEvent(t *testing.T, chaincodeID string, eventType Type, txID string, data interface{}) *peer.ChaincodeEvent {
+	payload, err := Marshal(eventType, txID, "2020-01-31T10:00:00Z", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &peer.ChaincodeEvent{ChaincodeId: chaincodeID, TxId: txID, EventName: string(eventType), Payload: payload}
+}
+
+/* testBlock has a created record, an invalidated update, an event of another chaincode and an imported factor */
+func testBlock(t *testing.T) *common.Block {
+	record := RecordData{Key: "USA_EIA_11208_2020-01-01_2020-01-31", Record: []byte(`{"uuid":"1"}`)}
+	envelopes := [][]byte{
+		envelope(t, chaincodeEvent(t, "emissions", EmissionsRecordCreated, "tx1", record)),
+		envelope(t, chaincodeEvent(t, "emissions", EmissionsRecordUpdated, "tx2", record)),
+		envelope(t, &peer.ChaincodeEvent{ChaincodeId: "marbles", TxId: "tx3", EventName: string(FactorImported), Payload: []byte("not JSON")}),
+		envelope(t, chaincodeEvent(t, "emissions", FactorImported, "tx4", FactorImportedData{Factors: []FactorChange{{Key: "USA_2019_NY", Status: "created"}}})),
+	}
+	txFilter := []byte{byte(peer.TxValidationCode_VALID), byte(peer.TxValidationCode_MVCC_READ_CONFLICT), byte(peer.TxValidationCode_VALID), byte(peer.TxValidationCode_VALID)}
+	metadata := make([][]byte, len(common.BlockMetadataIndex_name))
+	metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER] = txFilter
+	return &common.Block{
+		Header:   &common.BlockHeader{Number: 7},
+		Data:     &common.BlockData{Data: envelopes},
+		Metadata: &common.BlockMetadata{Metadata: metadata},
+	}
+}
+
+func TestFromBlock(t *testing.T) {
+	found, err := FromBlock(testBlock(t), "emissions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 {
+		t.Fatalf("got %d events, want 2", len(found))
+	}
+	if found[0].Type != EmissionsRecordCreated || found[0].TxID != "tx1" || found[0].BlockNumber != 7 || found[0].ChaincodeID != "emissions" {
+		t.Errorf("unexpected first event %+v", found[0])
+	}
+	record, err := found[0].RecordData()
+	if err != nil || record.Key != "USA_EIA_11208_2020-01-01_2020-01-31" || string(record.Record) != `{"uuid":"1"}` {
+		t.Errorf("RecordData() = %+v, %v", record, err)
+	}
+	factors, err := found[1].FactorImportedData()
+	if err != nil || len(factors.Factors) != 1 || factors.Factors[0].Status != "created" {
+		t.Errorf("FactorImportedData() = %+v, %v", factors, err)
+	}
+	if _, err := found[1].RecordData(); err == nil {
+		t.Errorf("RecordData() of %s did not fail", found[1].Type)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		wantErr bool
+	}{
+		{"current version", `{"type":"RecordTokenized","version":1,"txId":"tx1","data":{"tokenId":"1"}}`, false},
+		{"newer version", `{"type":"RecordTokenized","version":2,"txId":"tx1","data":{}}`, true},
+		{"missing version", `{"type":"RecordTokenized","txId":"tx1","data":{}}`, true},
+		{"type does not match the name", `{"type":"FactorImported","version":1,"txId":"tx1","data":{}}`, true},
+		{"not JSON", `RecordTokenized`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decode(string(RecordTokenized), []byte(tt.payload))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestListener(t *testing.T) {
+	listener := NewListener("emissions")
+	handled := []string{}
+	listener.On(EmissionsRecordCreated, func(event *Event) error {
+		handled = append(handled, event.TxID)
+		return nil
+	})
+	listener.On(FactorImported, func(event *Event) error {
+		return errors.New("factor store unavailable")
+	})
+
+	blocks := make(chan *common.Block, 1)
+	blocks <- testBlock(t)
+	close(blocks)
+	err := listener.Run(context.Background(), blocks)
+	if err == nil || err.Error() != "FactorImported of transaction tx4: factor store unavailable" {
+		t.Errorf("Run() error = %v", err)
+	}
+	if len(handled) != 1 || handled[0] != "tx1" {
+		t.Errorf("handled %v, want [tx1]", handled)
+	}
+}
@@ -0,0 +1,149 @@
+// Decoding of emissions chaincode events from committed blocks
+
+package events
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// FromBlock returns the events the chaincode set in the valid transactions of a block, in block order.
+// Events of other chaincodes and of invalidated transactions are skipped, as are event names that are
+// not emissions events.
+func FromBlock(block *common.Block, chaincodeID string) ([]*Event, error) {
+	if block.GetHeader() == nil || block.GetData() == nil {
+		return nil, fmt.Errorf("block has no header or data")
+	}
+	var txFilter []byte
+	if metadata := block.GetMetadata().GetMetadata(); len(metadata) > int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		txFilter = metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
+	}
+
+	found := []*Event{}
+	for i, envelopeAsBytes := range block.Data.Data {
+		if i < len(txFilter) && peer.TxValidationCode(txFilter[i]) != peer.TxValidationCode_VALID {
+			continue
+		}
+		chaincodeEvents, err := transactionEvents(envelopeAsBytes)
+		if err != nil {
+			return nil, fmt.Errorf("block %d transaction %d: %s", block.Header.Number, i, err.Error())
+		}
+		for _, chaincodeEvent := range chaincodeEvents {
+			if chaincodeEvent.ChaincodeId != chaincodeID || Version(Type(chaincodeEvent.EventName)) == 0 {
+				continue
+			}
+			event, err := Decode(chaincodeEvent.EventName, chaincodeEvent.Payload)
+			if err != nil {
+				return nil, fmt.Errorf("block %d transaction %s: %s", block.Header.Number, chaincodeEvent.TxId, err.Error())
+			}
+			event.BlockNumber = block.Header.Number
+			event.ChaincodeID = chaincodeEvent.ChaincodeId
+			found = append(found, event)
+		}
+	}
+	return found, nil
+}
+
+/* transactionEvents unwraps the chaincode events of an endorser transaction; other transactions have none */
+func transactionEvents(envelopeAsBytes []byte) ([]*peer.ChaincodeEvent, error) {
+	envelope := &common.Envelope{}
+	if err := proto.Unmarshal(envelopeAsBytes, envelope); err != nil {
+		return nil, err
+	}
+	payload := &common.Payload{}
+	if err := proto.Unmarshal(envelope.Payload, payload); err != nil {
+		return nil, err
+	}
+	channelHeader := &common.ChannelHeader{}
+	if err := proto.Unmarshal(payload.GetHeader().GetChannelHeader(), channelHeader); err != nil {
+		return nil, err
+	}
+	if common.HeaderType(channelHeader.Type) != common.HeaderType_ENDORSER_TRANSACTION {
+		return nil, nil
+	}
+
+	transaction := &peer.Transaction{}
+	if err := proto.Unmarshal(payload.Data, transaction); err != nil {
+		return nil, err
+	}
+	chaincodeEvents := []*peer.ChaincodeEvent{}
+	for _, action := range transaction.Actions {
+		actionPayload := &peer.ChaincodeActionPayload{}
+		if err := proto.Unmarshal(action.Payload, actionPayload); err != nil {
+			return nil, err
+		}
+		responsePayload := &peer.ProposalResponsePayload{}
+		if err := proto.Unmarshal(actionPayload.GetAction().GetProposalResponsePayload(), responsePayload); err != nil {
+			return nil, err
+		}
+		chaincodeAction := &peer.ChaincodeAction{}
+		if err := proto.Unmarshal(responsePayload.Extension, chaincodeAction); err != nil {
+			return nil, err
+		}
+		if len(chaincodeAction.Events) == 0 {
+			continue
+		}
+		chaincodeEvent := &peer.ChaincodeEvent{}
+		if err := proto.Unmarshal(chaincodeAction.Events, chaincodeEvent); err != nil {
+			return nil, err
+		}
+		chaincodeEvents = append(chaincodeEvents, chaincodeEvent)
+	}
+	return chaincodeEvents, nil
+}
+
+// Handler handles an event; an error stops the listener
+type Handler func(*Event) error
+
+// Listener dispatches the events of the emissions chaincode in blocks to the handlers of their type
+type Listener struct {
+	ChaincodeID string
+	handlers    map[Type][]Handler
+}
+
+// NewListener returns a listener of the events of the chaincode installed under the given name
+func NewListener(chaincodeID string) *Listener {
+	return &Listener{ChaincodeID: chaincodeID, handlers: map[Type][]Handler{}}
+}
+
+// On adds a handler of the events of a type
+func (l *Listener) On(t Type, handler Handler) {
+	l.handlers[t] = append(l.handlers[t], handler)
+}
+
+// HandleBlock calls the handlers of the events in a block, in block order
+func (l *Listener) HandleBlock(block *common.Block) error {
+	found, err := FromBlock(block, l.ChaincodeID)
+	if err != nil {
+		return err
+	}
+	for _, event := range found {
+		for _, handler := range l.handlers[event.Type] {
+			if err := handler(event); err != nil {
+				return fmt.Errorf("%s of transaction %s: %s", event.Type, event.TxID, err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// Run handles the blocks received, e.g. from a peer deliver client, until the channel is closed or the context is done
+func (l *Listener) Run(ctx context.Context, blocks <-chan *common.Block) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case block, ok := <-blocks:
+			if !ok {
+				return nil
+			}
+			if err := l.HandleBlock(block); err != nil {
+				return err
+			}
+		}
+	}
+}
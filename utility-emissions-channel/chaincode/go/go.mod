@@ -3,18 +3,18 @@ module emissions
 go 1.12
 
 require (
-	github.com/fsouza/go-dockerclient v1.6.5 // indirect
-	github.com/grpc-ecosystem/go-grpc-middleware v1.2.1 // indirect
-	github.com/hyperledger/fabric v1.4.1
-	github.com/hyperledger/fabric-amcl v0.0.0-20200424173818-327c9e2cf77a // indirect
-	github.com/miekg/pkcs11 v1.0.3 // indirect
-	github.com/op/go-logging v0.0.0-20160315200505-970db520ece7 // indirect
-	github.com/pkg/errors v0.9.1 // indirect
-	github.com/spf13/viper v1.7.1 // indirect
-	github.com/sykesm/zap-logfmt v0.0.3 // indirect
-	go.uber.org/zap v1.15.0 // indirect
-	golang.org/x/crypto v0.0.0-20200820211705-5c72a883971a // indirect
+	chaincode-common v0.0.0
+	github.com/golang/protobuf v1.3.3
+	github.com/hyperledger/fabric-chaincode-go v0.0.0-20200424173110-d7076418f212
+	github.com/hyperledger/fabric-contract-api-go v1.1.1
+	github.com/hyperledger/fabric-protos-go v0.0.0-20200424173316-dd554ba3746e
+	github.com/tealeg/xlsx v1.0.5
 	golang.org/x/net v0.0.0-20200813134508-3edf25e44fcc // indirect
-	google.golang.org/grpc v1.31.0 // indirect
+	golang.org/x/sys v0.0.0-20200420163511-1957bb5e6d1f // indirect
+	golang.org/x/text v0.3.2 // indirect
+	google.golang.org/genproto v0.0.0-20200423170343-7949de9c1215 // indirect
 	gopkg.in/yaml.v2 v2.3.0 // indirect
 )
+
+// the chaincode service, logging, monitoring and routing packages shared with the marbles chaincode
+replace chaincode-common => ../../../chaincode-common
@@ -0,0 +1,56 @@
+// Emissions chaincode entry point in Golang
+
+package main
+
+import (
+	"os"
+
+	"chaincode-common/cclog"
+	"chaincode-common/ccserver"
+	"chaincode-common/monitor"
+	"emissions/contract"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+/* main function */
+
+func main() {
+	// Health, readiness and metrics are served when CHAINCODE_MONITOR_ADDRESS is set
+	mon, err := monitor.FromEnv(contract.FunctionNames())
+	if err != nil {
+		cclog.Error("Error to start new SC", "error", err)
+		os.Exit(1)
+	}
+	chaincode, err := contract.NewChaincode()
+	if err != nil {
+		cclog.Error("Error to create new SC", "error", err)
+		os.Exit(1)
+	}
+	cc := mon.Instrument(chaincode)
+
+	if _, ok := os.LookupEnv("CHAINCODE_ADDRESS"); ok {
+		// Run as an external chaincode service the peer connects to, as packaged with connection.json
+		err = startServer(cc, mon)
+	} else {
+		mon.SetReady(true)
+		err = shim.Start(cc)
+	}
+	if err != nil {
+		cclog.Error("Error to start new SC", "error", err)
+		os.Exit(1)
+	}
+}
+
+func startServer(cc shim.Chaincode, mon *monitor.Monitor) error {
+	config, err := ccserver.ConfigFromEnv()
+	if err != nil {
+		return err
+	}
+	server, err := ccserver.New(cc, config)
+	if err != nil {
+		return err
+	}
+	mon.SetReady(true)
+	return server.Start()
+}